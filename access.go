@@ -0,0 +1,341 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// accessRules 库表可见性规则，均为 glob 模式（* ? [...]），不区分大小写。
+// 表规则写作 db.table 时匹配完整名称，只写 table 时匹配任意库中的同名表
+type accessRules struct {
+	allowDatabases []string
+	denyDatabases  []string
+	allowTables    []string
+	denyTables     []string
+}
+
+// loadAccessRules 从 ALLOWED_DATABASES / DENIED_DATABASES / ALLOWED_TABLES / DENIED_TABLES 读取规则（逗号分隔）
+func loadAccessRules() accessRules {
+	return accessRules{
+		allowDatabases: splitPatterns(getEnv("ALLOWED_DATABASES", "")),
+		denyDatabases:  splitPatterns(getEnv("DENIED_DATABASES", "")),
+		allowTables:    splitPatterns(getEnv("ALLOWED_TABLES", "")),
+		denyTables:     splitPatterns(getEnv("DENIED_TABLES", "")),
+	}
+}
+
+func splitPatterns(value string) []string {
+	var patterns []string
+	for _, p := range strings.Split(value, ",") {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+func (r accessRules) empty() bool {
+	return len(r.allowDatabases)+len(r.denyDatabases)+len(r.allowTables)+len(r.denyTables) == 0
+}
+
+func (r accessRules) hasTableRules() bool {
+	return len(r.allowTables)+len(r.denyTables) > 0
+}
+
+// systemSchemas 保存所有库表元数据的系统库，通过它们可以看到被隐藏的库表结构
+var systemSchemas = []string{"information_schema", "performance_schema", "mysql", "sys"}
+
+// databaseVisible 未配置白名单时默认可见，黑名单优先。
+// 只配置了黑名单时系统库默认不可见，需要时在 ALLOWED_DATABASES 中显式列出
+func (r accessRules) databaseVisible(database string) bool {
+	name := strings.ToLower(database)
+	if len(r.allowDatabases) > 0 {
+		if !matchAny(r.allowDatabases, name) {
+			return false
+		}
+	} else if len(r.denyDatabases)+len(r.denyTables) > 0 && matchAny(systemSchemas, name) {
+		return false
+	}
+	return !matchAny(r.denyDatabases, name)
+}
+
+func (r accessRules) tableVisible(database, table string) bool {
+	if !r.databaseVisible(database) {
+		return false
+	}
+	if len(r.allowTables) > 0 && !matchTable(r.allowTables, database, table) {
+		return false
+	}
+	return !matchTable(r.denyTables, database, table)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchTable(patterns []string, database, table string) bool {
+	full := strings.ToLower(database + "." + table)
+	name := strings.ToLower(table)
+	for _, p := range patterns {
+		target := name
+		if strings.Contains(p, ".") {
+			target = full
+		}
+		if ok, _ := path.Match(p, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDatabaseAccess 检查数据库是否在可见范围内
+func checkDatabaseAccess(database string) error {
+	if !loadAccessRules().databaseVisible(database) {
+		return fmt.Errorf("数据库 %s 不在允许访问的范围内", database)
+	}
+	return nil
+}
+
+// checkTableAccess 检查表是否在可见范围内
+func checkTableAccess(database, table string) error {
+	rules := loadAccessRules()
+	if !rules.databaseVisible(database) {
+		return fmt.Errorf("数据库 %s 不在允许访问的范围内", database)
+	}
+	if !rules.tableVisible(database, table) {
+		return fmt.Errorf("表 %s.%s 不在允许访问的范围内", database, table)
+	}
+	return nil
+}
+
+// filterTables 去掉不可见的表
+func filterTables(database string, tables []string) []string {
+	rules := loadAccessRules()
+	if rules.empty() {
+		return tables
+	}
+	visible := []string{}
+	for _, t := range tables {
+		if rules.tableVisible(database, t) {
+			visible = append(visible, t)
+		}
+	}
+	return visible
+}
+
+// queryTargets 语句访问的库和表，库名为空表示连接的默认库
+type queryTargets struct {
+	tables         [][2]string
+	databases      []string
+	listsDatabases bool // SHOW DATABASES
+	listsTables    bool // SHOW TABLES 等列出库中对象的语句
+}
+
+// checkQueryAccess 解析语句引用的库和表并按可见性规则检查，tables 为调用方已解析出的其他表。
+// 结果无法按规则过滤的 SHOW DATABASES / SHOW TABLES 在配置了相应规则时直接拒绝
+func checkQueryAccess(query string, tables ...[2]string) error {
+	rules := loadAccessRules()
+	if rules.empty() {
+		return nil
+	}
+	targets := resolveQueryTargets(tokenizeSQL(query))
+	targets.tables = append(targets.tables, tables...)
+	if targets.listsDatabases {
+		return fmt.Errorf("已配置库表可见性规则，请使用 list_databases 列出数据库")
+	}
+	if targets.listsTables && rules.hasTableRules() {
+		return fmt.Errorf("已配置表可见性规则，请使用 list_tables 列出表")
+	}
+
+	current := ""
+	resolve := func(database string) string {
+		if database != "" {
+			return database
+		}
+		if current == "" {
+			current, _ = currentDatabase(db)
+		}
+		return current
+	}
+	for _, d := range targets.databases {
+		if name := resolve(d); !rules.databaseVisible(name) {
+			return fmt.Errorf("数据库 %s 不在允许访问的范围内", name)
+		}
+	}
+	for _, t := range targets.tables {
+		database := resolve(t[0])
+		if !rules.databaseVisible(database) {
+			return fmt.Errorf("数据库 %s 不在允许访问的范围内", database)
+		}
+		if !rules.tableVisible(database, t[1]) {
+			return fmt.Errorf("表 %s.%s 不在允许访问的范围内", database, t[1])
+		}
+	}
+	return nil
+}
+
+// resolveQueryTargets 找出语句引用的表：FROM / JOIN / UPDATE / INTO / USING / TABLE 之后以及表列表中逗号之后的表名，
+// 包括子查询中的引用；SHOW 和 DESCRIBE 单独处理
+func resolveQueryTargets(tokens []sqlToken) queryTargets {
+	switch firstKeyword(tokens) {
+	case "SHOW":
+		return resolveShowTargets(tokens)
+	case "DESCRIBE", "DESC", "EXPLAIN":
+		if len(tokens) > 1 && isIdentToken(tokens[1]) && !tokens[1].isWord("SELECT", "FORMAT", "ANALYZE", "EXTENDED", "PARTITIONS") {
+			if schema, table, n := qualifiedName(tokens, 1); n > 0 {
+				return queryTargets{tables: [][2]string{{schema, table}}}
+			}
+		}
+	}
+
+	// WITH 定义的公用表表达式不是真实的表
+	ctes := map[string]bool{}
+	for i := 0; i+2 < len(tokens); i++ {
+		if isIdentToken(tokens[i]) && tokens[i+1].isWord("AS") && tokens[i+2].text == "(" &&
+			i > 0 && (tokens[i-1].isWord("WITH", "RECURSIVE") || tokens[i-1].text == ",") {
+			ctes[strings.ToLower(tokens[i].name())] = true
+		}
+	}
+
+	var targets queryTargets
+	inFrom := map[int]bool{}
+	expect := map[int]bool{}
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		d := t.depth
+		switch {
+		case t.isWord("UPDATE") && i > 0 && tokens[i-1].isWord("KEY", "FOR"):
+			// ON DUPLICATE KEY UPDATE / FOR UPDATE
+			inFrom[d], expect[d] = false, false
+		case t.isWord("USING") && i+1 < len(tokens) && tokens[i+1].text == "(":
+			// JOIN ... USING (列)
+			expect[d] = false
+		case t.isWord("FROM", "JOIN", "STRAIGHT_JOIN", "UPDATE", "USING"):
+			inFrom[d], expect[d] = true, true
+		case t.isWord("INTO"):
+			expect[d] = true
+		case t.isWord("SELECT", "WITH", "WHERE", "GROUP", "HAVING", "ORDER", "LIMIT", "UNION", "WINDOW", "SET", "VALUES", "VALUE", "FOR", "LOCK"):
+			inFrom[d], expect[d] = false, false
+		case t.text == "," && inFrom[d]:
+			expect[d] = true
+		case t.isWord("TABLE") && i+1 < len(tokens) && isIdentToken(tokens[i+1]) && !tokens[i+1].isWord("STATUS"):
+			// MySQL 8 的 TABLE t 语句（可作为子查询），以及 DDL 中 TABLE [IF [NOT] EXISTS] 之后的表名
+			j := i + 1
+			for j < len(tokens) && tokens[j].isWord("IF", "NOT", "EXISTS") {
+				j++
+			}
+			if schema, table, n := qualifiedName(tokens, j); n > 0 {
+				targets.tables = append(targets.tables, [2]string{schema, table})
+				i = j + n - 1
+			}
+			inFrom[d], expect[d] = true, false
+		case t.text == "(":
+			// 括号中的 JOIN 仍是表列表，子查询由其中的 SELECT 重置
+			inFrom[d+1], expect[d+1] = expect[d], expect[d]
+			expect[d] = false
+		case expect[d] && t.isWord("LATERAL", "LOW_PRIORITY", "HIGH_PRIORITY", "DELAYED", "QUICK", "IGNORE"):
+		case expect[d] && isIdentToken(t):
+			expect[d] = false
+			if t.isWord("DUAL", "OUTFILE", "DUMPFILE") {
+				continue
+			}
+			schema, table, n := qualifiedName(tokens, i)
+			if inFrom[d] && i+n < len(tokens) && tokens[i+n].text == "(" {
+				// JSON_TABLE(...) 等表函数
+				continue
+			}
+			if schema == "" && ctes[strings.ToLower(table)] {
+				i += n - 1
+				continue
+			}
+			targets.tables = append(targets.tables, [2]string{schema, table})
+			i += n - 1
+		default:
+			expect[d] = false
+		}
+	}
+	return targets
+}
+
+// resolveShowTargets 处理 SHOW 语句：
+// SHOW CREATE TABLE t、SHOW COLUMNS / INDEX FROM t [FROM db] 访问单个表，
+// SHOW TABLES / TABLE STATUS / TRIGGERS / EVENTS [FROM db] 列出库中的对象
+func resolveShowTargets(tokens []sqlToken) queryTargets {
+	var targets queryTargets
+	i := 1
+	for i < len(tokens) && tokens[i].isWord("FULL", "EXTENDED", "GLOBAL", "SESSION", "OPEN") {
+		i++
+	}
+	if i >= len(tokens) {
+		return targets
+	}
+
+	// FROM / IN 之后的库名
+	fromDatabase := func(from int) string {
+		for j := from; j+1 < len(tokens); j++ {
+			if tokens[j].isWord("FROM", "IN") && isIdentToken(tokens[j+1]) {
+				return tokens[j+1].name()
+			}
+		}
+		return ""
+	}
+
+	t := tokens[i]
+	switch {
+	case t.isWord("DATABASES", "SCHEMAS"):
+		targets.listsDatabases = true
+	case t.isWord("TABLES", "TRIGGERS", "EVENTS") || (t.isWord("TABLE") && i+1 < len(tokens) && tokens[i+1].isWord("STATUS")):
+		targets.listsTables = true
+		targets.databases = append(targets.databases, fromDatabase(i+1))
+	case t.isWord("CREATE") && i+1 < len(tokens):
+		kind := tokens[i+1]
+		switch {
+		case kind.isWord("DATABASE", "SCHEMA"):
+			j := i + 2
+			if j+2 < len(tokens) && tokens[j].isWord("IF") {
+				j += 3
+			}
+			if j < len(tokens) {
+				targets.databases = append(targets.databases, tokens[j].name())
+			}
+		case kind.isWord("TABLE", "VIEW", "TRIGGER"):
+			if schema, table, n := qualifiedName(tokens, i+2); n > 0 && !kind.isWord("TRIGGER") {
+				targets.tables = append(targets.tables, [2]string{schema, table})
+			} else if n > 0 {
+				targets.databases = append(targets.databases, schema)
+			}
+		}
+	case t.isWord("COLUMNS", "FIELDS", "INDEX", "INDEXES", "KEYS"):
+		for j := i + 1; j+1 < len(tokens); j++ {
+			if tokens[j].isWord("FROM", "IN") {
+				schema, table, n := qualifiedName(tokens, j+1)
+				if n == 0 {
+					break
+				}
+				if schema == "" {
+					schema = fromDatabase(j + 1 + n)
+				}
+				targets.tables = append(targets.tables, [2]string{schema, table})
+				break
+			}
+		}
+	}
+	return targets
+}
+
+// qualifiedName 读取 [schema.]name 形式的名称，返回占用的 token 数，不是名称时返回 0
+func qualifiedName(tokens []sqlToken, i int) (schema, name string, n int) {
+	if i >= len(tokens) || !isIdentToken(tokens[i]) {
+		return "", "", 0
+	}
+	if i+2 < len(tokens) && tokens[i+1].text == "." && isIdentToken(tokens[i+2]) {
+		return tokens[i].name(), tokens[i+2].name(), 3
+	}
+	return "", tokens[i].name(), 1
+}
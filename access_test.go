@@ -0,0 +1,114 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveQueryTargets(t *testing.T) {
+	tests := []struct {
+		query string
+		want  [][2]string
+	}{
+		{"SELECT * FROM shop.orders", [][2]string{{"shop", "orders"}}},
+		{"SELECT * FROM a JOIN b.c ON a.id = c.id", [][2]string{{"", "a"}, {"b", "c"}}},
+		{"SELECT * FROM a, `b`.`c` x", [][2]string{{"", "a"}, {"b", "c"}}},
+		{"SELECT (SELECT pwd FROM secret.users LIMIT 1) FROM t", [][2]string{{"secret", "users"}, {"", "t"}}},
+		{"WITH x AS (SELECT * FROM secret.t) SELECT * FROM x", [][2]string{{"secret", "t"}}},
+		{"TABLE secret.t", [][2]string{{"secret", "t"}}},
+		{"SELECT * FROM (TABLE secret.t) x", [][2]string{{"secret", "t"}}},
+		{"SELECT * FROM a WHERE id IN (TABLE secret.ids)", [][2]string{{"", "a"}, {"secret", "ids"}}},
+		{"SELECT id FROM a UNION TABLE secret.t ORDER BY id", [][2]string{{"", "a"}, {"secret", "t"}}},
+		{"DROP TABLE IF EXISTS secret.t, other", [][2]string{{"secret", "t"}, {"", "other"}}},
+		{"SHOW CREATE TABLE secret.t", [][2]string{{"secret", "t"}}},
+		{"SHOW COLUMNS FROM t FROM secret", [][2]string{{"secret", "t"}}},
+		{"DESCRIBE secret.t", [][2]string{{"secret", "t"}}},
+		{"SELECT * FROM JSON_TABLE('[]', '$[*]' COLUMNS (a INT PATH '$')) j", nil},
+		{"SELECT `table` FROM t", [][2]string{{"", "t"}}},
+	}
+	for _, tt := range tests {
+		got := resolveQueryTargets(tokenizeSQL(tt.query)).tables
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: tables = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestCheckQueryAccess(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		query   string
+		allowed bool
+	}{
+		{"plain table", map[string]string{"DENIED_DATABASES": "secret"}, "SELECT * FROM shop.t", true},
+		{"denied database", map[string]string{"DENIED_DATABASES": "secret"}, "SELECT * FROM secret.t", false},
+		{"table statement", map[string]string{"DENIED_DATABASES": "secret"}, "TABLE secret.t", false},
+		{"table subquery", map[string]string{"DENIED_DATABASES": "secret"}, "SELECT * FROM (TABLE secret.t) x", false},
+		{"denied table in table statement", map[string]string{"DENIED_TABLES": "shop.cards"}, "SELECT * FROM (TABLE shop.cards) x", false},
+		{"information_schema with deny rules", map[string]string{"DENIED_DATABASES": "secret"},
+			"SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = 'secret'", false},
+		{"performance_schema with table rules", map[string]string{"DENIED_TABLES": "*.cards"},
+			"SELECT * FROM performance_schema.events_statements_history", false},
+		{"information_schema explicitly allowed", map[string]string{"ALLOWED_DATABASES": "shop,information_schema", "DENIED_DATABASES": "secret"},
+			"SELECT * FROM information_schema.COLUMNS", true},
+		{"information_schema without allow list entry", map[string]string{"ALLOWED_DATABASES": "shop"},
+			"SELECT * FROM information_schema.COLUMNS", false},
+		{"show databases", map[string]string{"DENIED_DATABASES": "secret"}, "SHOW DATABASES", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"ALLOWED_DATABASES", "DENIED_DATABASES", "ALLOWED_TABLES", "DENIED_TABLES"} {
+				t.Setenv(key, tt.env[key])
+			}
+			err := checkQueryAccess(tt.query)
+			if (err == nil) != tt.allowed {
+				t.Errorf("checkQueryAccess(%q) = %v, allowed = %v", tt.query, err, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestDatabaseVisibleSystemSchemas(t *testing.T) {
+	tests := []struct {
+		rules    accessRules
+		database string
+		want     bool
+	}{
+		{accessRules{}, "information_schema", true},
+		{accessRules{denyDatabases: []string{"secret"}}, "information_schema", false},
+		{accessRules{denyDatabases: []string{"secret"}}, "MySQL", false},
+		{accessRules{denyDatabases: []string{"secret"}}, "shop", true},
+		{accessRules{allowDatabases: []string{"shop", "sys"}}, "sys", true},
+		{accessRules{allowDatabases: []string{"shop", "sys"}, denyDatabases: []string{"sys"}}, "sys", false},
+	}
+	for _, tt := range tests {
+		if got := tt.rules.databaseVisible(tt.database); got != tt.want {
+			t.Errorf("%+v databaseVisible(%s) = %v, want %v", tt.rules, tt.database, got, tt.want)
+		}
+	}
+}
+
+// 元数据查询的名称和关键字经绑定参数传入，LIKE 关键字中的通配符按字面匹配
+func TestLikePatterns(t *testing.T) {
+	if got := likeContains("a_b%c!"); got != "%a!_b!%c!!%" {
+		t.Errorf("likeContains = %q", got)
+	}
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"max_allowed%", "max_allowed_packet", true},
+		{"max_allowed%", "MAX_ALLOWEDX", true},
+		{`max\_allowed%`, "maxXallowed_packet", false},
+		{"%timeout", "lock_wait_timeout", true},
+		{"%timeout", "timeout_x", false},
+		{"a.b", "axb", false},
+		{"innodb_buffer_pool_size", "innodb_buffer_pool_size", true},
+	}
+	for _, tt := range tests {
+		if got := likeRegexp(tt.pattern).MatchString(tt.name); got != tt.want {
+			t.Errorf("LIKE %q on %q = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// bindTypes 带类型参数对象中 type 的可选值
+var bindTypes = []string{"string", "int", "number", "decimal", "bool", "null", "datetime", "date", "bytes"}
+
+// parseBindArgs 读取 args 参数：JSON 数组，或内容为 JSON 数组的字符串。
+// 保留每个元素的原始 JSON，便于写入分页令牌后在下一页重新绑定。
+func parseBindArgs(value interface{}) ([]json.RawMessage, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return nil, nil
+		}
+		var args []json.RawMessage
+		if err := json.Unmarshal([]byte(v), &args); err != nil {
+			return nil, fmt.Errorf("args 必须是 JSON 数组: %v", err)
+		}
+		return args, nil
+	case []interface{}:
+		args := make([]json.RawMessage, len(v))
+		for i, item := range v {
+			data, err := json.Marshal(item)
+			if err != nil {
+				return nil, fmt.Errorf("args[%d]: %v", i, err)
+			}
+			args[i] = data
+		}
+		return args, nil
+	}
+	return nil, fmt.Errorf("args 必须是数组")
+}
+
+// bindArgs 将参数转换为驱动可以绑定的值
+func bindArgs(args []json.RawMessage) ([]interface{}, error) {
+	values := make([]interface{}, len(args))
+	for i, raw := range args {
+		v, err := bindArg(raw)
+		if err != nil {
+			return nil, fmt.Errorf("args[%d]: %v", i, err)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// bindArg 转换单个参数。
+// 普通 JSON 值按字面类型绑定：字符串、数字（整数保持为整数）、布尔、null；
+// 对象形式 {"type": "...", "value": ...} 用于日期时间、二进制、大整数和精确小数。
+func bindArg(raw json.RawMessage) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	switch val := v.(type) {
+	case nil, string, bool:
+		return val, nil
+	case json.Number:
+		return bindNumber(val.String())
+	case map[string]interface{}:
+		return bindTypedArg(val)
+	}
+	return nil, fmt.Errorf("不支持的参数值 %s", raw)
+}
+
+func bindNumber(text string) (interface{}, error) {
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return n, nil
+	}
+	if n, err := strconv.ParseUint(text, 10, 64); err == nil {
+		return n, nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("无效的数字 %q", text)
+	}
+	return f, nil
+}
+
+func bindTypedArg(arg map[string]interface{}) (interface{}, error) {
+	typ, _ := arg["type"].(string)
+	value, hasValue := arg["value"]
+	if value == nil && typ != "null" {
+		if !hasValue {
+			return nil, fmt.Errorf("缺少 value")
+		}
+		return nil, nil
+	}
+
+	// 数字和字符串都按文本处理，避免大整数经过 float64 丢失精度
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case json.Number:
+		text = v.String()
+	case bool:
+		text = strconv.FormatBool(v)
+	}
+
+	switch strings.ToLower(typ) {
+	case "null":
+		return nil, nil
+	case "string":
+		return text, nil
+	case "int", "integer":
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n, nil
+		}
+		if n, err := strconv.ParseUint(text, 10, 64); err == nil {
+			return n, nil
+		}
+		return nil, fmt.Errorf("无效的整数 %q", text)
+	case "number", "float", "double":
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("无效的数字 %q", text)
+		}
+		return f, nil
+	case "decimal":
+		// 以字符串传给 MySQL，由服务端按列类型精确转换
+		if _, err := strconv.ParseFloat(text, 64); err != nil {
+			return nil, fmt.Errorf("无效的小数 %q", text)
+		}
+		return text, nil
+	case "bool", "boolean":
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, fmt.Errorf("无效的布尔值 %q", text)
+		}
+		return b, nil
+	case "datetime", "timestamp":
+		return parseBindTime(text, "2006-01-02T15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999", "2006-01-02T15:04:05.999999", "2006-01-02")
+	case "date":
+		return parseBindTime(text, "2006-01-02")
+	case "bytes", "binary":
+		encoding, _ := arg["encoding"].(string)
+		return decodeBindBytes(text, encoding)
+	}
+	return nil, fmt.Errorf("不支持的参数类型 %q（可选 %s）", typ, strings.Join(bindTypes, " / "))
+}
+
+// parseBindTime 按顺序尝试各个格式，不带时区的时间按连接的 loc 解析（见 bindLocation）
+func parseBindTime(text string, layouts ...string) (time.Time, error) {
+	loc := bindLocation()
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, text, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无效的时间 %q", text)
+}
+
+// bindLocation 返回连接配置的 loc（MYSQL_DSN_PARAMS 中的 loc，默认 UTC）。
+// 驱动发送时间参数前会转换到这个时区，按同一时区解析才能原样写入字面上的时间
+func bindLocation() *time.Location {
+	if extra := strings.TrimLeft(getEnv("MYSQL_DSN_PARAMS", ""), "?&"); extra != "" {
+		if cfg, err := mysql.ParseDSN("/?" + extra); err == nil && cfg.Loc != nil {
+			return cfg.Loc
+		}
+	}
+	return time.UTC
+}
+
+// decodeBindBytes 解码二进制参数，兼容 execute_query 输出的 base64:... 和 0x... 形式
+func decodeBindBytes(text, encoding string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(text, "base64:"):
+		text, encoding = strings.TrimPrefix(text, "base64:"), "base64"
+	case strings.HasPrefix(text, "0x") || strings.HasPrefix(text, "0X"):
+		text, encoding = text[2:], "hex"
+	}
+
+	if normalizeBinaryEncoding(encoding) == "hex" {
+		b, err := hex.DecodeString(text)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 hex 数据: %v", err)
+		}
+		return b, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 base64 数据: %v", err)
+	}
+	return b, nil
+}
+
+// countPlaceholders 统计语句中的 ? 占位符（忽略字符串、标识符和注释中的问号）
+func countPlaceholders(query string) int {
+	n := 0
+	for _, t := range tokenizeSQL(query) {
+		if t.kind == tokParam {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBindArg(t *testing.T) {
+	t.Setenv("MYSQL_DSN_PARAMS", "")
+	tests := []struct {
+		raw     string
+		want    interface{}
+		wantErr bool
+	}{
+		{`"abc"`, "abc", false},
+		{`42`, int64(42), false},
+		{`18446744073709551615`, uint64(18446744073709551615), false},
+		{`1.5`, 1.5, false},
+		{`true`, true, false},
+		{`null`, nil, false},
+		{`[1]`, nil, true},
+		{`{"type":"int","value":"9007199254740993"}`, int64(9007199254740993), false},
+		{`{"type":"int","value":"x"}`, nil, true},
+		{`{"type":"decimal","value":"12.345"}`, "12.345", false},
+		{`{"type":"decimal","value":"abc"}`, nil, true},
+		{`{"type":"bool","value":"false"}`, false, false},
+		{`{"type":"null"}`, nil, false},
+		{`{"type":"string"}`, nil, true},
+		{`{"type":"string","value":null}`, nil, false},
+		{`{"type":"bytes","value":"0x6869"}`, []byte("hi"), false},
+		{`{"type":"bytes","value":"base64:aGk="}`, []byte("hi"), false},
+		{`{"type":"bytes","value":"6869","encoding":"hex"}`, []byte("hi"), false},
+		{`{"type":"bytes","value":"zz","encoding":"hex"}`, nil, true},
+		{`{"type":"date","value":"2024-02-30"}`, nil, true},
+		{`{"type":"datetime","value":"2024-01-02T15:04:05+08:00"}`, time.Date(2024, 1, 2, 15, 4, 5, 0, time.FixedZone("", 8*3600)), false},
+		{`{"type":"datetime","value":"2024-01-02 15:04:05.25"}`, time.Date(2024, 1, 2, 15, 4, 5, 250000000, time.UTC), false},
+		{`{"type":"date","value":"2024-01-02"}`, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), false},
+		{`{"type":"uuid","value":"x"}`, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := bindArg(json.RawMessage(tt.raw))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("bindArg(%s) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if want, ok := tt.want.(time.Time); ok {
+			if gotTime, ok := got.(time.Time); !ok || !gotTime.Equal(want) {
+				t.Errorf("bindArg(%s) = %v, want %v", tt.raw, got, want)
+			}
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("bindArg(%s) = %#v, want %#v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+// 不带时区的时间按 MYSQL_DSN_PARAMS 中的 loc 解析，带时区的保持不变
+func TestParseBindTimeLocation(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip(err)
+	}
+	layouts := []string{"2006-01-02T15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999", "2006-01-02"}
+	tests := []struct {
+		params string
+		text   string
+		want   time.Time
+	}{
+		{"", "2024-01-02 15:04:05", time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"loc=Asia%2FShanghai", "2024-01-02 15:04:05", time.Date(2024, 1, 2, 15, 4, 5, 0, shanghai)},
+		{"timeout=5s&loc=Asia%2FShanghai", "2024-01-02", time.Date(2024, 1, 2, 0, 0, 0, 0, shanghai)},
+		{"loc=Asia%2FShanghai", "2024-01-02T15:04:05Z", time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Setenv("MYSQL_DSN_PARAMS", tt.params)
+		got, err := parseBindTime(tt.text, layouts...)
+		if err != nil {
+			t.Errorf("%s with %q: %v", tt.text, tt.params, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%s with %q = %v, want %v", tt.text, tt.params, got, tt.want)
+		}
+		if tt.params != "" && tt.text[len(tt.text)-1] != 'Z' && got.Location().String() != "Asia/Shanghai" {
+			t.Errorf("%s with %q parsed in %s", tt.text, tt.params, got.Location())
+		}
+	}
+}
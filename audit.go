@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// 审计日志轮转默认值，可通过 AUDIT_LOG_MAX_SIZE（MB）/ AUDIT_LOG_MAX_BACKUPS 调整
+const (
+	defaultAuditMaxSizeMB  = 100
+	defaultAuditMaxBackups = 5
+)
+
+// auditMaxArgLength 单个字符串参数写入审计日志的最大长度
+const auditMaxArgLength = 4096
+
+// auditEntry 审计日志中的一条记录，每次工具调用一条
+type auditEntry struct {
+	Time       time.Time              `json:"time"`
+	Client     string                 `json:"client,omitempty"`
+	Session    string                 `json:"session,omitempty"`
+	Tool       string                 `json:"tool"`
+	Args       map[string]interface{} `json:"args,omitempty"`
+	SQL        []string               `json:"sql,omitempty"` // 调用方提交的 SQL，元数据等工具内部执行的查询不记录
+	DurationMs int64                  `json:"duration_ms"`
+	Rows       *int64                 `json:"rows,omitempty"` // 与 SQL 一起记录，其他工具没有此字段
+	Outcome    string                 `json:"outcome"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// auditLog 保护审计记录的追加和写入，工具调用可能并发执行
+var auditLog sync.Mutex
+
+// auditEnabled 配置了 AUDIT_LOG_FILE 或 AUDIT_SYSLOG 时记录审计日志
+func auditEnabled() bool {
+	return auditFile() != "" || getEnv("AUDIT_SYSLOG", "") != ""
+}
+
+func auditFile() string {
+	path := getEnv("AUDIT_LOG_FILE", "")
+	if strings.EqualFold(path, "off") {
+		return ""
+	}
+	return path
+}
+
+// auditHandler 记录调用方、脱敏后的参数、耗时和结果；执行调用方 SQL 的工具另由 auditQuery 补充 SQL 和行数
+func auditHandler(name string, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(request map[string]interface{}) (*mcp.CallToolResult, error) {
+		if !auditEnabled() {
+			return handler(request)
+		}
+
+		call := callOf(request)
+		entry := &auditEntry{
+			Time:   time.Now(),
+			Client: clientOf(call),
+			Tool:   name,
+			Args:   redactArgs(request),
+		}
+		entry.Session, _ = request["session_id"].(string)
+		if call != nil {
+			auditLog.Lock()
+			call.audit = entry
+			auditLog.Unlock()
+		}
+
+		result, err := handler(request)
+
+		entry.DurationMs = time.Since(entry.Time).Milliseconds()
+		entry.Outcome = "ok"
+		switch {
+		case err != nil:
+			entry.Outcome, entry.Error = "error", err.Error()
+		case result != nil && result.IsError:
+			entry.Outcome = "error"
+			for _, c := range result.Content {
+				if text, ok := c.(mcp.TextContent); ok {
+					entry.Error = text.Text
+					break
+				}
+			}
+		}
+		auditLog.Lock()
+		writeAudit(entry)
+		auditLog.Unlock()
+		return result, err
+	}
+}
+
+// auditQuery 把调用方提交的 SQL 和返回行数记入所属调用的审计记录，由写查询历史的 recordQuery 调用。
+// 只有执行调用方 SQL 的工具写查询历史，其他工具内部拼出的元数据查询不进入审计的 sql 字段
+func auditQuery(call *toolCall, query string, rows int64) {
+	auditLog.Lock()
+	defer auditLog.Unlock()
+	if call == nil || call.audit == nil {
+		return
+	}
+	entry := call.audit
+	if m, err := loadMasker(); err == nil && m != nil {
+		query = m.detect(query)
+	}
+	entry.SQL = append(entry.SQL, query)
+	if entry.Rows == nil {
+		entry.Rows = new(int64)
+	}
+	*entry.Rows += rows
+}
+
+// sensitiveArgKeys 名称包含这些词的参数整体替换为 [REDACTED]
+var sensitiveArgKeys = []string{"password", "passwd", "secret", "token", "authorization", "cookie", "api_key", "apikey"}
+
+// redactArgs 复制参数并脱敏：敏感参数名整体遮盖，字符串按脱敏检测器处理并截断过长的值，
+// *_json 参数解析后再逐字段处理
+func redactArgs(request map[string]interface{}) map[string]interface{} {
+	m, _ := loadMasker()
+	redacted, _ := redactValue(m, request).(map[string]interface{})
+	return redacted
+}
+
+func redactValue(m *masker, v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if sensitiveArgKey(key) {
+				out[key] = "[REDACTED]"
+				continue
+			}
+			if text, ok := item.(string); ok && strings.HasSuffix(key, "_json") {
+				var parsed interface{}
+				if json.Unmarshal([]byte(text), &parsed) == nil {
+					item = parsed
+				}
+			}
+			out[key] = redactValue(m, item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = redactValue(m, item)
+		}
+		return out
+	case string:
+		if m != nil {
+			v = m.detect(v)
+		}
+		if len(v) > auditMaxArgLength {
+			cut := auditMaxArgLength
+			for cut > 0 && !utf8.RuneStart(v[cut]) {
+				cut--
+			}
+			v = v[:cut] + fmt.Sprintf("...(%d bytes)", len(v))
+		}
+		return v
+	}
+	return v
+}
+
+func sensitiveArgKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveArgKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeAudit 写入审计文件和 syslog。写入失败只写日志，不影响工具调用
+func writeAudit(entry *auditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("audit log: %v", err)
+		return
+	}
+	line = []byte(scrubSecrets(string(line)))
+	if path := auditFile(); path != "" {
+		if err := appendAuditFile(path, line); err != nil {
+			log.Printf("audit log: %v", err)
+		}
+	}
+	if target := getEnv("AUDIT_SYSLOG", ""); target != "" {
+		if err := writeAuditSyslog(target, string(line), entry.Outcome != "ok"); err != nil {
+			log.Printf("audit syslog: %v", err)
+		}
+	}
+}
+
+// appendAuditFile 追加一行，文件超过大小上限时先轮转：audit.jsonl -> audit.jsonl.1 -> audit.jsonl.2 ...
+func appendAuditFile(path string, line []byte) error {
+	if dir := filepath.Dir(path); dir != "." {
+		os.MkdirAll(dir, 0o755)
+	}
+	maxSize := int64(getEnvInt("AUDIT_LOG_MAX_SIZE", defaultAuditMaxSizeMB)) << 20
+	if info, err := os.Stat(path); err == nil && info.Size() > 0 && info.Size()+int64(len(line))+1 > maxSize {
+		if err := rotateAuditFile(path, getEnvInt("AUDIT_LOG_MAX_BACKUPS", defaultAuditMaxBackups)); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func rotateAuditFile(path string, backups int) error {
+	os.Remove(fmt.Sprintf("%s.%d", path, backups))
+	for i := backups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+	}
+	return os.Rename(path, path+".1")
+}
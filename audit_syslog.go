@@ -0,0 +1,52 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"log/syslog"
+	"strings"
+	"sync"
+)
+
+var auditSyslog struct {
+	sync.Mutex
+	target string
+	writer *syslog.Writer
+}
+
+// writeAuditSyslog 发送一条审计记录到 syslog。target 为 local（本机 syslog）
+// 或 udp://host:port、tcp://host:port（省略协议时为 UDP），写入失败时下次重新连接
+func writeAuditSyslog(target, line string, failed bool) error {
+	auditSyslog.Lock()
+	defer auditSyslog.Unlock()
+	if auditSyslog.writer == nil || auditSyslog.target != target {
+		if auditSyslog.writer != nil {
+			auditSyslog.writer.Close()
+			auditSyslog.writer = nil
+		}
+		network, addr := "", ""
+		if target != "local" {
+			var ok bool
+			if network, addr, ok = strings.Cut(target, "://"); !ok {
+				network, addr = "udp", target
+			}
+		}
+		w, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_AUTH, "mysql-mcp")
+		if err != nil {
+			return err
+		}
+		auditSyslog.target, auditSyslog.writer = target, w
+	}
+
+	var err error
+	if failed {
+		err = auditSyslog.writer.Warning(line)
+	} else {
+		err = auditSyslog.writer.Info(line)
+	}
+	if err != nil {
+		auditSyslog.writer.Close()
+		auditSyslog.writer = nil
+	}
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package main
+
+import "fmt"
+
+// writeAuditSyslog 当前平台不支持 syslog
+func writeAuditSyslog(target, line string, failed bool) error {
+	return fmt.Errorf("当前平台不支持 syslog")
+}
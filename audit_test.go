@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 只有执行调用方 SQL 的工具带 sql 和 rows，元数据工具的记录没有这两个字段
+func TestAuditSQLOnlyForUserQueries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	t.Setenv("AUDIT_LOG_FILE", path)
+	t.Setenv("QUERY_HISTORY_FILE", "off")
+	t.Setenv("MASKING_RULES_FILE", "")
+	t.Setenv("MASKING_DETECTORS", "")
+
+	query := auditHandler("execute_query", func(request map[string]interface{}) (*mcp.CallToolResult, error) {
+		recordQuery(historyEntry{call: callOf(request), Tool: "execute_query", Query: "SELECT 1", Rows: 1})
+		return mcp.NewToolResultText("ok"), nil
+	})
+	meta := auditHandler("list_tables", func(request map[string]interface{}) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("ok"), nil
+	})
+	for _, h := range []func(map[string]interface{}) (*mcp.CallToolResult, error){query, meta} {
+		args := map[string]interface{}{}
+		key := registerCall(args, &toolCall{})
+		h(args)
+		unregisterCall(key)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []map[string]interface{}
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries = %v", entries)
+	}
+	if sql, _ := entries[0]["sql"].([]interface{}); len(sql) != 1 || sql[0] != "SELECT 1" || entries[0]["rows"] != float64(1) {
+		t.Errorf("execute_query entry = %v", entries[0])
+	}
+	if _, ok := entries[1]["sql"]; ok {
+		t.Errorf("list_tables entry has sql: %v", entries[1])
+	}
+	if _, ok := entries[1]["rows"]; ok {
+		t.Errorf("list_tables entry has rows: %v", entries[1])
+	}
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigWatchInterval 检查配置文件是否修改的间隔（秒），可通过 CONFIG_WATCH_INTERVAL 调整，0 表示只在 SIGHUP 时重新加载
+const defaultConfigWatchInterval = 2
+
+// settingKind 配置项的值类型
+type settingKind int
+
+const (
+	kindString   settingKind = iota
+	kindInt                  // 非负整数，0 表示不限制或关闭
+	kindPositive             // 正整数
+	kindBool
+	kindList // 字符串列表，转为逗号分隔
+	kindMap  // 名称到非负整数的映射，转为 name=n,name=n
+)
+
+// setting 配置文件中的一项及其对应的环境变量。restart 为 true 的项修改后需要重启才生效
+type setting struct {
+	path    string
+	env     string
+	kind    settingKind
+	enum    []string
+	restart bool
+}
+
+var settings = []setting{
+
+	{path: "mysql.host", env: "MYSQL_HOST", restart: true},
+	{path: "mysql.port", env: "MYSQL_PORT", kind: kindPositive, restart: true},
+	{path: "mysql.user", env: "MYSQL_USER", restart: true},
+	{path: "mysql.password", env: "MYSQL_PASSWORD", restart: true},
+	{path: "mysql.password_file", env: "MYSQL_PASSWORD_FILE", restart: true},
+	{path: "mysql.password_command", env: "MYSQL_PASSWORD_COMMAND", restart: true},
+	{path: "mysql.option_file", env: "MYSQL_OPTION_FILE", restart: true},
+	{path: "mysql.login_path", env: "MYSQL_LOGIN_PATH", restart: true},
+	{path: "mysql.database", env: "MYSQL_DATABASE", restart: true},
+	{path: "mysql.socket", env: "MYSQL_SOCKET", restart: true},
+	{path: "mysql.ssl.mode", env: "MYSQL_SSL_MODE", enum: sslModes, restart: true},
+	{path: "mysql.ssl.ca", env: "MYSQL_SSL_CA", restart: true},
+	{path: "mysql.ssl.cert", env: "MYSQL_SSL_CERT", restart: true},
+	{path: "mysql.ssl.key", env: "MYSQL_SSL_KEY", restart: true},
+	{path: "mysql.dsn_params", env: "MYSQL_DSN_PARAMS", restart: true},
+	{path: "mysql.pool.max_open_conns", env: "MYSQL_MAX_OPEN_CONNS", kind: kindPositive},
+	{path: "mysql.pool.max_idle_conns", env: "MYSQL_MAX_IDLE_CONNS", kind: kindPositive},
+	{path: "mysql.pool.conn_max_lifetime", env: "MYSQL_CONN_MAX_LIFETIME", kind: kindPositive},
+	{path: "mysql.pool.conn_max_idle_time", env: "MYSQL_CONN_MAX_IDLE_TIME", kind: kindPositive},
+	{path: "mysql.ping_interval", env: "MYSQL_PING_INTERVAL", kind: kindPositive},
+	{path: "mysql.retry_max_interval", env: "MYSQL_RETRY_MAX_INTERVAL", kind: kindPositive},
+	{path: "mysql.replicas", env: "MYSQL_REPLICAS", kind: kindList, restart: true},
+	{path: "mysql.replica_max_lag", env: "REPLICA_MAX_LAG", kind: kindPositive},
+	{path: "mysql.replica_check_interval", env: "REPLICA_CHECK_INTERVAL", kind: kindPositive},
+
+	{path: "ssh.host", env: "SSH_HOST", restart: true},
+	{path: "ssh.port", env: "SSH_PORT", kind: kindPositive, restart: true},
+	{path: "ssh.user", env: "SSH_USER", restart: true},
+	{path: "ssh.key_file", env: "SSH_KEY_FILE", restart: true},
+	{path: "ssh.key_passphrase", env: "SSH_KEY_PASSPHRASE", restart: true},
+	{path: "ssh.known_hosts", env: "SSH_KNOWN_HOSTS", kind: kindList, restart: true},
+	{path: "ssh.keepalive_interval", env: "SSH_KEEPALIVE_INTERVAL", kind: kindPositive},
+	{path: "ssh.connect_timeout", env: "SSH_CONNECT_TIMEOUT", kind: kindPositive, restart: true},
+
+	{path: "tools.enabled", env: "TOOLS_ENABLED", kind: kindList},
+	{path: "tools.disabled", env: "TOOLS_DISABLED", kind: kindList},
+	{path: "tools.max_concurrency", env: "TOOL_MAX_CONCURRENCY", kind: kindInt},
+	{path: "tools.queue_size", env: "TOOL_QUEUE_SIZE", kind: kindInt},
+	{path: "tools.queue_timeout", env: "TOOL_QUEUE_TIMEOUT", kind: kindPositive},
+	{path: "tools.concurrency_limits", env: "TOOL_CONCURRENCY_LIMITS", kind: kindMap},
+
+	{path: "limits.max_execution_time", env: "QUERY_MAX_EXECUTION_TIME", kind: kindInt},
+	{path: "limits.lock_wait_timeout", env: "QUERY_LOCK_WAIT_TIMEOUT", kind: kindInt},
+	{path: "limits.sql_select_limit", env: "QUERY_SQL_SELECT_LIMIT", kind: kindInt},
+	{path: "limits.read_only_transaction", env: "QUERY_READ_ONLY_TRANSACTION", kind: kindBool},
+	{path: "limits.page_max_bytes", env: "QUERY_PAGE_MAX_BYTES", kind: kindInt},
+	{path: "limits.cost_guard", env: "QUERY_COST_GUARD", enum: []string{"off", "warn", "reject"}},
+	{path: "limits.max_examined_rows", env: "QUERY_MAX_EXAMINED_ROWS", kind: kindPositive},
+	{path: "limits.full_scan_max_rows", env: "QUERY_FULL_SCAN_MAX_ROWS", kind: kindPositive},
+	{path: "limits.filesort_max_rows", env: "QUERY_FILESORT_MAX_ROWS", kind: kindPositive},
+
+	{path: "access.allowed_databases", env: "ALLOWED_DATABASES", kind: kindList},
+	{path: "access.denied_databases", env: "DENIED_DATABASES", kind: kindList},
+	{path: "access.allowed_tables", env: "ALLOWED_TABLES", kind: kindList},
+	{path: "access.denied_tables", env: "DENIED_TABLES", kind: kindList},
+
+	{path: "masking.rules_file", env: "MASKING_RULES_FILE"},
+	{path: "masking.detectors", env: "MASKING_DETECTORS", kind: kindList},
+	{path: "masking.secret", env: "MASKING_SECRET"},
+
+	{path: "write.enabled", env: "WRITE_ENABLED", kind: kindBool},
+	{path: "write.max_rows", env: "WRITE_MAX_ROWS", kind: kindPositive},
+	{path: "write.sample_rows", env: "WRITE_SAMPLE_ROWS", kind: kindPositive},
+	{path: "write.confirm_ttl", env: "WRITE_CONFIRM_TTL", kind: kindPositive},
+
+	{path: "session.max", env: "SESSION_MAX", kind: kindPositive},
+	{path: "session.idle_timeout", env: "SESSION_IDLE_TIMEOUT", kind: kindPositive},
+
+	{path: "logging.audit_file", env: "AUDIT_LOG_FILE"},
+	{path: "logging.audit_max_size", env: "AUDIT_LOG_MAX_SIZE", kind: kindPositive},
+	{path: "logging.audit_max_backups", env: "AUDIT_LOG_MAX_BACKUPS", kind: kindPositive},
+	{path: "logging.audit_syslog", env: "AUDIT_SYSLOG"},
+	{path: "logging.query_history_file", env: "QUERY_HISTORY_FILE"},
+	{path: "logging.query_history_max_entries", env: "QUERY_HISTORY_MAX_ENTRIES", kind: kindPositive},
+	{path: "logging.query_history_max_days", env: "QUERY_HISTORY_MAX_DAYS", kind: kindPositive},
+
+	{path: "paths.doc_output_dir", env: "DOC_OUTPUT_DIR"},
+	{path: "paths.api_spec_dir", env: "API_SPEC_DIR"},
+	{path: "paths.schema_snapshot_dir", env: "SCHEMA_SNAPSHOT_DIR"},
+	{path: "paths.export_dir", env: "EXPORT_DIR"},
+	{path: "paths.saved_query_dir", env: "SAVED_QUERY_DIR"},
+
+	{path: "export.max_rows", env: "EXPORT_MAX_ROWS", kind: kindInt},
+	{path: "export.max_bytes", env: "EXPORT_MAX_BYTES", kind: kindInt},
+}
+
+// fileConfig 当前生效的配置文件内容，按环境变量名保存
+var fileConfig struct {
+	sync.RWMutex
+	path   string
+	values map[string]string
+	stamp  string // 修改时间和大小，用于检测文件变化
+}
+
+// lookupSetting 读取配置：环境变量优先，其次是配置文件
+func lookupSetting(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	fileConfig.RLock()
+	defer fileConfig.RUnlock()
+	return fileConfig.values[key]
+}
+
+// loadConfigFile 启动时加载 CONFIG_FILE 指定的配置文件，未设置时不使用配置文件
+func loadConfigFile() error {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return nil
+	}
+	values, stamp, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	fileConfig.Lock()
+	fileConfig.path, fileConfig.values, fileConfig.stamp = path, values, stamp
+	fileConfig.Unlock()
+	if _, err := loadMasker(); err != nil {
+		return err
+	}
+	warnShadowed(values)
+	return nil
+}
+
+// readConfigFile 读取并校验配置文件，错误信息带行号，一次列出所有问题
+func readConfigFile(path string) (map[string]string, string, error) {
+	stamp, err := configStamp(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("读取配置文件失败: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("读取配置文件失败: %v", err)
+	}
+
+	var root *yaml.Node
+	if isTOMLConfig(path) {
+		if root, err = parseTOMLConfig(data); err != nil {
+			return nil, "", fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+		}
+	} else {
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, "", fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+		}
+		if len(doc.Content) > 0 {
+			root = doc.Content[0]
+		}
+	}
+	values := map[string]string{}
+	if root == nil {
+		return values, stamp, nil
+	}
+
+	var errs []string
+	walkConfig(root, "", values, &errs)
+	errs = append(errs, checkConfigValues(values)...)
+	if len(errs) > 0 {
+		return nil, "", fmt.Errorf("配置文件 %s 有误:\n  %s", path, strings.Join(errs, "\n  "))
+	}
+	return values, stamp, nil
+}
+
+// walkConfig 遍历 YAML 映射，把已知的配置项转为环境变量形式的值
+func walkConfig(node *yaml.Node, prefix string, values map[string]string, errs *[]string) {
+	if node.Kind != yaml.MappingNode {
+		name := strings.TrimSuffix(prefix, ".")
+		if name == "" {
+			name = "顶层"
+		}
+		*errs = append(*errs, fmt.Sprintf("第 %d 行：%s 应为映射", node.Line, name))
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+		path := prefix + keyNode.Value
+		if s := findSetting(path); s != nil {
+			if valueNode.Tag == "!!null" {
+				continue
+			}
+			value, err := convertSetting(s, valueNode)
+			if err != nil {
+				*errs = append(*errs, fmt.Sprintf("第 %d 行：%s %v", valueNode.Line, path, err))
+				continue
+			}
+			values[s.env] = value
+			continue
+		}
+		if hasSettingPrefix(path + ".") {
+			walkConfig(valueNode, path+".", values, errs)
+			continue
+		}
+		*errs = append(*errs, fmt.Sprintf("第 %d 行：未知配置项 %s", keyNode.Line, path))
+	}
+}
+
+func findSetting(path string) *setting {
+	for i := range settings {
+		if settings[i].path == path {
+			return &settings[i]
+		}
+	}
+	return nil
+}
+
+func hasSettingPrefix(prefix string) bool {
+	for _, s := range settings {
+		if strings.HasPrefix(s.path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// convertSetting 按类型校验并转换配置值
+func convertSetting(s *setting, node *yaml.Node) (string, error) {
+	switch s.kind {
+	case kindInt:
+		n, err := strconv.Atoi(node.Value)
+		if node.Kind != yaml.ScalarNode || err != nil || n < 0 {
+			return "", fmt.Errorf("应为非负整数，实际为 %s", describeNode(node))
+		}
+		return strconv.Itoa(n), nil
+	case kindPositive:
+		n, err := strconv.Atoi(node.Value)
+		if node.Kind != yaml.ScalarNode || err != nil || n <= 0 {
+			return "", fmt.Errorf("应为正整数，实际为 %s", describeNode(node))
+		}
+		return strconv.Itoa(n), nil
+	case kindBool:
+		var b bool
+		if node.Kind != yaml.ScalarNode || node.Decode(&b) != nil {
+			return "", fmt.Errorf("应为 true 或 false，实际为 %s", describeNode(node))
+		}
+		return strconv.FormatBool(b), nil
+	case kindList:
+		if node.Kind == yaml.ScalarNode {
+			return node.Value, nil
+		}
+		var items []string
+		if node.Kind != yaml.SequenceNode || node.Decode(&items) != nil {
+			return "", fmt.Errorf("应为字符串列表，实际为 %s", describeNode(node))
+		}
+		return strings.Join(items, ","), nil
+	case kindMap:
+		if node.Kind != yaml.MappingNode {
+			return "", fmt.Errorf("应为“名称: 数量”的映射，实际为 %s", describeNode(node))
+		}
+		var items []string
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name, value := node.Content[i].Value, node.Content[i+1]
+			if n, err := strconv.Atoi(value.Value); value.Kind != yaml.ScalarNode || err != nil || n < 0 {
+				return "", fmt.Errorf("中 %s 应为非负整数，实际为 %s", name, describeNode(value))
+			}
+			items = append(items, name+"="+value.Value)
+		}
+		return strings.Join(items, ","), nil
+	}
+
+	if node.Kind != yaml.ScalarNode {
+		return "", fmt.Errorf("应为字符串，实际为 %s", describeNode(node))
+	}
+	if len(s.enum) > 0 {
+		for _, v := range s.enum {
+			if strings.EqualFold(node.Value, v) {
+				return v, nil
+			}
+		}
+		return "", fmt.Errorf("只能是 %s，实际为 %q", strings.Join(s.enum, " / "), node.Value)
+	}
+	return node.Value, nil
+}
+
+func describeNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "映射"
+	case yaml.SequenceNode:
+		return "列表"
+	}
+	return strconv.Quote(node.Value)
+}
+
+// checkConfigValues 检查需要结合多个值或外部信息才能判断的配置
+func checkConfigValues(values map[string]string) []string {
+	var errs []string
+	if params := values["MYSQL_DSN_PARAMS"]; params != "" {
+		if err := checkDSNParams(params); err != nil {
+			errs = append(errs, fmt.Sprintf("mysql.dsn_params 无效: %v", err))
+		}
+	}
+	for _, s := range []struct{ path, env string }{
+		{"tools.enabled", "TOOLS_ENABLED"},
+		{"tools.disabled", "TOOLS_DISABLED"},
+		{"tools.concurrency_limits", "TOOL_CONCURRENCY_LIMITS"},
+	} {
+		for _, item := range strings.Split(values[s.env], ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(item), "=")
+			if name != "" && !knownTool(name) {
+				errs = append(errs, fmt.Sprintf("%s 中的 %s 不是已知的工具", s.path, name))
+			}
+		}
+	}
+	return errs
+}
+
+// warnShadowed 提示被同名环境变量覆盖的配置项，这些项修改配置文件不会生效
+func warnShadowed(values map[string]string) {
+	var shadowed []string
+	for _, s := range settings {
+		if _, ok := values[s.env]; ok && os.Getenv(s.env) != "" {
+			shadowed = append(shadowed, s.path+"（"+s.env+"）")
+		}
+	}
+	if len(shadowed) > 0 {
+		log.Printf("config: overridden by environment variables: %s", strings.Join(shadowed, ", "))
+	}
+}
+
+// watchConfig 收到 SIGHUP 或配置文件修改后重新加载
+func watchConfig() {
+	fileConfig.RLock()
+	path := fileConfig.path
+	fileConfig.RUnlock()
+	if path == "" {
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reloadConfig(true)
+		}
+	}()
+	if interval := getEnvLimit("CONFIG_WATCH_INTERVAL", defaultConfigWatchInterval); interval > 0 {
+		go func() {
+			for {
+				time.Sleep(time.Duration(interval) * time.Second)
+				reloadConfig(false)
+			}
+		}()
+	}
+}
+
+var reloadMu sync.Mutex
+
+// reloadConfig 重新读取配置文件，校验失败时保留原配置。force 为 false 时文件未修改则跳过
+func reloadConfig(force bool) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	fileConfig.RLock()
+	path, stamp := fileConfig.path, fileConfig.stamp
+	fileConfig.RUnlock()
+	if !force {
+		if current, err := configStamp(path); err != nil || current == stamp {
+			return
+		}
+	}
+
+	values, newStamp, err := readConfigFile(path)
+	if err != nil {
+		reloadFailed(err)
+		// 记下有问题的版本，文件再次修改前不重复报错
+		if current, err := configStamp(path); err == nil {
+			fileConfig.Lock()
+			fileConfig.stamp = current
+			fileConfig.Unlock()
+		}
+		return
+	}
+
+	fileConfig.Lock()
+	old := fileConfig.values
+	fileConfig.values, fileConfig.stamp = values, newStamp
+	fileConfig.Unlock()
+
+	// 脱敏规则文件和检测器名称需要按新配置加载一次才能校验
+	if _, err := loadMasker(); err != nil {
+		fileConfig.Lock()
+		fileConfig.values = old
+		fileConfig.Unlock()
+		reloadFailed(err)
+		return
+	}
+
+	registerConfiguredSecrets()
+	changed, restart := diffSettings(old, values)
+	warnShadowed(values)
+	if len(changed) == 0 {
+		return
+	}
+	for _, key := range changed {
+		if strings.HasPrefix(key, "MYSQL_MAX_") || strings.HasPrefix(key, "MYSQL_CONN_MAX_") {
+			configurePool(db)
+			for _, r := range replicas.items {
+				configurePool(r.db)
+			}
+			break
+		}
+	}
+	for _, name := range unregisteredTools() {
+		if toolEnabled(name) {
+			restart = append(restart, "tools（"+name+" 启动时未注册）")
+		}
+	}
+
+	msg := fmt.Sprintf("配置已重新加载：%s", strings.Join(changed, ", "))
+	if len(restart) > 0 {
+		msg += fmt.Sprintf("；以下修改需要重启才能生效：%s", strings.Join(restart, ", "))
+	}
+	log.Printf("config: reloaded %s: %s", path, strings.Join(changed, ", "))
+	if len(restart) > 0 {
+		log.Printf("config: restart required for: %s", strings.Join(restart, ", "))
+	}
+	sendLogNotification(nil, mcp.LoggingLevelInfo, "config", msg)
+}
+
+// configStamp 文件的修改时间和大小
+func configStamp(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size()), nil
+}
+
+func reloadFailed(err error) {
+	log.Printf("config: reload failed, keeping previous settings: %v", err)
+	sendLogNotification(nil, mcp.LoggingLevelError, "config", fmt.Sprintf("配置重新加载失败，继续使用原配置：%v", err))
+}
+
+// diffSettings 返回实际生效值有变化的配置项（环境变量名），以及其中需要重启才生效的项（配置路径）
+func diffSettings(old, values map[string]string) (changed, restart []string) {
+	for _, s := range settings {
+		// 被环境变量覆盖的项实际值没有变化
+		if old[s.env] == values[s.env] || os.Getenv(s.env) != "" {
+			continue
+		}
+		changed = append(changed, s.env)
+		if s.restart {
+			restart = append(restart, s.path)
+		}
+	}
+	sort.Strings(changed)
+	return changed, restart
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// 同样的配置写成 YAML 和 TOML，得到的值相同
+func TestReadConfigFileFormats(t *testing.T) {
+	yamlPath := writeConfig(t, "config.yaml", `
+mysql:
+  host: 10.0.1.20
+  port: 3307
+  pool:
+    max_open_conns: 20
+tools:
+  disabled: [execute_write, export_query]
+  queue_size: 0
+  concurrency_limits:
+    analyze_column: 2
+    export_query: 1
+limits:
+  cost_guard: WARN
+  read_only_transaction: false
+`)
+	tomlPath := writeConfig(t, "config.toml", `
+[mysql]
+host = "10.0.1.20"
+port = 3307
+
+[mysql.pool]
+max_open_conns = 20
+
+[tools]
+disabled = ["execute_write", "export_query"]
+queue_size = 0
+concurrency_limits = { analyze_column = 2, export_query = 1 }
+
+[limits]
+cost_guard = "WARN"
+read_only_transaction = false
+`)
+	want := map[string]string{
+		"MYSQL_HOST":                  "10.0.1.20",
+		"MYSQL_PORT":                  "3307",
+		"MYSQL_MAX_OPEN_CONNS":        "20",
+		"TOOLS_DISABLED":              "execute_write,export_query",
+		"TOOL_QUEUE_SIZE":             "0",
+		"TOOL_CONCURRENCY_LIMITS":     "analyze_column=2,export_query=1",
+		"QUERY_COST_GUARD":            "warn",
+		"QUERY_READ_ONLY_TRANSACTION": "false",
+	}
+	for _, path := range []string{yamlPath, tomlPath} {
+		values, _, err := readConfigFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", filepath.Base(path), err)
+		}
+		for env, value := range want {
+			if values[env] != value {
+				t.Errorf("%s: %s = %q, want %q", filepath.Base(path), env, values[env], value)
+			}
+		}
+		if len(values) != len(want) {
+			t.Errorf("%s: values = %v", filepath.Base(path), values)
+		}
+	}
+}
+
+// 校验错误带行号，一次列出所有问题；两种格式的示例逐行对应
+func TestReadConfigFileErrors(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `mysql:
+  port: 0
+  hots: x
+tools:
+  queue_timeout: 0
+  queue_size: -1
+  disabled: [no_such_tool]
+limits:
+  cost_guard: always
+  read_only_transaction: maybe
+`,
+		"config.toml": `[mysql]
+port = 0
+hots = "x"
+[tools]
+queue_timeout = 0
+queue_size = -1
+disabled = ["no_such_tool"]
+[limits]
+cost_guard = "always"
+read_only_transaction = "maybe"
+`,
+	}
+	want := []string{
+		"第 2 行：mysql.port 应为正整数",
+		"第 3 行：未知配置项 mysql.hots",
+		"第 5 行：tools.queue_timeout 应为正整数",
+		"第 6 行：tools.queue_size 应为非负整数",
+		"第 9 行：limits.cost_guard 只能是 off / warn / reject",
+		"第 10 行：limits.read_only_transaction 应为 true 或 false",
+		"tools.disabled 中的 no_such_tool 不是已知的工具",
+	}
+	for name, content := range files {
+		_, _, err := readConfigFile(writeConfig(t, name, content))
+		if err == nil {
+			t.Fatalf("%s: invalid config accepted", name)
+		}
+		for _, msg := range want {
+			if !strings.Contains(err.Error(), msg) {
+				t.Errorf("%s: error missing %q:\n%v", name, msg, err)
+			}
+		}
+	}
+}
+
+func TestTOMLParseErrorLine(t *testing.T) {
+	path := writeConfig(t, "config.toml", "[mysql]\nhost = \"a\"\nport = \n")
+	_, _, err := readConfigFile(path)
+	if err == nil || !strings.Contains(err.Error(), "第 3 行") {
+		t.Errorf("err = %v, want line 3", err)
+	}
+}
+
+func TestTOMLKeyLines(t *testing.T) {
+	lines := tomlKeyLines([]byte(`# comment
+[mysql]
+host = "a"
+"pool".max_open_conns = 5
+
+[[items]]
+name = "x"
+`))
+	want := map[string]int{"mysql": 2, "mysql.host": 3, "mysql.pool.max_open_conns": 4, "items": 6, "items.name": 7}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines = %v, want %v", lines, want)
+	}
+}
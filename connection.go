@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// 主库连接检查默认值，可通过 MYSQL_PING_INTERVAL / MYSQL_RETRY_MAX_INTERVAL（秒）调整
+const (
+	defaultPingInterval     = 15
+	defaultRetryMaxInterval = 30
+)
+
+// 连接状态
+const (
+	connConnecting  = "connecting"  // 启动后尚未连接成功
+	connConnected   = "connected"   // 最近一次检查成功
+	connUnavailable = "unavailable" // 连接断开，正在后台重连
+)
+
+// offlineTools 不需要主库连接的工具，数据库不可用时照常执行
+var offlineTools = map[string]bool{
+	"read_webpage_with_browser": true,
+	"concurrent_request_runner": true,
+	"list_saved_queries":        true,
+	"query_history":             true,
+	"replication_status":        true,
+	"health_check":              true,
+	"connection_status":         true,
+}
+
+// replicaRoutes 可以路由到从库的工具，值为 route 为空或 auto 时是否优先使用从库（与工具中 readDB 的参数一致）
+var replicaRoutes = map[string]bool{
+	"list_databases":     true,
+	"list_tables":        true,
+	"describe_table":     true,
+	"execute_query":      true,
+	"next_page":          true,
+	"show_indexes":       true,
+	"get_table_stats":    true,
+	"show_foreign_keys":  true,
+	"search_schema":      true,
+	"show_create_table":  true,
+	"analyze_column":     true,
+	"show_triggers":      true,
+	"show_variables":     false,
+	"show_status":        false,
+	"show_processlist":   false,
+	"show_table_charset": true,
+	"schema_changelog":   true,
+	"export_query":       true,
+	"run_saved_query":    true,
+	"replay_query":       true,
+}
+
+// primaryState 主库连接状态，由后台检查和工具调用前的按需检查更新
+var primaryState struct {
+	sync.Mutex
+	status      string
+	target      string
+	lastError   string
+	failures    int // 连续失败次数
+	connectedAt time.Time
+	lastAttempt time.Time
+	nextRetry   time.Time
+	reconnects  int
+	wake        chan struct{}
+}
+
+// watchPrimary 在后台检查主库连接：失败后按指数退避重试，连接成功后每 MYSQL_PING_INTERVAL 秒检查一次
+func watchPrimary(target string) {
+	primaryState.Lock()
+	primaryState.status, primaryState.target = connConnecting, target
+	primaryState.wake = make(chan struct{}, 1)
+	wake := primaryState.wake
+	primaryState.Unlock()
+
+	go func() {
+		backoff := time.Second
+		for {
+			wait := time.Duration(getEnvInt("MYSQL_PING_INTERVAL", defaultPingInterval)) * time.Second
+			if err := pingPrimary(); err != nil {
+				wait = backoff
+				backoff *= 2
+				if max := time.Duration(getEnvInt("MYSQL_RETRY_MAX_INTERVAL", defaultRetryMaxInterval)) * time.Second; backoff > max {
+					backoff = max
+				}
+			} else {
+				backoff = time.Second
+			}
+
+			primaryState.Lock()
+			primaryState.nextRetry = time.Now().Add(wait)
+			primaryState.Unlock()
+			select {
+			case <-time.After(wait):
+			case <-wake:
+			}
+		}
+	}()
+}
+
+// pingPrimary 检查一次主库连接并记录结果
+func pingPrimary() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := db.PingContext(ctx)
+
+	primaryState.Lock()
+	defer primaryState.Unlock()
+	primaryState.lastAttempt = time.Now()
+	if err != nil {
+		if primaryState.status != connUnavailable {
+			log.Printf("database %s unavailable: %v", primaryState.target, err)
+		}
+		primaryState.status, primaryState.lastError = connUnavailable, err.Error()
+		primaryState.failures++
+		return err
+	}
+	if primaryState.status != connConnected {
+		if !primaryState.connectedAt.IsZero() {
+			primaryState.reconnects++
+		}
+		log.Printf("database %s connected", primaryState.target)
+		primaryState.connectedAt = time.Now()
+	}
+	primaryState.status, primaryState.lastError, primaryState.failures = connConnected, "", 0
+	return nil
+}
+
+// primaryAvailable 返回后台检查得到的主库状态，不在调用路径上等待连接。
+// 不可用时唤醒后台重连立即重试（距上次尝试不足 1 秒时不唤醒，避免频繁调用打乱退避）
+func primaryAvailable() bool {
+	primaryState.Lock()
+	status, lastAttempt, wake := primaryState.status, primaryState.lastAttempt, primaryState.wake
+	primaryState.Unlock()
+	if status == connConnected {
+		return true
+	}
+	if time.Since(lastAttempt) >= time.Second {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	return false
+}
+
+// unavailableResult 数据库不可用时返回的错误
+func unavailableResult() *mcp.CallToolResult {
+	primaryState.Lock()
+	defer primaryState.Unlock()
+	msg := fmt.Sprintf("数据库不可用：无法连接 %s", primaryState.target)
+	if primaryState.lastError != "" {
+		msg += "（" + primaryState.lastError + "）"
+	}
+	msg += fmt.Sprintf("。正在后台重连，已连续失败 %d 次", primaryState.failures)
+	if !primaryState.nextRetry.IsZero() {
+		if wait := time.Until(primaryState.nextRetry).Round(time.Second); wait > 0 {
+			msg += fmt.Sprintf("，%s 后重试", wait)
+		}
+	}
+	return mcp.NewToolResultError(msg + "。可调用 connection_status 查看连接状态")
+}
+
+// availabilityHandler 主库不可用时直接返回错误，避免工具在连接超时上空等。
+// 这次调用会路由到从库且有健康的从库时照常执行
+func availabilityHandler(name string, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	if offlineTools[name] {
+		return handler
+	}
+	return func(request map[string]interface{}) (*mcp.CallToolResult, error) {
+		if !primaryAvailable() && !(routesToReplica(name, request) && anyReplicaHealthy()) {
+			return unavailableResult(), nil
+		}
+		return handler(request)
+	}
+}
+
+// routesToReplica 判断调用是否会在从库上执行：工具支持从库路由，route 没有指定主库，且不在事务会话中。
+// next_page 的路由和会话记录在令牌中
+func routesToReplica(name string, request map[string]interface{}) bool {
+	preferReplica, ok := replicaRoutes[name]
+	if !ok {
+		return false
+	}
+	route, _ := request["route"].(string)
+	sessionID, _ := request["session_id"].(string)
+	if name == "next_page" {
+		token, _ := request["token"].(string)
+		state, err := decodePageToken(token)
+		if err != nil {
+			return false
+		}
+		route, sessionID = state.Route, state.SessionID
+	}
+	if sessionID != "" {
+		return false
+	}
+	switch route {
+	case "", routeAuto:
+		return preferReplica
+	case routeReplica:
+		return true
+	}
+	return false
+}
+
+// anyReplicaHealthy 是否有健康的从库，只读工具可以在主库不可用时继续使用从库
+func anyReplicaHealthy() bool {
+	for _, r := range replicas.items {
+		r.mu.Lock()
+		healthy := r.healthy
+		r.mu.Unlock()
+		if healthy {
+			return true
+		}
+	}
+	return false
+}
+
+// connectionStatus 返回主库连接状态、重连情况、连接池统计以及 SSH 隧道状态
+func connectionStatus(request map[string]interface{}) (*mcp.CallToolResult, error) {
+	primaryState.Lock()
+	report := map[string]interface{}{
+		"status":     primaryState.status,
+		"target":     primaryState.target,
+		"reconnects": primaryState.reconnects,
+	}
+	if !primaryState.connectedAt.IsZero() && primaryState.status == connConnected {
+		report["connected_since"] = primaryState.connectedAt.Format(time.RFC3339)
+	}
+	if primaryState.status != connConnected {
+		report["consecutive_failures"] = primaryState.failures
+		report["last_error"] = primaryState.lastError
+		if !primaryState.nextRetry.IsZero() {
+			report["next_retry"] = primaryState.nextRetry.Format(time.RFC3339)
+		}
+	}
+	if !primaryState.lastAttempt.IsZero() {
+		report["last_check"] = primaryState.lastAttempt.Format(time.RFC3339)
+	}
+	primaryState.Unlock()
+
+	stats := db.Stats()
+	report["pool"] = map[string]interface{}{
+		"max_open":      stats.MaxOpenConnections,
+		"open":          stats.OpenConnections,
+		"in_use":        stats.InUse,
+		"idle":          stats.Idle,
+		"wait_count":    stats.WaitCount,
+		"wait_duration": stats.WaitDuration.String(),
+	}
+	if tunnel != nil {
+		report["ssh_tunnel"] = tunnel.status()
+	}
+	if len(replicas.items) > 0 {
+		report["replicas"] = replicaHealth()
+	}
+
+	jsonData, _ := json.MarshalIndent(report, "", "  ")
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
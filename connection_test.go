@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoutesToReplica(t *testing.T) {
+	token := encodePageToken(&pageState{Query: "SELECT 1", Mode: pageSkip, PageSize: 10})
+	sessionToken := encodePageToken(&pageState{Query: "SELECT 1", Mode: pageSkip, PageSize: 10, SessionID: "s_1"})
+	primaryToken := encodePageToken(&pageState{Query: "SELECT 1", Mode: pageSkip, PageSize: 10, Route: routePrimary})
+	tests := []struct {
+		tool    string
+		request map[string]interface{}
+		want    bool
+	}{
+		{"execute_query", map[string]interface{}{}, true},
+		{"execute_query", map[string]interface{}{"route": "auto"}, true},
+		{"execute_query", map[string]interface{}{"route": "primary"}, false},
+		{"execute_query", map[string]interface{}{"session_id": "s_1"}, false},
+		{"show_status", map[string]interface{}{}, false},
+		{"show_status", map[string]interface{}{"route": "replica"}, true},
+		{"next_page", map[string]interface{}{"token": token}, true},
+		{"next_page", map[string]interface{}{"token": sessionToken}, false},
+		{"next_page", map[string]interface{}{"token": primaryToken}, false},
+		{"next_page", map[string]interface{}{"token": "bogus"}, false},
+		{"execute_write", map[string]interface{}{}, false},
+		{"begin_session", map[string]interface{}{"route": "replica"}, false},
+		{"document_generator", map[string]interface{}{}, false},
+	}
+	for _, tt := range tests {
+		if got := routesToReplica(tt.tool, tt.request); got != tt.want {
+			t.Errorf("routesToReplica(%s, %v) = %v, want %v", tt.tool, tt.request, got, tt.want)
+		}
+	}
+}
+
+// 主库不可用时 primaryAvailable 只唤醒后台重连，不在调用路径上 ping（db 为 nil，ping 会 panic）
+func TestPrimaryAvailableDoesNotPing(t *testing.T) {
+	primaryState.Lock()
+	saved := primaryState.status
+	savedAttempt, savedWake := primaryState.lastAttempt, primaryState.wake
+	wake := make(chan struct{}, 1)
+	primaryState.status, primaryState.lastAttempt, primaryState.wake = connUnavailable, time.Now().Add(-time.Minute), wake
+	primaryState.Unlock()
+	defer func() {
+		primaryState.Lock()
+		primaryState.status, primaryState.lastAttempt, primaryState.wake = saved, savedAttempt, savedWake
+		primaryState.Unlock()
+	}()
+
+	if primaryAvailable() {
+		t.Fatal("primaryAvailable() = true while unavailable")
+	}
+	select {
+	case <-wake:
+	default:
+		t.Fatal("watcher was not woken")
+	}
+
+	// 刚检查过时不再唤醒
+	primaryState.Lock()
+	primaryState.lastAttempt = time.Now()
+	primaryState.Unlock()
+	primaryAvailable()
+	select {
+	case <-wake:
+		t.Error("watcher woken again within a second of the last attempt")
+	default:
+	}
+}
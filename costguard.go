@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 代价预算默认值，可通过 QUERY_MAX_EXAMINED_ROWS / QUERY_FULL_SCAN_MAX_ROWS / QUERY_FILESORT_MAX_ROWS 调整
+const (
+	defaultMaxExaminedRows = 10000000
+	defaultFullScanMaxRows = 1000000
+	defaultFilesortMaxRows = 1000000
+)
+
+// costGuardMode 执行前的 EXPLAIN 检查：off 不检查，warn 超出预算时在结果中提示，reject 直接拒绝
+func costGuardMode() string {
+	switch mode := strings.ToLower(getEnv("QUERY_COST_GUARD", "off")); mode {
+	case "warn", "reject":
+		return mode
+	}
+	return "off"
+}
+
+// planRow EXPLAIN 输出中与代价估算有关的字段
+type planRow struct {
+	id       string
+	table    string
+	access   string  // type 列：ALL、index、range、ref ...
+	rows     int64   // 预估扫描行数，NULL 时为 0
+	filtered float64 // 条件过滤后保留的百分比
+	extra    string
+}
+
+// explainQuery 对语句执行 EXPLAIN，按列名读取需要的字段
+func explainQuery(q queryer, query string, args []interface{}) ([]planRow, error) {
+	rows, err := q.QueryContext(context.Background(), "EXPLAIN "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for i, c := range columns {
+		index[strings.ToLower(c)] = i
+	}
+	if _, ok := index["rows"]; !ok {
+		return nil, fmt.Errorf("EXPLAIN 输出中没有 rows 列")
+	}
+	field := func(values []sql.NullString, name string) string {
+		if i, ok := index[name]; ok {
+			return values[i].String
+		}
+		return ""
+	}
+
+	var plan []planRow
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := planRow{
+			id:       field(values, "id"),
+			table:    field(values, "table"),
+			access:   strings.ToUpper(field(values, "type")),
+			extra:    field(values, "extra"),
+			filtered: 100,
+		}
+		row.rows, _ = strconv.ParseInt(field(values, "rows"), 10, 64)
+		if f, err := strconv.ParseFloat(field(values, "filtered"), 64); err == nil && f > 0 {
+			row.filtered = f
+		}
+		plan = append(plan, row)
+	}
+	return plan, rows.Err()
+}
+
+// checkPlanCost 按预算检查执行计划，返回超出预算的说明。
+// 同一 SELECT（相同 id）中的表按嵌套循环估算：每张表的扫描行数乘以前面各表过滤后的行数
+func checkPlanCost(plan []planRow) []string {
+	maxExamined := int64(getEnvInt("QUERY_MAX_EXAMINED_ROWS", defaultMaxExaminedRows))
+	fullScanMax := int64(getEnvInt("QUERY_FULL_SCAN_MAX_ROWS", defaultFullScanMaxRows))
+	filesortMax := int64(getEnvInt("QUERY_FILESORT_MAX_ROWS", defaultFilesortMaxRows))
+
+	var problems []string
+	var examined float64
+	var worst string
+	var worstRows float64
+	fanout := map[string]float64{}
+	for _, row := range plan {
+		f, ok := fanout[row.id]
+		if !ok {
+			f = 1
+		}
+		scanned := f * float64(row.rows)
+		examined += scanned
+		if scanned > worstRows {
+			worst, worstRows = row.table, scanned
+		}
+		fanout[row.id] = f * float64(row.rows) * row.filtered / 100
+
+		if row.access == "ALL" && row.rows > fullScanMax {
+			problems = append(problems, fmt.Sprintf("表 %s 全表扫描约 %d 行，超过 QUERY_FULL_SCAN_MAX_ROWS=%d", row.table, row.rows, fullScanMax))
+		}
+	}
+
+	// filesort 出现在排序阶段的第一张表上，排序的是该 SELECT 连接后的全部结果
+	for _, row := range plan {
+		if !strings.Contains(row.extra, "Using filesort") {
+			continue
+		}
+		if sorted := fanout[row.id]; sorted > float64(filesortMax) {
+			problems = append(problems, fmt.Sprintf("表 %s 需要对约 %.0f 行做 filesort，超过 QUERY_FILESORT_MAX_ROWS=%d", row.table, sorted, filesortMax))
+		}
+	}
+
+	if examined > float64(maxExamined) {
+		problems = append(problems, fmt.Sprintf("预估共扫描约 %.0f 行，超过 QUERY_MAX_EXAMINED_ROWS=%d，其中表 %s 约 %.0f 行", examined, maxExamined, worst, worstRows))
+	}
+	return problems
+}
+
+// guardQueryCost 执行前检查查询代价，reject 模式下超出预算时返回错误，warn 模式下返回提示。
+// 只检查 SELECT；EXPLAIN 本身失败时不拦截，交给实际执行报错
+func guardQueryCost(q queryer, query string, args []interface{}) ([]string, error) {
+	mode := costGuardMode()
+	if mode == "off" || firstKeyword(tokenizeSQL(query)) != "SELECT" {
+		return nil, nil
+	}
+	plan, err := explainQuery(q, query, args)
+	if err != nil {
+		return nil, nil
+	}
+	problems := checkPlanCost(plan)
+	if len(problems) == 0 {
+		return nil, nil
+	}
+	if mode == "reject" {
+		return nil, fmt.Errorf("查询预估代价超出限制，已拒绝执行：%s。请增加索引条件或缩小范围", strings.Join(problems, "；"))
+	}
+	return problems, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCostGuardMode(t *testing.T) {
+	for value, want := range map[string]string{"": "off", "WARN": "warn", "reject": "reject", "block": "off"} {
+		t.Setenv("QUERY_COST_GUARD", value)
+		if got := costGuardMode(); got != want {
+			t.Errorf("costGuardMode(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+// 同一 SELECT 中的表按嵌套循环累乘：后面的表按前面各表过滤后的行数重复扫描
+func TestCheckPlanCost(t *testing.T) {
+	t.Setenv("QUERY_MAX_EXAMINED_ROWS", "100000")
+	t.Setenv("QUERY_FULL_SCAN_MAX_ROWS", "5000")
+	t.Setenv("QUERY_FILESORT_MAX_ROWS", "1000")
+
+	tests := []struct {
+		name string
+		plan []planRow
+		want []string
+	}{
+		{"index lookup", []planRow{{id: "1", table: "o", access: "REF", rows: 10, filtered: 100}}, nil},
+		{"full scan", []planRow{{id: "1", table: "o", access: "ALL", rows: 8000, filtered: 100}}, []string{
+			"表 o 全表扫描约 8000 行，超过 QUERY_FULL_SCAN_MAX_ROWS=5000",
+		}},
+		// o 过滤后剩 400 行，每行在 i 中扫描 300 行：共 4000 + 400*300 行
+		{"nested loop", []planRow{
+			{id: "1", table: "o", access: "RANGE", rows: 4000, filtered: 10},
+			{id: "1", table: "i", access: "REF", rows: 300, filtered: 100},
+		}, []string{
+			"预估共扫描约 124000 行，超过 QUERY_MAX_EXAMINED_ROWS=100000，其中表 i 约 120000 行",
+		}},
+		// 不同 id 的子查询各自从 1 开始计算
+		{"separate selects", []planRow{
+			{id: "1", table: "o", access: "RANGE", rows: 4000, filtered: 10},
+			{id: "2", table: "i", access: "REF", rows: 300, filtered: 100},
+		}, nil},
+		// 排序的是连接后的结果：2000 * 50% * 1，恰好等于上限不算超出
+		{"filesort within budget", []planRow{
+			{id: "1", table: "o", access: "RANGE", rows: 2000, filtered: 50, extra: "Using where; Using filesort"},
+			{id: "1", table: "i", access: "EQ_REF", rows: 1, filtered: 100},
+		}, nil},
+		{"filesort over budget", []planRow{
+			{id: "1", table: "o", access: "RANGE", rows: 3000, filtered: 50, extra: "Using filesort"},
+		}, []string{
+			"表 o 需要对约 1500 行做 filesort，超过 QUERY_FILESORT_MAX_ROWS=1000",
+		}},
+	}
+	for _, tt := range tests {
+		if got := checkPlanCost(tt.plan); (len(got) > 0 || len(tt.want) > 0) && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: problems = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// 关闭时和非 SELECT 语句不执行 EXPLAIN
+func TestGuardQueryCostSkips(t *testing.T) {
+	for mode, query := range map[string]string{"off": "SELECT * FROM t", "reject": "SHOW TABLES"} {
+		t.Setenv("QUERY_COST_GUARD", mode)
+		if warnings, err := guardQueryCost(nil, query, nil); warnings != nil || err != nil {
+			t.Errorf("%s %q: warnings = %v, err = %v", mode, query, warnings, err)
+		}
+	}
+}
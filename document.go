@@ -0,0 +1,549 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// docBlockKind 文档内容块类型
+type docBlockKind int
+
+const (
+	blockParagraph docBlockKind = iota // 普通段落
+	blockLabel                         // 加粗标签，如“数据来源：”
+	blockList                          // 无序列表
+	blockCode                          // 代码块
+	blockTable                         // 表格
+	blockRule                          // 分隔线
+)
+
+// docBlock 与输出格式无关的内容块
+type docBlock struct {
+	kind   docBlockKind
+	text   string     // 段落 / 标签 / 代码内容
+	lang   string     // 代码语言
+	items  []string   // 列表项
+	header []string   // 表头
+	rows   [][]string // 表格数据
+}
+
+// docSection 文档章节，level 对应标题层级（2 = 二级标题）
+type docSection struct {
+	level  int
+	title  string
+	blocks []docBlock
+}
+
+// docMeta 文档头部的元信息
+type docMeta struct {
+	label string
+	value string
+}
+
+// document 与输出格式无关的文档模型，由各渲染器输出为具体格式
+type document struct {
+	title    string
+	meta     []docMeta
+	sections []*docSection
+}
+
+func (d *document) addSection(level int, title string) *docSection {
+	sec := &docSection{level: level, title: title}
+	d.sections = append(d.sections, sec)
+	return sec
+}
+
+func (s *docSection) paragraph(text string) *docSection {
+	s.blocks = append(s.blocks, docBlock{kind: blockParagraph, text: text})
+	return s
+}
+
+func (s *docSection) label(text string) *docSection {
+	s.blocks = append(s.blocks, docBlock{kind: blockLabel, text: text})
+	return s
+}
+
+func (s *docSection) list(items ...string) *docSection {
+	s.blocks = append(s.blocks, docBlock{kind: blockList, items: items})
+	return s
+}
+
+func (s *docSection) code(lang, text string) *docSection {
+	s.blocks = append(s.blocks, docBlock{kind: blockCode, lang: lang, text: text})
+	return s
+}
+
+func (s *docSection) table(header []string, rows [][]string) *docSection {
+	s.blocks = append(s.blocks, docBlock{kind: blockTable, header: header, rows: rows})
+	return s
+}
+
+func (s *docSection) rule() *docSection {
+	s.blocks = append(s.blocks, docBlock{kind: blockRule})
+	return s
+}
+
+// docFormats 支持的输出格式及对应的文件扩展名
+var docFormats = map[string]string{
+	"markdown":   ".md",
+	"html":       ".html",
+	"asciidoc":   ".adoc",
+	"confluence": ".xml",
+}
+
+// renderDocument 按指定格式渲染文档
+func renderDocument(doc *document, format string) (string, error) {
+	switch format {
+	case "", "markdown", "md":
+		return renderMarkdown(doc), nil
+	case "html":
+		return renderHTML(doc), nil
+	case "asciidoc", "adoc":
+		return renderAsciiDoc(doc), nil
+	case "confluence":
+		return renderConfluence(doc), nil
+	default:
+		return "", fmt.Errorf("不支持的输出格式: %s（可选 markdown / html / asciidoc / confluence）", format)
+	}
+}
+
+// writeDocumentFile 将文档写入 DOC_OUTPUT_DIR 下的文件，返回最终路径。文件已存在且 overwrite 为 false 时拒绝写入
+func writeDocumentFile(name, format, content string, overwrite bool) (string, error) {
+	outputDir := getEnv("DOC_OUTPUT_DIR", "")
+	if outputDir == "" {
+		return "", fmt.Errorf("未配置 DOC_OUTPUT_DIR，无法写入文件")
+	}
+
+	if filepath.Ext(name) == "" {
+		name += docFormats[normalizeDocFormat(format)]
+	}
+	path, err := resolveUnderDir(outputDir, name)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("创建目录失败: %v", err)
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return "", fmt.Errorf("文件已存在: %s，需要覆盖时传入 overwrite=true", name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("写入文件失败: %v", err)
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return "", fmt.Errorf("写入文件失败: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("写入文件失败: %v", err)
+	}
+	return path, nil
+}
+
+// resolveUnderDir 将相对路径解析到 baseDir 下，拒绝越出 baseDir 的路径
+func resolveUnderDir(baseDir, name string) (string, error) {
+	base, err := filepath.Abs(baseDir)
+	if err != nil {
+		return "", err
+	}
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("文件名必须是相对路径: %s", name)
+	}
+	path := filepath.Join(base, name)
+	if path != base && !strings.HasPrefix(path, base+string(filepath.Separator)) {
+		return "", fmt.Errorf("文件路径超出输出目录: %s", name)
+	}
+	return path, nil
+}
+
+func normalizeDocFormat(format string) string {
+	switch format {
+	case "", "md":
+		return "markdown"
+	case "adoc":
+		return "asciidoc"
+	}
+	return format
+}
+
+// ---------- Markdown ----------
+
+func renderMarkdown(doc *document) string {
+	var md strings.Builder
+
+	md.WriteString(fmt.Sprintf("# %s\n\n", doc.title))
+	if len(doc.meta) > 0 {
+		for _, m := range doc.meta {
+			md.WriteString(fmt.Sprintf("**%s：** %s\n", m.label, m.value))
+		}
+		md.WriteString("\n---\n\n")
+	}
+
+	for _, sec := range doc.sections {
+		md.WriteString(fmt.Sprintf("%s %s\n\n", strings.Repeat("#", sec.level), sec.title))
+		for _, b := range sec.blocks {
+			switch b.kind {
+			case blockParagraph:
+				md.WriteString(b.text + "\n\n")
+			case blockLabel:
+				md.WriteString(fmt.Sprintf("**%s**\n\n", b.text))
+			case blockList:
+				for _, item := range b.items {
+					md.WriteString(fmt.Sprintf("- %s\n", item))
+				}
+				md.WriteString("\n")
+			case blockCode:
+				md.WriteString(fmt.Sprintf("```%s\n%s\n```\n\n", b.lang, strings.TrimRight(b.text, "\n")))
+			case blockTable:
+				md.WriteString(markdownTable(b.header, b.rows))
+				md.WriteString("\n")
+			case blockRule:
+				md.WriteString("---\n\n")
+			}
+		}
+	}
+
+	return strings.TrimRight(md.String(), "\n") + "\n"
+}
+
+func markdownTable(header []string, rows [][]string) string {
+	escape := func(s string) string {
+		s = strings.ReplaceAll(s, "|", "\\|")
+		return strings.ReplaceAll(s, "\n", "<br>")
+	}
+
+	var sb strings.Builder
+	cells := make([]string, len(header))
+	for i, h := range header {
+		cells[i] = escape(h)
+	}
+	sb.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	sb.WriteString("|" + strings.Repeat(" --- |", len(header)) + "\n")
+	for _, row := range rows {
+		cells := make([]string, len(header))
+		for i := range header {
+			if i < len(row) {
+				cells[i] = escape(row[i])
+			}
+		}
+		sb.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+	return sb.String()
+}
+
+// ---------- HTML ----------
+
+const htmlStyle = `body{font-family:-apple-system,"Segoe UI","PingFang SC","Microsoft YaHei",sans-serif;max-width:960px;margin:0 auto;padding:24px;line-height:1.6;color:#24292f}
+nav.toc{border:1px solid #d0d7de;border-radius:6px;padding:8px 16px;margin-bottom:24px;background:#f6f8fa}
+nav.toc ul{list-style:none;padding-left:16px;margin:4px 0}
+table{border-collapse:collapse;margin:12px 0}
+th,td{border:1px solid #d0d7de;padding:6px 12px;text-align:left}
+th{background:#f6f8fa}
+code{background:#f6f8fa;padding:2px 4px;border-radius:4px}
+pre{background:#f6f8fa;padding:12px;border-radius:6px;overflow:auto}
+pre code{background:none;padding:0}
+.sql-kw{color:#cf222e;font-weight:bold}
+.sql-str{color:#0a3069}
+.sql-num{color:#0550ae}
+.sql-com{color:#6e7781;font-style:italic}
+.sql-id{color:#8250df}`
+
+func renderHTML(doc *document) string {
+	var sb strings.Builder
+
+	sb.WriteString("<!DOCTYPE html>\n<html lang=\"zh-CN\">\n<head>\n<meta charset=\"utf-8\">\n")
+	sb.WriteString(fmt.Sprintf("<title>%s</title>\n", html.EscapeString(doc.title)))
+	sb.WriteString("<style>\n" + htmlStyle + "\n</style>\n</head>\n<body>\n")
+	sb.WriteString(fmt.Sprintf("<h1>%s</h1>\n", html.EscapeString(doc.title)))
+
+	if len(doc.meta) > 0 {
+		sb.WriteString("<p>\n")
+		for i, m := range doc.meta {
+			if i > 0 {
+				sb.WriteString("<br>\n")
+			}
+			sb.WriteString(fmt.Sprintf("<strong>%s：</strong> %s", html.EscapeString(m.label), html.EscapeString(m.value)))
+		}
+		sb.WriteString("\n</p>\n<hr>\n")
+	}
+
+	// 目录
+	if len(doc.sections) > 0 {
+		sb.WriteString("<nav class=\"toc\">\n<strong>目录</strong>\n<ul>\n")
+		for i, sec := range doc.sections {
+			indent := (sec.level - 2) * 16
+			if indent < 0 {
+				indent = 0
+			}
+			sb.WriteString(fmt.Sprintf("<li style=\"margin-left:%dpx\"><a href=\"#sec-%d\">%s</a></li>\n",
+				indent, i+1, htmlInline(sec.title)))
+		}
+		sb.WriteString("</ul>\n</nav>\n")
+	}
+
+	for i, sec := range doc.sections {
+		level := sec.level
+		if level > 6 {
+			level = 6
+		}
+		sb.WriteString(fmt.Sprintf("<h%d id=\"sec-%d\">%s</h%d>\n", level, i+1, htmlInline(sec.title), level))
+		for _, b := range sec.blocks {
+			switch b.kind {
+			case blockParagraph:
+				sb.WriteString(fmt.Sprintf("<p>%s</p>\n", htmlInline(b.text)))
+			case blockLabel:
+				sb.WriteString(fmt.Sprintf("<p><strong>%s</strong></p>\n", htmlInline(b.text)))
+			case blockList:
+				sb.WriteString("<ul>\n")
+				for _, item := range b.items {
+					sb.WriteString(fmt.Sprintf("<li>%s</li>\n", htmlInline(item)))
+				}
+				sb.WriteString("</ul>\n")
+			case blockCode:
+				code := html.EscapeString(b.text)
+				if strings.EqualFold(b.lang, "sql") {
+					code = highlightSQL(b.text)
+				}
+				sb.WriteString(fmt.Sprintf("<pre><code class=\"language-%s\">%s</code></pre>\n", html.EscapeString(b.lang), code))
+			case blockTable:
+				sb.WriteString("<table>\n<thead><tr>")
+				for _, h := range b.header {
+					sb.WriteString(fmt.Sprintf("<th>%s</th>", htmlInline(h)))
+				}
+				sb.WriteString("</tr></thead>\n<tbody>\n")
+				for _, row := range b.rows {
+					sb.WriteString("<tr>")
+					for i := range b.header {
+						cell := ""
+						if i < len(row) {
+							cell = row[i]
+						}
+						sb.WriteString(fmt.Sprintf("<td>%s</td>", htmlInline(cell)))
+					}
+					sb.WriteString("</tr>\n")
+				}
+				sb.WriteString("</tbody>\n</table>\n")
+			case blockRule:
+				sb.WriteString("<hr>\n")
+			}
+		}
+	}
+
+	sb.WriteString("</body>\n</html>\n")
+	return sb.String()
+}
+
+var inlineCodePattern = regexp.MustCompile("`([^`]+)`")
+
+// htmlInline 转义文本并将 `code` 转为 <code> 标签
+func htmlInline(text string) string {
+	parts := inlineCodePattern.FindAllStringSubmatchIndex(text, -1)
+	if len(parts) == 0 {
+		return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, p := range parts {
+		sb.WriteString(html.EscapeString(text[last:p[0]]))
+		sb.WriteString("<code>" + html.EscapeString(text[p[2]:p[3]]) + "</code>")
+		last = p[1]
+	}
+	sb.WriteString(html.EscapeString(text[last:]))
+	return strings.ReplaceAll(sb.String(), "\n", "<br>")
+}
+
+var sqlKeywords = map[string]bool{
+	"ADD": true, "ALTER": true, "AND": true, "AS": true, "ASC": true, "AUTO_INCREMENT": true,
+	"BETWEEN": true, "BIGINT": true, "BY": true, "CASCADE": true, "CHARACTER": true, "CHARSET": true,
+	"CHAR": true, "COLLATE": true, "COMMENT": true, "CONSTRAINT": true, "CREATE": true, "CURRENT_TIMESTAMP": true,
+	"DATE": true, "DATETIME": true, "DECIMAL": true, "DEFAULT": true, "DELETE": true, "DESC": true,
+	"DISTINCT": true, "DOUBLE": true, "DROP": true, "ENGINE": true, "ENUM": true, "EXISTS": true,
+	"FLOAT": true, "FOREIGN": true, "FROM": true, "GROUP": true, "HAVING": true, "IF": true, "IN": true,
+	"INDEX": true, "INNER": true, "INSERT": true, "INT": true, "INTEGER": true, "INTO": true, "IS": true,
+	"JOIN": true, "JSON": true, "KEY": true, "LEFT": true, "LIKE": true, "LIMIT": true, "LONGTEXT": true,
+	"MEDIUMTEXT": true, "NOT": true, "NULL": true, "ON": true, "OR": true, "ORDER": true, "PRIMARY": true,
+	"REFERENCES": true, "RIGHT": true, "ROW_FORMAT": true, "SELECT": true, "SET": true, "SMALLINT": true,
+	"TABLE": true, "TEXT": true, "TIMESTAMP": true, "TINYINT": true, "UNIQUE": true, "UNSIGNED": true,
+	"UPDATE": true, "USING": true, "VALUES": true, "VARCHAR": true, "WHERE": true,
+}
+
+var sqlTokenPattern = regexp.MustCompile("(?s)(--[^\n]*|#[^\n]*|/\\*.*?\\*/)|('(?:[^'\\\\]|\\\\.|'')*'|\"(?:[^\"\\\\]|\\\\.)*\")|(`[^`]*`)|(\\b\\d+(?:\\.\\d+)?\\b)|([A-Za-z_][A-Za-z0-9_]*)")
+
+// highlightSQL 对 SQL 做简单的语法高亮，输出已转义的 HTML
+func highlightSQL(src string) string {
+	var sb strings.Builder
+	last := 0
+	for _, m := range sqlTokenPattern.FindAllStringSubmatchIndex(src, -1) {
+		sb.WriteString(html.EscapeString(src[last:m[0]]))
+		token := html.EscapeString(src[m[0]:m[1]])
+		switch {
+		case m[2] >= 0:
+			sb.WriteString(`<span class="sql-com">` + token + `</span>`)
+		case m[4] >= 0:
+			sb.WriteString(`<span class="sql-str">` + token + `</span>`)
+		case m[6] >= 0:
+			sb.WriteString(`<span class="sql-id">` + token + `</span>`)
+		case m[8] >= 0:
+			sb.WriteString(`<span class="sql-num">` + token + `</span>`)
+		case sqlKeywords[strings.ToUpper(src[m[0]:m[1]])]:
+			sb.WriteString(`<span class="sql-kw">` + token + `</span>`)
+		default:
+			sb.WriteString(token)
+		}
+		last = m[1]
+	}
+	sb.WriteString(html.EscapeString(src[last:]))
+	return sb.String()
+}
+
+// ---------- AsciiDoc ----------
+
+func renderAsciiDoc(doc *document) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("= %s\n:toc:\n:toc-title: 目录\n:source-highlighter: rouge\n\n", doc.title))
+	if len(doc.meta) > 0 {
+		lines := make([]string, len(doc.meta))
+		for i, m := range doc.meta {
+			lines[i] = fmt.Sprintf("*%s：* %s", m.label, m.value)
+		}
+		sb.WriteString(strings.Join(lines, " +\n") + "\n\n'''\n\n")
+	}
+
+	for _, sec := range doc.sections {
+		sb.WriteString(fmt.Sprintf("%s %s\n\n", strings.Repeat("=", sec.level), sec.title))
+		for _, b := range sec.blocks {
+			switch b.kind {
+			case blockParagraph:
+				sb.WriteString(strings.ReplaceAll(b.text, "\n", " +\n") + "\n\n")
+			case blockLabel:
+				sb.WriteString(fmt.Sprintf("*%s*\n\n", b.text))
+			case blockList:
+				for _, item := range b.items {
+					sb.WriteString(fmt.Sprintf("* %s\n", item))
+				}
+				sb.WriteString("\n")
+			case blockCode:
+				sb.WriteString(fmt.Sprintf("[source,%s]\n----\n%s\n----\n\n", b.lang, strings.TrimRight(b.text, "\n")))
+			case blockTable:
+				sb.WriteString(fmt.Sprintf("[cols=\"%d*\",options=\"header\"]\n|===\n", len(b.header)))
+				for _, h := range b.header {
+					sb.WriteString("|" + asciiDocCell(h) + " ")
+				}
+				sb.WriteString("\n\n")
+				for _, row := range b.rows {
+					for i := range b.header {
+						cell := ""
+						if i < len(row) {
+							cell = row[i]
+						}
+						sb.WriteString("|" + asciiDocCell(cell) + "\n")
+					}
+					sb.WriteString("\n")
+				}
+				sb.WriteString("|===\n\n")
+			case blockRule:
+				sb.WriteString("'''\n\n")
+			}
+		}
+	}
+
+	return strings.TrimRight(sb.String(), "\n") + "\n"
+}
+
+func asciiDocCell(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "|", "\\|"), "\n", " +\n")
+}
+
+// ---------- Confluence storage format ----------
+
+func renderConfluence(doc *document) string {
+	var sb strings.Builder
+
+	// 存储格式本身不包含页面标题，标题由页面属性承载
+	sb.WriteString(`<ac:structured-macro ac:name="toc"><ac:parameter ac:name="maxLevel">3</ac:parameter></ac:structured-macro>` + "\n")
+
+	if len(doc.meta) > 0 {
+		sb.WriteString("<p>")
+		for i, m := range doc.meta {
+			if i > 0 {
+				sb.WriteString("<br />")
+			}
+			sb.WriteString(fmt.Sprintf("<strong>%s：</strong> %s", html.EscapeString(m.label), html.EscapeString(m.value)))
+		}
+		sb.WriteString("</p>\n<hr />\n")
+	}
+
+	for _, sec := range doc.sections {
+		level := sec.level - 1 // Confluence 页面标题即 h1，章节整体上提一级
+		if level < 1 {
+			level = 1
+		}
+		if level > 6 {
+			level = 6
+		}
+		sb.WriteString(fmt.Sprintf("<h%d>%s</h%d>\n", level, confluenceInline(sec.title), level))
+		for _, b := range sec.blocks {
+			switch b.kind {
+			case blockParagraph:
+				sb.WriteString(fmt.Sprintf("<p>%s</p>\n", confluenceInline(b.text)))
+			case blockLabel:
+				sb.WriteString(fmt.Sprintf("<p><strong>%s</strong></p>\n", confluenceInline(b.text)))
+			case blockList:
+				sb.WriteString("<ul>")
+				for _, item := range b.items {
+					sb.WriteString(fmt.Sprintf("<li>%s</li>", confluenceInline(item)))
+				}
+				sb.WriteString("</ul>\n")
+			case blockCode:
+				sb.WriteString(`<ac:structured-macro ac:name="code">`)
+				if b.lang != "" {
+					sb.WriteString(fmt.Sprintf(`<ac:parameter ac:name="language">%s</ac:parameter>`, html.EscapeString(b.lang)))
+				}
+				// CDATA 中不能出现 "]]>"，需要拆开
+				body := strings.ReplaceAll(b.text, "]]>", "]]]]><![CDATA[>")
+				sb.WriteString("<ac:plain-text-body><![CDATA[" + body + "]]></ac:plain-text-body></ac:structured-macro>\n")
+			case blockTable:
+				sb.WriteString("<table><tbody><tr>")
+				for _, h := range b.header {
+					sb.WriteString(fmt.Sprintf("<th>%s</th>", confluenceInline(h)))
+				}
+				sb.WriteString("</tr>")
+				for _, row := range b.rows {
+					sb.WriteString("<tr>")
+					for i := range b.header {
+						cell := ""
+						if i < len(row) {
+							cell = row[i]
+						}
+						sb.WriteString(fmt.Sprintf("<td>%s</td>", confluenceInline(cell)))
+					}
+					sb.WriteString("</tr>")
+				}
+				sb.WriteString("</tbody></table>\n")
+			case blockRule:
+				sb.WriteString("<hr />\n")
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+// confluenceInline 存储格式为 XHTML，换行需使用自闭合的 <br />
+func confluenceInline(text string) string {
+	return strings.ReplaceAll(htmlInline(text), "<br>", "<br />")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// schemaDocument 固定的表结构文档，覆盖标题转义、SQL 代码块和含特殊字符的表格
+func schemaDocument() *document {
+	doc := &document{title: "订单 <模块>", meta: []docMeta{{label: "模块名称", value: "orders"}}}
+	doc.addSection(2, "2. 数据库表结构")
+	doc.addSection(3, "2.1 `orders` — 订单表").
+		code("sql", "CREATE TABLE `orders` (\n  `id` bigint NOT NULL,\n  `note` varchar(20) DEFAULT 'a|b'\n)").
+		table([]string{"列名", "类型", "说明"}, [][]string{{"id", "bigint", "主键"}, {"note", "varchar(20)", "备注 a|b\n第二行"}}).
+		rule()
+	return doc
+}
+
+func TestRenderSchemaDocument(t *testing.T) {
+	tests := []struct {
+		format string
+		want   []string // 按出现顺序
+	}{
+		{"markdown", []string{
+			"# 订单 <模块>\n\n**模块名称：** orders\n\n---\n\n",
+			"## 2. 数据库表结构\n\n### 2.1 `orders` — 订单表\n\n",
+			"```sql\nCREATE TABLE `orders` (\n  `id` bigint NOT NULL,\n  `note` varchar(20) DEFAULT 'a|b'\n)\n```\n\n",
+			"| 列名 | 类型 | 说明 |\n| --- | --- | --- |\n| id | bigint | 主键 |\n| note | varchar(20) | 备注 a\\|b<br>第二行 |\n\n---\n",
+		}},
+		{"html", []string{
+			"<title>订单 &lt;模块&gt;</title>",
+			"<h1>订单 &lt;模块&gt;</h1>\n<p>\n<strong>模块名称：</strong> orders\n</p>\n<hr>\n",
+			`<li style="margin-left:0px"><a href="#sec-1">2. 数据库表结构</a></li>` + "\n" +
+				`<li style="margin-left:16px"><a href="#sec-2">2.1 <code>orders</code> — 订单表</a></li>`,
+			`<h3 id="sec-2">2.1 <code>orders</code> — 订单表</h3>`,
+			`<pre><code class="language-sql"><span class="sql-kw">CREATE</span> <span class="sql-kw">TABLE</span> <span class="sql-id">` + "`orders`</span>",
+			`<span class="sql-kw">DEFAULT</span> <span class="sql-str">&#39;a|b&#39;</span>`,
+			"<thead><tr><th>列名</th><th>类型</th><th>说明</th></tr></thead>",
+			"<tr><td>note</td><td>varchar(20)</td><td>备注 a|b<br>第二行</td></tr>\n</tbody>\n</table>\n<hr>\n</body>\n</html>\n",
+		}},
+	}
+	for _, tt := range tests {
+		got, err := renderDocument(schemaDocument(), tt.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rest := got
+		for _, want := range tt.want {
+			i := strings.Index(rest, want)
+			if i < 0 {
+				t.Errorf("%s: missing %q in\n%s", tt.format, want, got)
+				break
+			}
+			rest = rest[i+len(want):]
+		}
+	}
+}
+
+// 输出文件已存在时，只有 overwrite 为 true 才覆盖
+func TestWriteDocumentFileOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DOC_OUTPUT_DIR", dir)
+
+	path, err := writeDocumentFile("orders", "markdown", "v1", false)
+	if err != nil || path != filepath.Join(dir, "orders.md") {
+		t.Fatalf("path = %q, err = %v", path, err)
+	}
+	if _, err := writeDocumentFile("orders", "markdown", "v2", false); err == nil || !strings.Contains(err.Error(), "overwrite=true") {
+		t.Errorf("second write: err = %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "v1" {
+		t.Errorf("content after refused write = %q", data)
+	}
+	if _, err := writeDocumentFile("orders.md", "markdown", "v2", true); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "v2" {
+		t.Errorf("content after overwrite = %q", data)
+	}
+}
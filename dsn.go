@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// sslModes MYSQL_SSL_MODE 支持的取值，含义与 mysql 客户端的 --ssl-mode 相同
+var sslModes = []string{"disabled", "preferred", "required", "verify-ca", "verify-identity"}
+
+// tlsConfigName 注册到驱动的 TLS 配置名
+const tlsConfigName = "mysql-mcp"
+
+// unsafeDSNParams MYSQL_DSN_PARAMS 中不允许的驱动参数：multiStatements 会让按语句开头判断的只读检查失效，
+// allowAllFiles 允许 LOAD DATA LOCAL INFILE 读取任意文件，allowCleartextPasswords / allowOldPasswords 降低认证安全性，
+// tls 由 MYSQL_SSL_MODE 决定。parseTime 只能为 true
+var unsafeDSNParams = []string{"multiStatements", "allowAllFiles", "allowCleartextPasswords", "allowOldPasswords", "tls"}
+
+var tlsRegistered struct {
+	sync.Mutex
+	key string
+}
+
+// mysqlDSN 用环境变量中的用户名、密码、数据库、TLS 和额外参数构建连接 DSN，未设置的用户名、密码和数据库取自选项文件。
+// network 为 tcp 或 unix，addr 为 host:port 或 socket 路径，配置了 SSH 隧道时地址相对跳板机解析
+func mysqlDSN(network, addr string) (string, error) {
+	password, err := mysqlPassword()
+	if err != nil {
+		return "", err
+	}
+	cfg := mysql.NewConfig()
+	cfg.User = getEnv("MYSQL_USER", optionDefault("user", "root"))
+	cfg.Passwd = password
+	cfg.DBName = getEnv("MYSQL_DATABASE", optionDefault("database", ""))
+	cfg.Net, cfg.Addr = tunnelNetwork(network), addr
+	cfg.ParseTime = true
+	cfg.Params = map[string]string{"charset": "utf8mb4"}
+
+	tlsName, fallback, err := registerTLS()
+	if err != nil {
+		return "", err
+	}
+	cfg.TLSConfig = tlsName
+	cfg.AllowFallbackToPlaintext = fallback
+
+	// MYSQL_DSN_PARAMS 追加驱动参数，如 timeout=5s&readTimeout=30s&loc=Local&collation=utf8mb4_unicode_ci
+	dsn := cfg.FormatDSN()
+	if extra := strings.TrimLeft(getEnv("MYSQL_DSN_PARAMS", ""), "?&"); extra != "" {
+		if err := checkDSNParams(extra); err != nil {
+			return "", fmt.Errorf("MYSQL_DSN_PARAMS 无效: %v", err)
+		}
+		dsn += "&" + extra
+		if _, err := mysql.ParseDSN(dsn); err != nil {
+			return "", fmt.Errorf("MYSQL_DSN_PARAMS 无效: %v", err)
+		}
+	}
+	return dsn, nil
+}
+
+// errAccessDenied MySQL 认证失败的错误码
+const errAccessDenied = 1045
+
+// passwordConnector 每次建立连接时使用当前解析出的密码。密码来自文件或命令时，认证失败后重新读取一次再重试，
+// 密码轮换后后台重连可以恢复，无需重启服务
+type passwordConnector struct {
+	cfg *mysql.Config
+}
+
+// openMySQL 打开由 mysqlDSN 构建的连接池，密码在建立连接时解析
+func openMySQL(dsn string) (*sql.DB, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(&passwordConnector{cfg: cfg}), nil
+}
+
+func (c *passwordConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connect(ctx)
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) && myErr.Number == errAccessDenied && refreshPassword() {
+		log.Printf("database authentication failed, resolving the password again")
+		conn, err = c.connect(ctx)
+	}
+	return conn, err
+}
+
+func (c *passwordConnector) connect(ctx context.Context) (driver.Conn, error) {
+	password, err := mysqlPassword()
+	if err != nil {
+		return nil, err
+	}
+	cfg := c.cfg.Clone()
+	cfg.Passwd = password
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+func (c *passwordConnector) Driver() driver.Driver {
+	return mysql.MySQLDriver{}
+}
+
+// checkDSNParams 校验 MYSQL_DSN_PARAMS 能被驱动解析，且不含 unsafeDSNParams 中的参数
+func checkDSNParams(params string) error {
+	params = strings.TrimLeft(params, "?&")
+	if _, err := mysql.ParseDSN("/?" + params); err != nil {
+		return err
+	}
+	values, err := url.ParseQuery(params)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, name := range unsafeDSNParams {
+			if strings.EqualFold(key, name) {
+				return fmt.Errorf("不允许设置 %s", name)
+			}
+		}
+		if strings.EqualFold(key, "parseTime") {
+			for _, v := range values[key] {
+				if on, _ := strconv.ParseBool(v); !on {
+					return fmt.Errorf("parseTime 只能为 true")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// unsafeDSNConfig 返回完整 DSN 中启用的不安全参数，没有时为空
+func unsafeDSNConfig(cfg *mysql.Config) string {
+	switch {
+	case cfg.MultiStatements:
+		return "multiStatements"
+	case cfg.AllowAllFiles:
+		return "allowAllFiles"
+	case cfg.AllowCleartextPasswords:
+		return "allowCleartextPasswords"
+	case cfg.AllowOldPasswords:
+		return "allowOldPasswords"
+	}
+	return ""
+}
+
+// primaryAddr 主库地址：设置了 MYSQL_SOCKET 时使用 unix socket，否则为 MYSQL_HOST:MYSQL_PORT。
+// 都未设置时取选项文件中的 socket / host / port
+func primaryAddr() (network, addr string) {
+	if socket := getEnv("MYSQL_SOCKET", ""); socket != "" {
+		return "unix", socket
+	}
+	if getEnv("MYSQL_HOST", "") == "" {
+		if socket := optionDefault("socket", ""); socket != "" && optionDefault("host", "localhost") == "localhost" {
+			return "unix", socket
+		}
+	}
+	return "tcp", getEnv("MYSQL_HOST", optionDefault("host", "localhost")) + ":" + getEnv("MYSQL_PORT", optionDefault("port", "3306"))
+}
+
+// registerTLS 按 MYSQL_SSL_MODE / MYSQL_SSL_CA / MYSQL_SSL_CERT / MYSQL_SSL_KEY 注册 TLS 配置，
+// 返回 DSN 中的 tls 参数和是否允许服务器不支持 TLS 时退回明文
+func registerTLS() (name string, fallback bool, err error) {
+	mode := strings.ToLower(getEnv("MYSQL_SSL_MODE", "preferred"))
+	caFile := getEnv("MYSQL_SSL_CA", "")
+	certFile := getEnv("MYSQL_SSL_CERT", "")
+	keyFile := getEnv("MYSQL_SSL_KEY", "")
+
+	switch mode {
+	case "disabled":
+		return "false", false, nil
+	case "preferred":
+		if certFile == "" {
+			return "preferred", true, nil
+		}
+	case "required":
+		// 与 mysql 客户端一致：指定了 CA 时按 verify-ca 校验
+		if caFile != "" {
+			mode = "verify-ca"
+		}
+	case "verify-ca", "verify-identity":
+	default:
+		return "", false, fmt.Errorf("MYSQL_SSL_MODE 只能是 %s", strings.Join(sslModes, " / "))
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return "", false, fmt.Errorf("读取客户端证书失败: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	var roots *x509.CertPool
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return "", false, fmt.Errorf("读取 CA 证书失败: %v", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return "", false, fmt.Errorf("CA 证书 %s 中没有有效的 PEM 证书", caFile)
+		}
+	}
+
+	switch mode {
+	case "preferred", "required":
+		config.InsecureSkipVerify = true
+	case "verify-ca":
+		// 校验证书链但不校验主机名
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyCertChain(rawCerts, roots)
+		}
+	case "verify-identity":
+		// 主机名由驱动按连接地址填入 ServerName
+		config.RootCAs = roots
+	}
+
+	// 同一组设置只注册一次，主库和从库共用
+	key := strings.Join([]string{mode, caFile, certFile, keyFile}, "\x00")
+	tlsRegistered.Lock()
+	defer tlsRegistered.Unlock()
+	if tlsRegistered.key != key {
+		if err := mysql.RegisterTLSConfig(tlsConfigName, config); err != nil {
+			return "", false, err
+		}
+		tlsRegistered.key = key
+	}
+	return tlsConfigName, mode == "preferred", nil
+}
+
+// verifyCertChain 用 roots（为空时用系统根证书）校验服务器证书链
+func verifyCertChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("服务器没有提供证书")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+	opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(opts)
+	return err
+}
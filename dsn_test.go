@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestCheckDSNParams(t *testing.T) {
+	tests := []struct {
+		params string
+		ok     bool
+	}{
+		{"timeout=5s&readTimeout=30s&loc=Local", true},
+		{"?collation=utf8mb4_unicode_ci", true},
+		{"parseTime=true", true},
+		{"parseTime=false", false},
+		{"parseTime=0", false},
+		{"multiStatements=true", false},
+		{"timeout=5s&multistatements=1", false},
+		{"allowAllFiles=true", false},
+		{"allowCleartextPasswords=1", false},
+		{"allowOldPasswords=true", false},
+		{"tls=skip-verify", false},
+		{"timeout=abc", false},
+	}
+	for _, tt := range tests {
+		if err := checkDSNParams(tt.params); (err == nil) != tt.ok {
+			t.Errorf("checkDSNParams(%q) = %v, ok = %v", tt.params, err, tt.ok)
+		}
+	}
+}
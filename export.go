@@ -0,0 +1,575 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/parquet-go/parquet-go"
+	parquetgzip "github.com/parquet-go/parquet-go/compress/gzip"
+)
+
+// 导出默认上限，可通过 EXPORT_MAX_ROWS / EXPORT_MAX_BYTES 调整
+const (
+	defaultExportMaxRows  = 5000000
+	defaultExportMaxBytes = 2 << 30
+)
+
+// exportProgressInterval 导出过程中发送进度通知的最小间隔
+const exportProgressInterval = 2 * time.Second
+
+// parquetRowGroupRows Parquet 每个行组的行数，行组写出后才计入文件字节数
+const parquetRowGroupRows = 50000
+
+// exportFormats export_query 支持的文件格式
+var exportFormats = []string{"csv", "jsonl", "parquet"}
+
+var exportExts = map[string]string{
+	"csv":     ".csv",
+	"jsonl":   ".jsonl",
+	"parquet": ".parquet",
+}
+
+// exportRowWriter 逐行写出查询结果，raw 为驱动返回的原始值
+type exportRowWriter interface {
+	writeRow(raw []interface{}) error
+	close() error
+}
+
+// countingWriter 统计实际写入文件的字节数
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// exportLimit 读取导出上限：请求值不得超过环境变量配置的上限
+func exportLimit(request map[string]interface{}, param, envKey string, defaultValue int64) int64 {
+	limit := defaultValue
+	if n, err := strconv.ParseInt(getEnv(envKey, ""), 10, 64); err == nil && n > 0 {
+		limit = n
+	}
+	if v, ok := request[param].(float64); ok && v >= 1 && int64(v) < limit {
+		limit = int64(v)
+	}
+	return limit
+}
+
+// exportQuery 将只读查询的结果流式写入 EXPORT_DIR 下的文件，只返回摘要
+func exportQuery(request map[string]interface{}) (*mcp.CallToolResult, error) {
+	query, ok := request["query"].(string)
+	if !ok || query == "" {
+		return mcp.NewToolResultError("query 参数是必需的"), nil
+	}
+	if err := checkReadOnlyQuery(query); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := checkQueryAccess(query); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	format, _ := request["format"].(string)
+	if format == "" {
+		format = "csv"
+	}
+	if _, ok := exportExts[format]; !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("不支持的导出格式: %s（可选 %s）", format, strings.Join(exportFormats, " / "))), nil
+	}
+	useGzip, _ := request["gzip"].(bool)
+	binaryEncoding, _ := request["binary_encoding"].(string)
+
+	exportDir := getEnv("EXPORT_DIR", "")
+	if exportDir == "" {
+		return mcp.NewToolResultError("未配置 EXPORT_DIR，无法导出文件"), nil
+	}
+
+	maxRows := exportLimit(request, "max_rows", "EXPORT_MAX_ROWS", defaultExportMaxRows)
+	maxBytes := exportLimit(request, "max_bytes", "EXPORT_MAX_BYTES", defaultExportMaxBytes)
+
+	fileName, _ := request["file_name"].(string)
+	if fileName == "" {
+		fileName = "export_" + time.Now().Format("20060102_150405")
+	}
+	if filepath.Ext(fileName) == "" {
+		fileName += exportExts[format]
+	}
+	// Parquet 使用列压缩，不再整体 gzip
+	if useGzip && format != "parquet" && !strings.HasSuffix(fileName, ".gz") {
+		fileName += ".gz"
+	}
+
+	path, err := resolveUnderDir(exportDir, fileName)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if _, err := os.Stat(path); err == nil {
+		return mcp.NewToolResultError(fmt.Sprintf("文件已存在: %s", fileName)), nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("创建目录失败: %v", err)), nil
+	}
+
+	sqlText := trimStatement(query)
+	if tokens := tokenizeSQL(sqlText); firstKeyword(tokens) == "SELECT" && !hasTopLevelLimit(tokens) {
+		// 多取一行用于判断是否被行数上限截断
+		sqlText += fmt.Sprintf("\nLIMIT %d", maxRows+1)
+	}
+
+	pool, err := readDB(request, true)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	start := time.Now()
+	call := callOf(request)
+	summary, err := runExport(call, pool, sqlText, path, fileName, format, useGzip, binaryEncoding, maxRows, maxBytes)
+	entry := historyEntry{call: call, Time: start, Tool: "export_query", Query: trimStatement(query), DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		entry.Error = err.Error()
+		recordQuery(entry)
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	entry.Rows = summary["rows"].(int64)
+	recordQuery(entry)
+
+	jsonData, _ := json.MarshalIndent(summary, "", "  ")
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+// runExport 执行查询并写入临时文件，完成后重命名为目标文件；出错时删除临时文件
+func runExport(call *toolCall, pool *sql.DB, sqlText, path, fileName, format string, useGzip bool, binaryEncoding string, maxRows, maxBytes int64) (map[string]interface{}, error) {
+	start := time.Now()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("创建文件失败: %v", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(tmp, hash)}
+	var gz *gzip.Writer
+	var out *bufio.Writer
+	if useGzip && format != "parquet" {
+		gz = gzip.NewWriter(counter)
+		out = bufio.NewWriter(gz)
+	} else {
+		out = bufio.NewWriter(counter)
+	}
+	// 当前文件大小：已写出的字节加上缓冲区中的字节（gzip 时按已写出的压缩字节计算）
+	written := func() int64 {
+		if gz != nil {
+			return counter.n
+		}
+		return counter.n + int64(out.Buffered())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 与 execute_query 一样在带会话限制的连接上执行
+	conn, release, err := checkoutConn(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rows, err := conn.QueryContext(ctx, sqlText)
+	if err != nil {
+		return nil, fmt.Errorf("查询失败: %v%s", err, limitErrorHint(err))
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]string, len(columnTypes))
+	typeNames := make([]string, len(columnTypes))
+	for i, ct := range columnTypes {
+		columns[i] = ct.Name()
+		typeNames[i] = ct.DatabaseTypeName()
+	}
+
+	// 整列脱敏的值都是文本，按 VARCHAR 写入
+	rm, err := newResultMasker(sqlText, columns)
+	if err != nil {
+		return nil, err
+	}
+	writeTypes := append([]string(nil), typeNames...)
+	for i := range writeTypes {
+		if rm.masks(i) {
+			writeTypes[i] = "VARCHAR"
+		}
+	}
+
+	var writer exportRowWriter
+	switch format {
+	case "csv":
+		writer, err = newCSVExportWriter(out, columns, writeTypes, binaryEncoding)
+	case "jsonl":
+		writer = newJSONLExportWriter(out, columns, writeTypes, binaryEncoding)
+	case "parquet":
+		writer, err = newParquetExportWriter(out, columns, writeTypes, useGzip)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	progress := map[string]interface{}{"tool": "export_query", "file": fileName}
+	lastNotify := start
+	var count int64
+	truncatedBy := ""
+
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if count >= maxRows {
+			truncatedBy = "max_rows"
+			break
+		}
+		if written() >= maxBytes {
+			truncatedBy = "max_bytes"
+			break
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, err
+		}
+		rm.maskRaw(values, typeNames, binaryEncoding)
+		if err := writer.writeRow(values); err != nil {
+			return nil, fmt.Errorf("写入文件失败: %v", err)
+		}
+		count++
+
+		if time.Since(lastNotify) >= exportProgressInterval {
+			lastNotify = time.Now()
+			progress["rows"], progress["bytes"] = count, written()
+			reportExportProgress(call, progress, 0)
+		}
+	}
+	if truncatedBy == "" {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("查询失败: %v%s", err, limitErrorHint(err))
+		}
+	}
+	// 提前结束时取消查询，避免继续读取剩余结果
+	cancel()
+	rows.Close()
+
+	if err := writer.close(); err != nil {
+		return nil, fmt.Errorf("写入文件失败: %v", err)
+	}
+	if err := out.Flush(); err != nil {
+		return nil, fmt.Errorf("写入文件失败: %v", err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return nil, fmt.Errorf("写入文件失败: %v", err)
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("写入文件失败: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("写入文件失败: %v", err)
+	}
+	committed = true
+
+	summary := map[string]interface{}{
+		"path":       path,
+		"format":     format,
+		"gzip":       useGzip,
+		"columns":    columns,
+		"rows":       count,
+		"bytes":      counter.n,
+		"sha256":     hex.EncodeToString(hash.Sum(nil)),
+		"truncated":  truncatedBy != "",
+		"max_rows":   maxRows,
+		"max_bytes":  maxBytes,
+		"elapsed_ms": time.Since(start).Milliseconds(),
+	}
+	if truncatedBy != "" {
+		summary["truncated_by"] = truncatedBy
+	}
+
+	progress["rows"], progress["bytes"], progress["done"] = count, counter.n, true
+	reportExportProgress(call, progress, count)
+	return summary, nil
+}
+
+// reportExportProgress 调用方给出了 progressToken 时发送进度通知（progress 为已写入的行数，完成时 total 等于总行数），
+// 否则发送日志通知
+func reportExportProgress(call *toolCall, progress map[string]interface{}, total int64) {
+	rows := progress["rows"].(int64)
+	message := fmt.Sprintf("已写入 %d 行，%d 字节", rows, progress["bytes"])
+	if !sendProgressNotification(call, rows, total, message) {
+		sendLogNotification(call, mcp.LoggingLevelInfo, "export_query", progress)
+	}
+}
+
+// ---------- CSV / JSON Lines ----------
+
+type csvExportWriter struct {
+	w              *csv.Writer
+	typeNames      []string
+	binaryEncoding string
+	record         []string
+}
+
+// newCSVExportWriter 传入 *bufio.Writer 时 csv.Writer 直接使用它，缓冲区中的字节可以计入文件大小
+func newCSVExportWriter(out *bufio.Writer, columns, typeNames []string, binaryEncoding string) (*csvExportWriter, error) {
+	w := csv.NewWriter(out)
+	if err := w.Write(columns); err != nil {
+		return nil, err
+	}
+	return &csvExportWriter{w: w, typeNames: typeNames, binaryEncoding: binaryEncoding, record: make([]string, len(columns))}, nil
+}
+
+func (cw *csvExportWriter) writeRow(raw []interface{}) error {
+	for i, v := range raw {
+		cw.record[i] = cellText(convertValue(v, cw.typeNames[i], cw.binaryEncoding))
+	}
+	return cw.w.Write(cw.record)
+}
+
+func (cw *csvExportWriter) close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type jsonlExportWriter struct {
+	w              *bufio.Writer
+	columns        []string
+	typeNames      []string
+	binaryEncoding string
+	row            []interface{}
+}
+
+func newJSONLExportWriter(out *bufio.Writer, columns, typeNames []string, binaryEncoding string) *jsonlExportWriter {
+	return &jsonlExportWriter{w: out, columns: columns, typeNames: typeNames, binaryEncoding: binaryEncoding, row: make([]interface{}, len(columns))}
+}
+
+func (jw *jsonlExportWriter) writeRow(raw []interface{}) error {
+	for i, v := range raw {
+		jw.row[i] = convertValue(v, jw.typeNames[i], jw.binaryEncoding)
+	}
+	line, err := orderedJSONObject(jw.columns, jw.row)
+	if err != nil {
+		return err
+	}
+	jw.w.Write(line)
+	return jw.w.WriteByte('\n')
+}
+
+func (jw *jsonlExportWriter) close() error {
+	return jw.w.Flush()
+}
+
+// ---------- Parquet ----------
+
+// parquetKind 列写入 Parquet 时使用的值类型
+type parquetKind int
+
+const (
+	pqString parquetKind = iota
+	pqInt
+	pqUint
+	pqDouble
+	pqBytes
+	pqJSON
+	pqDate
+	pqTimestamp
+)
+
+// parquetColumnNode 按 MySQL 列类型选择 Parquet 类型，所有列均为 optional 以容纳 NULL
+func parquetColumnNode(typeName string) (parquet.Node, parquetKind) {
+	switch typeName {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR":
+		return parquet.Optional(parquet.Int(64)), pqInt
+	case "UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED INT", "UNSIGNED BIGINT", "BIT":
+		return parquet.Optional(parquet.Uint(64)), pqUint
+	case "FLOAT", "DOUBLE":
+		return parquet.Optional(parquet.Leaf(parquet.DoubleType)), pqDouble
+	case "JSON":
+		return parquet.Optional(parquet.JSON()), pqJSON
+	case "DATE":
+		return parquet.Optional(parquet.Date()), pqDate
+	case "DATETIME", "TIMESTAMP":
+		return parquet.Optional(parquet.Timestamp(parquet.Microsecond)), pqTimestamp
+	}
+	if isBinaryType(typeName) {
+		return parquet.Optional(parquet.Leaf(parquet.ByteArrayType)), pqBytes
+	}
+	// DECIMAL 与 execute_query 一致保持字符串，避免精度丢失
+	return parquet.Optional(parquet.String()), pqString
+}
+
+// orderedGroup 按结果集列顺序排列字段（parquet.Group 会按名称排序）
+type orderedGroup struct {
+	parquet.Group
+	fields []parquet.Field
+}
+
+func (g orderedGroup) Fields() []parquet.Field { return g.fields }
+
+type namedField struct {
+	parquet.Node
+	name string
+}
+
+func (f namedField) Name() string { return f.name }
+
+func (f namedField) Value(base reflect.Value) reflect.Value {
+	return base.MapIndex(reflect.ValueOf(f.name))
+}
+
+type parquetExportWriter struct {
+	w         *parquet.Writer
+	columns   []string
+	typeNames []string
+	kinds     []parquetKind
+	rows      []parquet.Row
+}
+
+func newParquetExportWriter(out io.Writer, columns, typeNames []string, useGzip bool) (*parquetExportWriter, error) {
+	group := parquet.Group{}
+	fields := make([]parquet.Field, len(columns))
+	kinds := make([]parquetKind, len(columns))
+	for i, col := range columns {
+		if _, dup := group[col]; dup {
+			return nil, fmt.Errorf("Parquet 要求列名唯一，请为重复的列 %s 指定别名", col)
+		}
+		node, kind := parquetColumnNode(typeNames[i])
+		group[col] = node
+		fields[i] = namedField{Node: node, name: col}
+		kinds[i] = kind
+	}
+
+	options := []parquet.WriterOption{
+		parquet.NewSchema("row", orderedGroup{Group: group, fields: fields}),
+		parquet.MaxRowsPerRowGroup(parquetRowGroupRows),
+	}
+	if useGzip {
+		options = append(options, parquet.Compression(&parquetgzip.Codec{}))
+	}
+
+	return &parquetExportWriter{
+		w:         parquet.NewWriter(out, options...),
+		columns:   columns,
+		typeNames: typeNames,
+		kinds:     kinds,
+		rows:      make([]parquet.Row, 1),
+	}, nil
+}
+
+func (pw *parquetExportWriter) writeRow(raw []interface{}) error {
+	row := pw.rows[0][:0]
+	for i, v := range raw {
+		value, err := parquetValue(v, pw.typeNames[i], pw.kinds[i])
+		if err != nil {
+			return fmt.Errorf("列 %s: %v", pw.columns[i], err)
+		}
+		definition := 1
+		if value.IsNull() {
+			definition = 0
+		}
+		row = append(row, value.Level(0, definition, i))
+	}
+	pw.rows[0] = row
+	_, err := pw.w.WriteRows(pw.rows)
+	return err
+}
+
+func (pw *parquetExportWriter) close() error {
+	return pw.w.Close()
+}
+
+// parquetValue 将驱动返回的值转为 Parquet 值，文本协议下的 []byte 与二进制协议下的具体类型都需要处理
+func parquetValue(raw interface{}, typeName string, kind parquetKind) (parquet.Value, error) {
+	if raw == nil {
+		return parquet.NullValue(), nil
+	}
+
+	b, isBytes := raw.([]byte)
+	switch kind {
+	case pqBytes:
+		if isBytes {
+			return parquet.ByteArrayValue(b), nil
+		}
+	case pqDate:
+		t, ok := raw.(time.Time)
+		if isBytes {
+			var err error
+			t, err = time.ParseInLocation("2006-01-02", string(b), time.UTC)
+			ok = err == nil
+		}
+		if ok {
+			y, m, d := t.Date()
+			return parquet.Int32Value(int32(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400)), nil
+		}
+	case pqTimestamp:
+		t, ok := raw.(time.Time)
+		if isBytes {
+			var err error
+			t, err = time.ParseInLocation("2006-01-02 15:04:05.999999", string(b), time.UTC)
+			ok = err == nil
+		}
+		if ok {
+			return parquet.Int64Value(t.UnixMicro()), nil
+		}
+	default:
+		switch v := convertValue(raw, typeName, "").(type) {
+		case int64:
+			if kind == pqInt || kind == pqUint {
+				return parquet.Int64Value(v), nil
+			}
+		case uint64:
+			if kind == pqInt || kind == pqUint {
+				return parquet.Int64Value(int64(v)), nil
+			}
+		case float64:
+			if kind == pqDouble {
+				return parquet.DoubleValue(v), nil
+			}
+		case float32:
+			if kind == pqDouble {
+				return parquet.DoubleValue(float64(v)), nil
+			}
+		case json.RawMessage:
+			return parquet.ByteArrayValue(v), nil
+		default:
+			if kind == pqString || kind == pqJSON {
+				return parquet.ByteArrayValue([]byte(cellText(v))), nil
+			}
+		}
+	}
+	return parquet.Value{}, fmt.Errorf("无法将 %s 值 %v 写入 Parquet", typeName, raw)
+}
@@ -2,12 +2,14 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -38,22 +40,32 @@ func listDatabases(request map[string]interface{}) (*mcp.CallToolResult, error)
 	pattern, _ := request["pattern"].(string)
 
 	query := "SHOW DATABASES"
+	var args []interface{}
 	if pattern != "" {
-		query = fmt.Sprintf("SHOW DATABASES LIKE '%s'", pattern)
+		query = "SELECT SCHEMA_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME LIKE ? ORDER BY SCHEMA_NAME"
+		args = append(args, pattern)
 	}
 
-	rows, err := db.Query(query)
+	pool, err := readDB(request, true)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	rows, err := pool.Query(query, args...)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v", err)), nil
 	}
 	defer rows.Close()
 
+	rules := loadAccessRules()
 	var databases []string
 	for rows.Next() {
 		var dbName string
 		if err := rows.Scan(&dbName); err != nil {
 			return mcp.NewToolResultError(err.Error()), nil
 		}
+		if !rules.databaseVisible(dbName) {
+			continue
+		}
 		databases = append(databases, dbName)
 	}
 
@@ -72,20 +84,17 @@ func listTables(request map[string]interface{}) (*mcp.CallToolResult, error) {
 		return mcp.NewToolResultError("database 参数是必需的"), nil
 	}
 
-	query := fmt.Sprintf("SHOW TABLES FROM `%s`", database)
-	rows, err := db.Query(query)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v", err)), nil
+	if err := checkDatabaseAccess(database); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
-	defer rows.Close()
 
-	var tables []string
-	for rows.Next() {
-		var tableName string
-		if err := rows.Scan(&tableName); err != nil {
-			return mcp.NewToolResultError(err.Error()), nil
-		}
-		tables = append(tables, tableName)
+	pool, err := readDB(request, true)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	tables, err := fetchTables(pool, database)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v", err)), nil
 	}
 
 	result, _ := json.MarshalIndent(map[string]interface{}{
@@ -108,30 +117,17 @@ func describeTable(request map[string]interface{}) (*mcp.CallToolResult, error)
 	if !ok || table == "" {
 		return mcp.NewToolResultError("table 参数是必需的"), nil
 	}
-
-	query := fmt.Sprintf("DESCRIBE `%s`.`%s`", database, table)
-	rows, err := db.Query(query)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v", err)), nil
+	if err := checkTableAccess(database, table); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
-	defer rows.Close()
 
-	type Column struct {
-		Field   string         `json:"field"`
-		Type    string         `json:"type"`
-		Null    string         `json:"null"`
-		Key     string         `json:"key"`
-		Default sql.NullString `json:"default"`
-		Extra   string         `json:"extra"`
+	pool, err := readDB(request, true)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
-
-	var columns []Column
-	for rows.Next() {
-		var col Column
-		if err := rows.Scan(&col.Field, &col.Type, &col.Null, &col.Key, &col.Default, &col.Extra); err != nil {
-			return mcp.NewToolResultError(err.Error()), nil
-		}
-		columns = append(columns, col)
+	columns, err := fetchColumns(pool, database, table)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v", err)), nil
 	}
 
 	result, _ := json.MarshalIndent(map[string]interface{}{
@@ -143,74 +139,50 @@ func describeTable(request map[string]interface{}) (*mcp.CallToolResult, error)
 	return mcp.NewToolResultText(string(result)), nil
 }
 
-// executeQuery 执行查询
+// executeQuery 执行查询，结果按页返回，后续页通过 next_page 读取
 func executeQuery(request map[string]interface{}) (*mcp.CallToolResult, error) {
 	query, ok := request["query"].(string)
 	if !ok || query == "" {
 		return mcp.NewToolResultError("query 参数是必需的"), nil
 	}
 
-	// 安全检查：只允许 SELECT 语句
-	trimmedQuery := strings.TrimSpace(strings.ToUpper(query))
-	if !strings.HasPrefix(trimmedQuery, "SELECT") && !strings.HasPrefix(trimmedQuery, "SHOW") && !strings.HasPrefix(trimmedQuery, "DESCRIBE") {
-		return mcp.NewToolResultError("只允许执行 SELECT、SHOW 和 DESCRIBE 查询"), nil
+	if err := checkReadOnlyQuery(query); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 
 	limit := 100
-	if l, ok := request["limit"].(float64); ok {
+	if l, ok := request["limit"].(float64); ok && l >= 1 {
 		limit = int(l)
 	}
 
-	// 添加 LIMIT 子句
-	if !strings.Contains(strings.ToUpper(query), "LIMIT") {
-		query = fmt.Sprintf("%s LIMIT %d", query, limit)
-	}
-
-	rows, err := db.Query(query)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v", err)), nil
-	}
-	defer rows.Close()
-
-	// 获取列名
-	columns, err := rows.Columns()
+	args, err := parseBindArgs(request["args"])
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
+	query = trimStatement(query)
+	if n := countPlaceholders(query); n != len(args) {
+		return mcp.NewToolResultError(fmt.Sprintf("参数个数不匹配：语句中有 %d 个 ? 占位符，args 提供了 %d 个", n, len(args))), nil
+	}
 
-	// 读取数据
-	var results []map[string]interface{}
-	for rows.Next() {
-		values := make([]interface{}, len(columns))
-		valuePtrs := make([]interface{}, len(columns))
-		for i := range values {
-			valuePtrs[i] = &values[i]
-		}
+	state := newPageState(query, limit)
+	state.Args = args
+	state.Format, _ = request["format"].(string)
+	state.BinaryEncoding, _ = request["binary_encoding"].(string)
+	state.tool = "execute_query"
+	state.call = callOf(request)
+	state.SessionID, _ = request["session_id"].(string)
+	state.Route, _ = request["route"].(string)
 
-		if err := rows.Scan(valuePtrs...); err != nil {
-			return mcp.NewToolResultError(err.Error()), nil
-		}
+	return runQueryPage(state)
+}
 
-		row := make(map[string]interface{})
-		for i, col := range columns {
-			val := values[i]
-			if b, ok := val.([]byte); ok {
-				row[col] = string(b)
-			} else {
-				row[col] = val
-			}
-		}
-		results = append(results, row)
+// checkReadOnlyQuery 安全检查：只允许 SELECT、SHOW 和 DESCRIBE
+func checkReadOnlyQuery(query string) error {
+	trimmedQuery := strings.TrimSpace(strings.ToUpper(query))
+	if !strings.HasPrefix(trimmedQuery, "SELECT") && !strings.HasPrefix(trimmedQuery, "SHOW") && !strings.HasPrefix(trimmedQuery, "DESCRIBE") {
+		return fmt.Errorf("只允许执行 SELECT、SHOW 和 DESCRIBE 查询")
 	}
-
-	result, _ := json.MarshalIndent(map[string]interface{}{
-		"query":   query,
-		"columns": columns,
-		"rows":    results,
-		"count":   len(results),
-	}, "", "  ")
-
-	return mcp.NewToolResultText(string(result)), nil
+	return nil
 }
 
 // showIndexes 查看表索引
@@ -224,43 +196,17 @@ func showIndexes(request map[string]interface{}) (*mcp.CallToolResult, error) {
 	if !ok || table == "" {
 		return mcp.NewToolResultError("table 参数是必需的"), nil
 	}
-
-	query := fmt.Sprintf("SHOW INDEX FROM `%s`.`%s`", database, table)
-	rows, err := db.Query(query)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v", err)), nil
+	if err := checkTableAccess(database, table); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
-	defer rows.Close()
 
-	// 获取列名
-	columns, err := rows.Columns()
+	pool, err := readDB(request, true)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-
-	// 读取数据
-	var indexes []map[string]interface{}
-	for rows.Next() {
-		values := make([]interface{}, len(columns))
-		valuePtrs := make([]interface{}, len(columns))
-		for i := range values {
-			valuePtrs[i] = &values[i]
-		}
-
-		if err := rows.Scan(valuePtrs...); err != nil {
-			return mcp.NewToolResultError(err.Error()), nil
-		}
-
-		row := make(map[string]interface{})
-		for i, col := range columns {
-			val := values[i]
-			if b, ok := val.([]byte); ok {
-				row[col] = string(b)
-			} else {
-				row[col] = val
-			}
-		}
-		indexes = append(indexes, row)
+	indexes, err := fetchIndexRows(pool, database, table)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v", err)), nil
 	}
 
 	result, _ := json.MarshalIndent(map[string]interface{}{
@@ -280,10 +226,19 @@ func getTableStats(request map[string]interface{}) (*mcp.CallToolResult, error)
 	}
 
 	table, _ := request["table"].(string)
+	checkErr := checkDatabaseAccess(database)
+	if table != "" {
+		checkErr = checkTableAccess(database, table)
+	}
+	if checkErr != nil {
+		return mcp.NewToolResultError(checkErr.Error()), nil
+	}
+	rules := loadAccessRules()
 
 	var query string
+	args := []interface{}{database}
 	if table != "" {
-		query = fmt.Sprintf(`
+		query = `
 			SELECT 
 				TABLE_NAME as table_name,
 				TABLE_ROWS as row_count,
@@ -295,10 +250,11 @@ func getTableStats(request map[string]interface{}) (*mcp.CallToolResult, error)
 				CREATE_TIME as created_at,
 				UPDATE_TIME as updated_at
 			FROM information_schema.TABLES
-			WHERE TABLE_SCHEMA = '%s' AND TABLE_NAME = '%s'
-		`, database, table)
+			WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+		`
+		args = append(args, table)
 	} else {
-		query = fmt.Sprintf(`
+		query = `
 			SELECT 
 				TABLE_NAME as table_name,
 				TABLE_ROWS as row_count,
@@ -310,12 +266,16 @@ func getTableStats(request map[string]interface{}) (*mcp.CallToolResult, error)
 				CREATE_TIME as created_at,
 				UPDATE_TIME as updated_at
 			FROM information_schema.TABLES
-			WHERE TABLE_SCHEMA = '%s'
+			WHERE TABLE_SCHEMA = ?
 			ORDER BY (DATA_LENGTH + INDEX_LENGTH) DESC
-		`, database)
+		`
 	}
 
-	rows, err := db.Query(query)
+	pool, err := readDB(request, true)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	rows, err := pool.Query(query, args...)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v", err)), nil
 	}
@@ -332,6 +292,9 @@ func getTableStats(request map[string]interface{}) (*mcp.CallToolResult, error)
 			&engine, &collation, &createdAt, &updatedAt); err != nil {
 			return mcp.NewToolResultError(err.Error()), nil
 		}
+		if !rules.tableVisible(database, tableName) {
+			continue
+		}
 
 		stat := map[string]interface{}{
 			"table_name":    tableName,
@@ -371,20 +334,28 @@ func showForeignKeys(request map[string]interface{}) (*mcp.CallToolResult, error
 	if !ok || table == "" {
 		return mcp.NewToolResultError("table 参数是必需的"), nil
 	}
+	if err := checkTableAccess(database, table); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
 
-	query := fmt.Sprintf(`
+	rules := loadAccessRules()
+	query := `
 		SELECT 
 			CONSTRAINT_NAME as constraint_name,
 			COLUMN_NAME as column_name,
 			REFERENCED_TABLE_NAME as referenced_table,
 			REFERENCED_COLUMN_NAME as referenced_column
 		FROM information_schema.KEY_COLUMN_USAGE
-		WHERE TABLE_SCHEMA = '%s' 
-			AND TABLE_NAME = '%s'
+		WHERE TABLE_SCHEMA = ?
+			AND TABLE_NAME = ?
 			AND REFERENCED_TABLE_NAME IS NOT NULL
-	`, database, table)
+	`
 
-	rows, err := db.Query(query)
+	pool, err := readDB(request, true)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	rows, err := pool.Query(query, database, table)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v", err)), nil
 	}
@@ -396,6 +367,9 @@ func showForeignKeys(request map[string]interface{}) (*mcp.CallToolResult, error
 		if err := rows.Scan(&constraintName, &columnName, &referencedTable, &referencedColumn); err != nil {
 			return mcp.NewToolResultError(err.Error()), nil
 		}
+		if !rules.tableVisible(database, referencedTable) {
+			continue
+		}
 		foreignKeys = append(foreignKeys, map[string]interface{}{
 			"constraint_name":   constraintName,
 			"column_name":       columnName,
@@ -431,17 +405,26 @@ func searchSchema(request map[string]interface{}) (*mcp.CallToolResult, error) {
 		searchType = "both"
 	}
 
+	if err := checkDatabaseAccess(database); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	rules := loadAccessRules()
+	pool, err := readDB(request, true)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
 	results := make(map[string]interface{})
 
 	// 搜索表名
 	if searchType == "table" || searchType == "both" {
-		query := fmt.Sprintf(`
+		query := `
 			SELECT TABLE_NAME
 			FROM information_schema.TABLES
-			WHERE TABLE_SCHEMA = '%s' AND TABLE_NAME LIKE '%%%s%%'
-		`, database, keyword)
+			WHERE TABLE_SCHEMA = ? AND TABLE_NAME LIKE ? ESCAPE '!'
+		`
 
-		rows, err := db.Query(query)
+		rows, err := pool.Query(query, database, likeContains(keyword))
 		if err != nil {
 			return mcp.NewToolResultError(fmt.Sprintf("搜索表名失败: %v", err)), nil
 		}
@@ -453,6 +436,9 @@ func searchSchema(request map[string]interface{}) (*mcp.CallToolResult, error) {
 			if err := rows.Scan(&tableName); err != nil {
 				return mcp.NewToolResultError(err.Error()), nil
 			}
+			if !rules.tableVisible(database, tableName) {
+				continue
+			}
 			tables = append(tables, tableName)
 		}
 		results["tables"] = tables
@@ -460,13 +446,13 @@ func searchSchema(request map[string]interface{}) (*mcp.CallToolResult, error) {
 
 	// 搜索字段名
 	if searchType == "column" || searchType == "both" {
-		query := fmt.Sprintf(`
+		query := `
 			SELECT TABLE_NAME, COLUMN_NAME, DATA_TYPE
 			FROM information_schema.COLUMNS
-			WHERE TABLE_SCHEMA = '%s' AND COLUMN_NAME LIKE '%%%s%%'
-		`, database, keyword)
+			WHERE TABLE_SCHEMA = ? AND COLUMN_NAME LIKE ? ESCAPE '!'
+		`
 
-		rows, err := db.Query(query)
+		rows, err := pool.Query(query, database, likeContains(keyword))
 		if err != nil {
 			return mcp.NewToolResultError(fmt.Sprintf("搜索字段名失败: %v", err)), nil
 		}
@@ -478,6 +464,9 @@ func searchSchema(request map[string]interface{}) (*mcp.CallToolResult, error) {
 			if err := rows.Scan(&tableName, &columnName, &dataType); err != nil {
 				return mcp.NewToolResultError(err.Error()), nil
 			}
+			if !rules.tableVisible(database, tableName) {
+				continue
+			}
 			columns = append(columns, map[string]interface{}{
 				"table":  tableName,
 				"column": columnName,
@@ -506,9 +495,16 @@ func showCreateTable(request map[string]interface{}) (*mcp.CallToolResult, error
 	if !ok || table == "" {
 		return mcp.NewToolResultError("table 参数是必需的"), nil
 	}
+	if err := checkTableAccess(database, table); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
 
-	query := fmt.Sprintf("SHOW CREATE TABLE `%s`.`%s`", database, table)
-	row := db.QueryRow(query)
+	query := "SHOW CREATE TABLE " + quoteIdent(database) + "." + quoteIdent(table)
+	pool, err := readDB(request, true)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	row := pool.QueryRow(query)
 
 	var tableName, createSQL string
 	if err := row.Scan(&tableName, &createSQL); err != nil {
@@ -535,12 +531,61 @@ func analyzeColumn(request map[string]interface{}) (*mcp.CallToolResult, error)
 	if !ok || table == "" {
 		return mcp.NewToolResultError("table 参数是必需的"), nil
 	}
+	if err := checkTableAccess(database, table); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
 
 	column, ok := request["column"].(string)
 	if !ok || column == "" {
 		return mcp.NewToolResultError("column 参数是必需的"), nil
 	}
 
+	// column 只能是表中已有的字段，不接受表达式
+	pool, err := readDB(request, true)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	columns, err := fetchColumns(pool, database, table)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("读取表结构失败: %v", err)), nil
+	}
+	found := false
+	for _, c := range columns {
+		if strings.EqualFold(c.Field, column) {
+			column, found = c.Field, true
+			break
+		}
+	}
+	if !found {
+		return mcp.NewToolResultError(fmt.Sprintf("表 %s.%s 中没有字段 %s", database, table, column)), nil
+	}
+	col := quoteIdent(column)
+	from := quoteIdent(database) + "." + quoteIdent(table)
+
+	// 脱敏规则作用于最大最小值和常见值
+	m, err := loadMasker()
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	maskAction := ""
+	if m != nil {
+		maskAction = m.columnAction(database, table, column)
+	}
+	mask := func(v string) interface{} {
+		if m == nil {
+			return v
+		}
+		return m.maskValue(maskAction, v)
+	}
+
+	// 全表统计可能很慢，在带会话限制的连接上执行
+	ctx := context.Background()
+	conn, release, err := checkoutConn(ctx, pool)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer release()
+
 	// 获取统计信息
 	query := fmt.Sprintf(`
 		SELECT 
@@ -548,13 +593,13 @@ func analyzeColumn(request map[string]interface{}) (*mcp.CallToolResult, error)
 			COUNT(DISTINCT %s) as unique_count,
 			COUNT(%s) as non_null_count,
 			COUNT(*) - COUNT(%s) as null_count
-		FROM %s.%s
-	`, column, column, column, database, table)
+		FROM %s
+	`, col, col, col, from)
 
-	row := db.QueryRow(query)
+	row := conn.QueryRowContext(ctx, query)
 	var totalCount, uniqueCount, nonNullCount, nullCount int64
 	if err := row.Scan(&totalCount, &uniqueCount, &nonNullCount, &nullCount); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v", err)), nil
+		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v%s", err, limitErrorHint(err))), nil
 	}
 
 	analysis := map[string]interface{}{
@@ -568,29 +613,29 @@ func analyzeColumn(request map[string]interface{}) (*mcp.CallToolResult, error)
 	}
 
 	// 尝试获取最大值和最小值（仅对数值和日期类型）
-	minMaxQuery := fmt.Sprintf("SELECT MIN(%s), MAX(%s) FROM %s.%s", column, column, database, table)
-	minMaxRow := db.QueryRow(minMaxQuery)
+	minMaxQuery := fmt.Sprintf("SELECT MIN(%s), MAX(%s) FROM %s", col, col, from)
+	minMaxRow := conn.QueryRowContext(ctx, minMaxQuery)
 	var minVal, maxVal sql.NullString
 	if err := minMaxRow.Scan(&minVal, &maxVal); err == nil {
 		if minVal.Valid {
-			analysis["min_value"] = minVal.String
+			analysis["min_value"] = mask(minVal.String)
 		}
 		if maxVal.Valid {
-			analysis["max_value"] = maxVal.String
+			analysis["max_value"] = mask(maxVal.String)
 		}
 	}
 
 	// 获取最常见的值（Top 10）
 	topValuesQuery := fmt.Sprintf(`
 		SELECT %s, COUNT(*) as count
-		FROM %s.%s
+		FROM %s
 		WHERE %s IS NOT NULL
 		GROUP BY %s
 		ORDER BY count DESC
 		LIMIT 10
-	`, column, database, table, column, column)
+	`, col, from, col, col)
 
-	rows, err := db.Query(topValuesQuery)
+	rows, err := conn.QueryContext(ctx, topValuesQuery)
 	if err == nil {
 		defer rows.Close()
 		var topValues []map[string]interface{}
@@ -599,13 +644,16 @@ func analyzeColumn(request map[string]interface{}) (*mcp.CallToolResult, error)
 			var count int64
 			if err := rows.Scan(&value, &count); err == nil {
 				topValues = append(topValues, map[string]interface{}{
-					"value": value,
+					"value": mask(value),
 					"count": count,
 				})
 			}
 		}
 		analysis["top_values"] = topValues
 	}
+	if maskAction != "" {
+		analysis["masked"] = maskAction
+	}
 
 	result, _ := json.MarshalIndent(analysis, "", "  ")
 	return mcp.NewToolResultText(string(result)), nil
@@ -619,20 +667,30 @@ func showTriggers(request map[string]interface{}) (*mcp.CallToolResult, error) {
 	}
 
 	table, _ := request["table"].(string)
+	checkErr := checkDatabaseAccess(database)
+	if table != "" {
+		checkErr = checkTableAccess(database, table)
+	}
+	if checkErr != nil {
+		return mcp.NewToolResultError(checkErr.Error()), nil
+	}
+	rules := loadAccessRules()
 
 	var query string
+	args := []interface{}{database}
 	if table != "" {
-		query = fmt.Sprintf(`
+		query = `
 			SELECT 
 				TRIGGER_NAME,
 				EVENT_MANIPULATION,
 				ACTION_TIMING,
 				ACTION_STATEMENT
 			FROM information_schema.TRIGGERS
-			WHERE TRIGGER_SCHEMA = '%s' AND EVENT_OBJECT_TABLE = '%s'
-		`, database, table)
+			WHERE TRIGGER_SCHEMA = ? AND EVENT_OBJECT_TABLE = ?
+		`
+		args = append(args, table)
 	} else {
-		query = fmt.Sprintf(`
+		query = `
 			SELECT 
 				TRIGGER_NAME,
 				EVENT_OBJECT_TABLE,
@@ -640,11 +698,15 @@ func showTriggers(request map[string]interface{}) (*mcp.CallToolResult, error) {
 				ACTION_TIMING,
 				ACTION_STATEMENT
 			FROM information_schema.TRIGGERS
-			WHERE TRIGGER_SCHEMA = '%s'
-		`, database)
+			WHERE TRIGGER_SCHEMA = ?
+		`
 	}
 
-	rows, err := db.Query(query)
+	pool, err := readDB(request, true)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	rows, err := pool.Query(query, args...)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v", err)), nil
 	}
@@ -668,6 +730,9 @@ func showTriggers(request map[string]interface{}) (*mcp.CallToolResult, error) {
 			if err := rows.Scan(&triggerName, &tableName, &eventManipulation, &actionTiming, &actionStatement); err != nil {
 				return mcp.NewToolResultError(err.Error()), nil
 			}
+			if !rules.tableVisible(database, tableName) {
+				continue
+			}
 			triggers = append(triggers, map[string]interface{}{
 				"trigger_name":       triggerName,
 				"table":              tableName,
@@ -692,14 +757,16 @@ func showTriggers(request map[string]interface{}) (*mcp.CallToolResult, error) {
 func showVariables(request map[string]interface{}) (*mcp.CallToolResult, error) {
 	pattern, _ := request["pattern"].(string)
 
-	var query string
+	// SHOW VARIABLES 不能预处理，模式在本地按 LIKE 语义匹配，不拼入语句
+	var match *regexp.Regexp
 	if pattern != "" {
-		query = fmt.Sprintf("SHOW VARIABLES LIKE '%s'", pattern)
-	} else {
-		query = "SHOW VARIABLES"
+		match = likeRegexp(pattern)
 	}
-
-	rows, err := db.Query(query)
+	pool, err := readDB(request, false)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	rows, err := pool.Query("SHOW VARIABLES")
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v", err)), nil
 	}
@@ -711,6 +778,9 @@ func showVariables(request map[string]interface{}) (*mcp.CallToolResult, error)
 		if err := rows.Scan(&name, &value); err != nil {
 			return mcp.NewToolResultError(err.Error()), nil
 		}
+		if match != nil && !match.MatchString(name) {
+			continue
+		}
 		variables = append(variables, map[string]interface{}{
 			"name":  name,
 			"value": value,
@@ -729,14 +799,16 @@ func showVariables(request map[string]interface{}) (*mcp.CallToolResult, error)
 func showStatus(request map[string]interface{}) (*mcp.CallToolResult, error) {
 	pattern, _ := request["pattern"].(string)
 
-	var query string
+	// SHOW STATUS 不能预处理，模式在本地按 LIKE 语义匹配，不拼入语句
+	var match *regexp.Regexp
 	if pattern != "" {
-		query = fmt.Sprintf("SHOW STATUS LIKE '%s'", pattern)
-	} else {
-		query = "SHOW STATUS"
+		match = likeRegexp(pattern)
 	}
-
-	rows, err := db.Query(query)
+	pool, err := readDB(request, false)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	rows, err := pool.Query("SHOW STATUS")
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v", err)), nil
 	}
@@ -748,6 +820,9 @@ func showStatus(request map[string]interface{}) (*mcp.CallToolResult, error) {
 		if err := rows.Scan(&name, &value); err != nil {
 			return mcp.NewToolResultError(err.Error()), nil
 		}
+		if match != nil && !match.MatchString(name) {
+			continue
+		}
 		status = append(status, map[string]interface{}{
 			"name":  name,
 			"value": value,
@@ -762,11 +837,42 @@ func showStatus(request map[string]interface{}) (*mcp.CallToolResult, error) {
 	return mcp.NewToolResultText(string(result)), nil
 }
 
+// likeContains 生成“包含 keyword”的 LIKE 模式，配合 ESCAPE '!' 使用，关键字中的 % 和 _ 按字面匹配
+func likeContains(keyword string) string {
+	return "%" + strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(keyword) + "%"
+}
+
+// likeRegexp 把 LIKE 模式（% 任意串，_ 单个字符，\ 转义，不区分大小写）转为正则，用于不能绑定参数的 SHOW 语句
+func likeRegexp(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("(?is)^")
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; {
+		case c == '%':
+			sb.WriteString(".*")
+		case c == '_':
+			sb.WriteString(".")
+		case c == '\\' && i+1 < len(runes):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(runes[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
+
 // showProcesslist 查看正在执行的查询
 func showProcesslist(request map[string]interface{}) (*mcp.CallToolResult, error) {
 	query := "SHOW FULL PROCESSLIST"
 
-	rows, err := db.Query(query)
+	pool, err := readDB(request, false)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	rows, err := pool.Query(query)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v", err)), nil
 	}
@@ -829,18 +935,25 @@ func showTableCharset(request map[string]interface{}) (*mcp.CallToolResult, erro
 	if !ok || table == "" {
 		return mcp.NewToolResultError("table 参数是必需的"), nil
 	}
+	if err := checkTableAccess(database, table); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
 
-	query := fmt.Sprintf(`
+	query := `
 		SELECT 
 			COLUMN_NAME,
 			CHARACTER_SET_NAME,
 			COLLATION_NAME
 		FROM information_schema.COLUMNS
-		WHERE TABLE_SCHEMA = '%s' AND TABLE_NAME = '%s'
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
 			AND CHARACTER_SET_NAME IS NOT NULL
-	`, database, table)
+	`
 
-	rows, err := db.Query(query)
+	pool, err := readDB(request, true)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	rows, err := pool.Query(query, database, table)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v", err)), nil
 	}
@@ -885,80 +998,129 @@ func forceBrowserReadHandler(req map[string]interface{}) (*mcp.CallToolResult, e
 	return mcp.NewToolResultText(string(result)), nil
 }
 
-// documentGeneratorHandler 按照指定格式生成模块文档 Markdown
+// documentGeneratorHandler 按照模块文档模板生成文档，支持多种输出格式
 func documentGeneratorHandler(input map[string]interface{}) (*mcp.CallToolResult, error) {
+	format, _ := input["format"].(string)
+	outputFile, _ := input["output_file"].(string)
+
+	docType, _ := input["type"].(string)
+	specFile, _ := input["spec_file"].(string)
+
+	var spec *openAPISpec
+	if specFile != "" {
+		var err error
+		if spec, err = loadOpenAPISpec(specFile); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+
+	var doc *document
+	if docType == "api" && spec != nil {
+		title, _ := input["title"].(string)
+		doc = &document{title: title}
+		spec.buildAPISections(doc)
+	} else {
+		doc = buildModuleDocument(input, spec)
+	}
+
+	content, err := renderDocument(doc, format)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if outputFile == "" {
+		return mcp.NewToolResultText(content), nil
+	}
+
+	overwrite, _ := input["overwrite"].(bool)
+	path, err := writeDocumentFile(outputFile, format, content, overwrite)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	result, _ := json.MarshalIndent(map[string]interface{}{
+		"message": "文档已生成",
+		"format":  normalizeDocFormat(format),
+		"path":    path,
+		"bytes":   len(content),
+	}, "", "  ")
+
+	return mcp.NewToolResultText(string(result)), nil
+}
+
+// buildModuleDocument 根据输入构建模块设计文档模型，spec 不为空时由其生成接口章节
+func buildModuleDocument(input map[string]interface{}, spec *openAPISpec) *document {
 	title, _ := input["title"].(string) // 模块名称
 	moduleName, _ := input["moduleName"].(string)
 	application, _ := input["application"].(string)
 	lastUpdate, _ := input["lastUpdate"].(string)
 	description, _ := input["description"].(string)
-	tables, _ := input["tables"].([]map[string]interface{}) // 数据库表列表
-
-	var md strings.Builder
-
-	// 顶部模块信息
-	md.WriteString(fmt.Sprintf("# %s\n\n", title))
-	md.WriteString(fmt.Sprintf("**模块名称：** %s\n", moduleName))
-	md.WriteString(fmt.Sprintf("**所属应用：** %s\n", application))
-	md.WriteString(fmt.Sprintf("**最后更新：** %s\n\n", lastUpdate))
-	md.WriteString("---\n\n")
+	tables, _ := input["tables"].([]interface{}) // 数据库表列表
+
+	doc := &document{
+		title: title,
+		meta: []docMeta{
+			{label: "模块名称", value: moduleName},
+			{label: "所属应用", value: application},
+			{label: "最后更新", value: lastUpdate},
+		},
+	}
 
 	// 1. 模块概述
-	md.WriteString("## 1. 模块概述\n\n")
+	doc.addSection(2, "1. 模块概述")
 
-	md.WriteString("### 1.1 功能说明\n")
+	features := doc.addSection(3, "1.1 功能说明")
 	if description != "" {
-		for _, line := range strings.Split(description, "\n") {
-			md.WriteString(fmt.Sprintf("- %s\n", line))
-		}
+		features.list(strings.Split(description, "\n")...)
 	} else {
-		md.WriteString("- 功能描述待补充\n")
+		features.list("功能描述待补充")
 	}
-	md.WriteString("\n")
 
-	md.WriteString("### 1.2 数据来源与发放方式\n\n")
-	md.WriteString("**数据来源：**\n- 待补充\n\n")
-	md.WriteString("**发放方式：**\n- 待补充\n\n")
+	doc.addSection(3, "1.2 数据来源与发放方式").
+		label("数据来源：").list("待补充").
+		label("发放方式：").list("待补充")
 
-	md.WriteString("### 1.3 功能权限\n")
-	md.WriteString("- 待补充\n\n")
-	md.WriteString("---\n\n")
+	doc.addSection(3, "1.3 功能权限").list("待补充").rule()
 
 	// 2. 数据库表结构
-	md.WriteString("## 2. 数据库表结构\n\n")
+	doc.addSection(2, "2. 数据库表结构")
 
-	for _, table := range tables {
+	for i, t := range tables {
+		table, ok := t.(map[string]interface{})
+		if !ok {
+			continue
+		}
 		tableName, _ := table["name"].(string)
 		tableComment, _ := table["comment"].(string)
 		createSQL, _ := table["createSQL"].(string)
 		association, _ := table["association"].(string)
 
-		md.WriteString(fmt.Sprintf("### 2.%s `%s` — %s\n\n", table["index"], tableName, tableComment))
-		md.WriteString("#### 表结构说明\n")
-		md.WriteString(fmt.Sprintf("- %s\n\n", tableComment))
-		md.WriteString("#### 建表语句\n\n")
-		md.WriteString("```sql\n")
-		md.WriteString(createSQL + "\n")
-		md.WriteString("```\n\n")
+		index := fmt.Sprint(i + 1)
+		if v, ok := table["index"]; ok {
+			index = fmt.Sprint(v)
+		}
+
+		doc.addSection(3, fmt.Sprintf("2.%s `%s` — %s", index, tableName, tableComment))
+		doc.addSection(4, "表结构说明").list(tableComment)
+		sec := doc.addSection(4, "建表语句").code("sql", createSQL)
 		if association != "" {
-			md.WriteString("**关联说明：**\n")
-			md.WriteString(association + "\n\n")
+			sec.label("关联说明：").paragraph(association)
 		}
-		md.WriteString("---\n\n")
+		sec.rule()
 	}
 
 	// 3. API 接口设计
-	md.WriteString("## 3. API 接口设计\n\n")
-	md.WriteString("### 3.1 接口列表\n")
-	md.WriteString("- 待补充\n\n")
-	md.WriteString("---\n\n")
+	if spec != nil {
+		spec.buildAPISections(doc)
+	} else {
+		doc.addSection(2, "3. API 接口设计")
+		doc.addSection(3, "3.1 接口列表").list("待补充").rule()
+	}
 
 	// 4. 核心流程
-	md.WriteString("### 4.1 核心流程\n")
-	md.WriteString("- 待补充\n\n")
-	md.WriteString("---\n")
+	doc.addSection(3, "4.1 核心流程").list("待补充").rule()
 
-	return mcp.NewToolResultText(md.String()), nil
+	return doc
 }
 
 func concurrentRequestHandler(input map[string]interface{}) (*mcp.CallToolResult, error) {
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// healthCheck 检查主库连通性，并汇总 SSH 隧道和从库的状态。
+// status 为 ok、degraded（主库可用但隧道当前断开或有从库不可用）或 down（主库不可用）
+func healthCheck(request map[string]interface{}) (*mcp.CallToolResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	status := "ok"
+	primary := map[string]interface{}{"ok": true}
+	start := time.Now()
+	if err := db.PingContext(ctx); err != nil {
+		status = "down"
+		primary["ok"] = false
+		primary["error"] = err.Error()
+	} else {
+		primary["latency_ms"] = time.Since(start).Milliseconds()
+	}
+	stats := db.Stats()
+	primary["pool"] = map[string]interface{}{
+		"open":       stats.OpenConnections,
+		"in_use":     stats.InUse,
+		"idle":       stats.Idle,
+		"wait_count": stats.WaitCount,
+	}
+
+	report := map[string]interface{}{
+		"primary": primary,
+	}
+	if tunnel != nil {
+		tunnelStatus := tunnel.status()
+		report["ssh_tunnel"] = tunnelStatus
+		if connected, _ := tunnelStatus["connected"].(bool); !connected && status == "ok" {
+			status = "degraded"
+		}
+	}
+	if len(replicas.items) > 0 {
+		health := replicaHealth()
+		report["replicas"] = health
+		for _, r := range health {
+			if healthy, _ := r["healthy"].(bool); !healthy && status == "ok" {
+				status = "degraded"
+			}
+		}
+	}
+	report["status"] = status
+	report["checked_at"] = time.Now().Format(time.RFC3339)
+
+	jsonData, _ := json.MarshalIndent(report, "", "  ")
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 历史保留策略默认值，可通过 QUERY_HISTORY_MAX_ENTRIES / QUERY_HISTORY_MAX_DAYS 调整
+const (
+	defaultHistoryMaxEntries = 10000
+	defaultHistoryMaxDays    = 30
+)
+
+// historyCompactEvery 每追加多少条记录检查一次保留策略
+const historyCompactEvery = 100
+
+// historyEntry 查询历史中的一条记录，每条占 JSONL 文件的一行
+type historyEntry struct {
+	ID          string            `json:"id"`
+	Time        time.Time         `json:"time"`
+	Tool        string            `json:"tool"`
+	Caller      string            `json:"caller,omitempty"`
+	Query       string            `json:"query"`
+	Args        []json.RawMessage `json:"args,omitempty"`
+	Fingerprint string            `json:"fingerprint"`
+	Normalized  string            `json:"normalized"`
+	DurationMs  int64             `json:"duration_ms"`
+	Rows        int64             `json:"rows"`
+	Error       string            `json:"error,omitempty"`
+	ReplayOf    string            `json:"replay_of,omitempty"`
+	Session     string            `json:"session,omitempty"`
+	Redacted    bool              `json:"args_redacted,omitempty"` // 参数经过脱敏，与实际执行时不同
+
+	call *toolCall // 发起查询的工具调用，用于审计和记录调用方
+}
+
+var history struct {
+	sync.Mutex
+	lastID  int64
+	appends int
+}
+
+// historyFile 历史文件路径。未设置时放在用户缓存目录下（如 ~/.cache/mysql-mcp/query_history.jsonl），
+// 不随启动目录散落；QUERY_HISTORY_FILE=off 或取不到缓存目录时不记录
+func historyFile() string {
+	path := getEnv("QUERY_HISTORY_FILE", "")
+	if path == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return ""
+		}
+		return filepath.Join(dir, "mysql-mcp", "query_history.jsonl")
+	}
+	if strings.EqualFold(path, "off") {
+		return ""
+	}
+	return path
+}
+
+// recordQuery 追加一条查询历史。记录失败只写日志，不影响查询本身
+func recordQuery(entry historyEntry) {
+	auditQuery(entry.call, entry.Query, entry.Rows)
+
+	path := historyFile()
+	if path == "" {
+		return
+	}
+
+	history.Lock()
+	defer history.Unlock()
+
+	// 以纳秒时间戳作为 ID，保证单调递增
+	id := time.Now().UnixNano()
+	if id <= history.lastID {
+		id = history.lastID + 1
+	}
+	history.lastID = id
+	entry.ID = strconv.FormatInt(id, 36)
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.Caller = clientOf(entry.call)
+	entry.Args, entry.Redacted = redactHistoryArgs(entry.Args)
+	entry.Normalized = normalizeQuery(entry.Query)
+	entry.Fingerprint = fingerprint(entry.Normalized)
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("query history: %v", err)
+		return
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		os.MkdirAll(dir, 0o755)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Printf("query history: %v", err)
+		return
+	}
+	_, err = f.Write(append(line, '\n'))
+	f.Close()
+	if err != nil {
+		log.Printf("query history: %v", err)
+		return
+	}
+
+	if history.appends%historyCompactEvery == 0 {
+		if err := compactHistory(path); err != nil {
+			log.Printf("query history: %v", err)
+		}
+	}
+	history.appends++
+}
+
+// redactHistoryArgs 按审计日志的规则对绑定参数脱敏，返回的布尔值表示是否有参数被改写
+func redactHistoryArgs(args []json.RawMessage) ([]json.RawMessage, bool) {
+	if len(args) == 0 {
+		return args, false
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		if json.Unmarshal(arg, &values[i]) != nil {
+			values[i] = string(arg)
+		}
+	}
+	redacted, _ := redactArgs(map[string]interface{}{"args": values})["args"].([]interface{})
+
+	out := make([]json.RawMessage, len(args))
+	changed := false
+	for i := range args {
+		out[i], _ = json.Marshal(redacted[i])
+		changed = changed || !reflect.DeepEqual(values[i], redacted[i])
+	}
+	return out, changed
+}
+
+// scanHistory 按写入顺序逐行读取历史记录，跳过无法解析的行；fn 返回 false 时停止
+func scanHistory(path string, fn func(historyEntry) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var entry historyEntry
+			if json.Unmarshal(line, &entry) == nil && entry.ID != "" && !fn(entry) {
+				return nil
+			}
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// readHistory 读取全部历史记录，用于按保留策略重写文件
+func readHistory(path string) ([]historyEntry, error) {
+	var entries []historyEntry
+	err := scanHistory(path, func(entry historyEntry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+	return entries, err
+}
+
+// compactHistory 按保留条数和天数清理历史，只有确实删除了记录时才重写文件
+func compactHistory(path string) error {
+	entries, err := readHistory(path)
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -getEnvInt("QUERY_HISTORY_MAX_DAYS", defaultHistoryMaxDays))
+	start := 0
+	for start < len(entries) && entries[start].Time.Before(cutoff) {
+		start++
+	}
+	if maxEntries := getEnvInt("QUERY_HISTORY_MAX_ENTRIES", defaultHistoryMaxEntries); len(entries)-start > maxEntries {
+		start = len(entries) - maxEntries
+	}
+	if start == 0 {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	for _, entry := range entries[start:] {
+		line, _ := json.Marshal(entry)
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	tmp.Close()
+	return os.Rename(tmp.Name(), path)
+}
+
+// normalizeQuery 生成查询指纹用的规范化文本：字面量替换为 ?，IN 列表折叠，
+// 标识符和关键字统一小写，去掉注释和多余空白
+func normalizeQuery(query string) string {
+	var parts []string
+	for _, t := range tokenizeSQL(query) {
+		switch t.kind {
+		case tokString, tokNumber, tokParam:
+			parts = append(parts, "?")
+		case tokIdent:
+			parts = append(parts, strings.ToLower(t.name()))
+		case tokPunct:
+			// (?, ?, ?) 折叠为 (?+)
+			if t.text == ")" && len(parts) >= 2 && parts[len(parts)-1] == "?" {
+				i := len(parts) - 2
+				for i >= 1 && parts[i] == "," && parts[i-1] == "?" {
+					i -= 2
+				}
+				if i >= 0 && parts[i] == "(" {
+					parts = append(parts[:i], "(?+)")
+					continue
+				}
+			}
+			parts = append(parts, t.text)
+		default:
+			parts = append(parts, strings.ToLower(t.text))
+		}
+	}
+	text := strings.Join(parts, " ")
+	return strings.NewReplacer(" . ", ".", "( ", "(", " )", ")", " ,", ",").Replace(text)
+}
+
+func fingerprint(normalized string) string {
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:8])
+}
+
+// queryHistory 列出和搜索查询历史，最新的记录在前
+func queryHistory(request map[string]interface{}) (*mcp.CallToolResult, error) {
+	path := historyFile()
+	if path == "" {
+		return mcp.NewToolResultError("查询历史未启用（QUERY_HISTORY_FILE=off）"), nil
+	}
+
+	keyword, _ := request["keyword"].(string)
+	fp, _ := request["fingerprint"].(string)
+	tool, _ := request["tool"].(string)
+	errorsOnly, _ := request["errors_only"].(bool)
+	limit := 20
+	if l, ok := request["limit"].(float64); ok && l >= 1 {
+		limit = int(l)
+	}
+	var since time.Time
+	if s, _ := request["since"].(string); s != "" {
+		t, err := parseBindTime(s, "2006-01-02T15:04:05Z07:00", "2006-01-02 15:04:05", "2006-01-02")
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("since 格式错误: %v", err)), nil
+		}
+		since = t
+	}
+
+	// 逐行扫描，只保留最新的 limit 条匹配记录（环形缓冲，start 指向最旧的一条）
+	var recent []historyEntry
+	start, total := 0, 0
+	history.Lock()
+	err := scanHistory(path, func(e historyEntry) bool {
+		if keyword != "" && !strings.Contains(strings.ToLower(e.Query), strings.ToLower(keyword)) {
+			return true
+		}
+		if fp != "" && e.Fingerprint != fp {
+			return true
+		}
+		if tool != "" && e.Tool != tool {
+			return true
+		}
+		if errorsOnly && e.Error == "" {
+			return true
+		}
+		if !since.IsZero() && e.Time.Before(since) {
+			return true
+		}
+		total++
+		if len(recent) < limit {
+			recent = append(recent, e)
+		} else {
+			recent[start] = e
+			start = (start + 1) % limit
+		}
+		return true
+	})
+	history.Unlock()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("读取查询历史失败: %v", err)), nil
+	}
+
+	matched := make([]historyEntry, 0, len(recent))
+	for i := len(recent) - 1; i >= 0; i-- {
+		matched = append(matched, recent[(start+i)%len(recent)])
+	}
+
+	out := map[string]interface{}{
+		"entries": matched,
+		"count":   len(matched),
+		"total":   total,
+	}
+	jsonData, _ := json.MarshalIndent(out, "", "  ")
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+// replayQuery 按历史记录 ID 重新执行查询（使用当时的参数）
+func replayQuery(request map[string]interface{}) (*mcp.CallToolResult, error) {
+	id, ok := request["id"].(string)
+	if !ok || id == "" {
+		return mcp.NewToolResultError("id 参数是必需的"), nil
+	}
+	path := historyFile()
+	if path == "" {
+		return mcp.NewToolResultError("查询历史未启用（QUERY_HISTORY_FILE=off）"), nil
+	}
+
+	var entry *historyEntry
+	history.Lock()
+	err := scanHistory(path, func(e historyEntry) bool {
+		if e.ID == id {
+			entry = &e
+		}
+		return entry == nil
+	})
+	history.Unlock()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("读取查询历史失败: %v", err)), nil
+	}
+	if entry == nil {
+		return mcp.NewToolResultError(fmt.Sprintf("没有 ID 为 %s 的历史记录", id)), nil
+	}
+	if entry.Redacted {
+		return mcp.NewToolResultError(fmt.Sprintf("历史记录 %s 的参数已脱敏保存，无法按原参数重放，请用 execute_query 重新提供参数", id)), nil
+	}
+	if err := checkReadOnlyQuery(entry.Query); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	limit := 100
+	if l, ok := request["limit"].(float64); ok && l >= 1 {
+		limit = int(l)
+	}
+
+	state := newPageState(entry.Query, limit)
+	state.Args = entry.Args
+	state.Format, _ = request["format"].(string)
+	state.BinaryEncoding, _ = request["binary_encoding"].(string)
+	state.tool, state.replayOf = "replay_query", entry.ID
+	state.call = callOf(request)
+	state.SessionID, _ = request["session_id"].(string)
+	state.Route, _ = request["route"].(string)
+
+	return runQueryPage(state)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func resultText(t *testing.T, result *mcp.CallToolResult) string {
+	t.Helper()
+	text, ok := result.Content[0].(mcp.TextContent)
+	if !ok {
+		t.Fatalf("content = %#v", result.Content[0])
+	}
+	return text.Text
+}
+
+// 查询历史逐行扫描，只保留最新的 limit 条，total 统计全部匹配
+func TestQueryHistoryNewestFirst(t *testing.T) {
+	t.Setenv("QUERY_HISTORY_FILE", filepath.Join(t.TempDir(), "history.jsonl"))
+	t.Setenv("MASKING_RULES_FILE", "")
+	t.Setenv("MASKING_DETECTORS", "")
+	for _, q := range []string{"SELECT 1", "SELECT a FROM t", "SELECT 2", "SELECT b FROM t", "SELECT c FROM t", "SELECT 3"} {
+		recordQuery(historyEntry{Tool: "execute_query", Query: q})
+	}
+
+	tests := []struct {
+		request map[string]interface{}
+		want    []string
+		total   int
+	}{
+		{map[string]interface{}{"limit": float64(2)}, []string{"SELECT 3", "SELECT c FROM t"}, 6},
+		{map[string]interface{}{"keyword": "from t", "limit": float64(2)}, []string{"SELECT c FROM t", "SELECT b FROM t"}, 3},
+		{map[string]interface{}{"keyword": "from t"}, []string{"SELECT c FROM t", "SELECT b FROM t", "SELECT a FROM t"}, 3},
+		{map[string]interface{}{"tool": "replay_query"}, []string{}, 0},
+	}
+	for _, tt := range tests {
+		result, _ := queryHistory(tt.request)
+		var out struct {
+			Entries []historyEntry `json:"entries"`
+			Total   int            `json:"total"`
+		}
+		if err := json.Unmarshal([]byte(resultText(t, result)), &out); err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, e := range out.Entries {
+			got = append(got, e.Query)
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") || out.Total != tt.total {
+			t.Errorf("%v: entries = %q, total = %d; want %q, %d", tt.request, got, out.Total, tt.want, tt.total)
+		}
+	}
+}
+
+// 写入历史的参数经过脱敏，脱敏过的记录不能按原参数重放
+func TestHistoryArgsRedacted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	t.Setenv("QUERY_HISTORY_FILE", path)
+	t.Setenv("MASKING_RULES_FILE", "")
+	t.Setenv("MASKING_DETECTORS", "email")
+	recordQuery(historyEntry{Tool: "execute_query", Query: "SELECT * FROM users WHERE email = ? AND id = ?",
+		Args: []json.RawMessage{json.RawMessage(`"alice@example.com"`), json.RawMessage(`42`)}})
+	recordQuery(historyEntry{Tool: "execute_query", Query: "SELECT * FROM users WHERE id = ?",
+		Args: []json.RawMessage{json.RawMessage(`42`)}})
+
+	entries, err := readHistory(path)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("entries = %v, %v", entries, err)
+	}
+	if args := entries[0].Args; !entries[0].Redacted || strings.Contains(string(args[0]), "alice") || string(args[1]) != "42" {
+		t.Errorf("redacted entry = %s %v", args, entries[0].Redacted)
+	}
+	if entries[1].Redacted {
+		t.Error("entry without sensitive args marked as redacted")
+	}
+
+	result, _ := replayQuery(map[string]interface{}{"id": entries[0].ID})
+	if text := resultText(t, result); !result.IsError || !strings.Contains(text, "脱敏") {
+		t.Errorf("replay of redacted entry = %s", text)
+	}
+	result, _ = replayQuery(map[string]interface{}{"id": "missing"})
+	if text := resultText(t, result); !result.IsError || !strings.Contains(text, "没有 ID") {
+		t.Errorf("replay of missing entry = %s", text)
+	}
+	// session_id 传给重放的查询：不存在的会话直接报错，而不是在会话之外执行
+	result, _ = replayQuery(map[string]interface{}{"id": entries[1].ID, "session_id": "s_missing"})
+	if text := resultText(t, result); !result.IsError || !strings.Contains(text, "s_missing") {
+		t.Errorf("replay in unknown session = %s", text)
+	}
+}
+
+// 未设置 QUERY_HISTORY_FILE 时历史写到用户缓存目录，而不是当前目录
+func TestHistoryFileDefault(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache)
+	t.Setenv("QUERY_HISTORY_FILE", "")
+	// macOS 的缓存目录是 $HOME/Library/Caches，其他 Unix 为 $XDG_CACHE_HOME
+	if got := historyFile(); !strings.HasPrefix(got, cache) || !strings.HasSuffix(got, filepath.Join("mysql-mcp", "query_history.jsonl")) {
+		t.Errorf("historyFile() = %q, want mysql-mcp/query_history.jsonl under %s", got, cache)
+	}
+	t.Setenv("QUERY_HISTORY_FILE", "OFF")
+	if got := historyFile(); got != "" {
+		t.Errorf("historyFile() with off = %q", got)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// 并发限制默认值，可通过 TOOL_MAX_CONCURRENCY / TOOL_QUEUE_SIZE / TOOL_QUEUE_TIMEOUT（秒）调整。
+// TOOL_MAX_CONCURRENCY 为 0 时不限制全局并发，TOOL_QUEUE_SIZE 为 0 时不排队、满额即拒绝
+const (
+	defaultToolMaxConcurrency = 8
+	defaultToolQueueSize      = 32
+	defaultToolQueueTimeout   = 30
+)
+
+// defaultToolLimits 重型工具的默认并发上限，可通过 TOOL_CONCURRENCY_LIMITS 覆盖
+const defaultToolLimits = "analyze_column=2,get_table_stats=2,export_query=2,concurrent_request_runner=1"
+
+// toolRetryAfter 繁忙时建议的重试间隔（秒）
+const toolRetryAfter = 5
+
+// busyResult 排队已满或等待超时时返回的错误
+func busyResult(scope string, limit int) *mcp.CallToolResult {
+	return mcp.NewToolResultError(fmt.Sprintf("服务器繁忙：%s并发调用已达上限 %d，排队已满或等待超时，请 %d 秒后重试", scope, limit, toolRetryAfter))
+}
+
+// fairLimiter 先到先得的并发限制器：有空位时直接执行，否则按到达顺序排队，
+// 释放的名额直接交给队首的等待者，后来的调用不会插队
+type fairLimiter struct {
+	mu      sync.Mutex
+	active  int
+	waiters []chan struct{}
+}
+
+var limiters = struct {
+	sync.Mutex
+	global *fairLimiter
+	tools  map[string]*fairLimiter
+}{global: &fairLimiter{}, tools: map[string]*fairLimiter{}}
+
+// acquire 占用一个名额，排队超过 queueSize 或等待超过 timeout 时返回 false
+func (l *fairLimiter) acquire(limit, queueSize int, timeout time.Duration) bool {
+	l.mu.Lock()
+	if l.active < limit && len(l.waiters) == 0 {
+		l.active++
+		l.mu.Unlock()
+		return true
+	}
+	if len(l.waiters) >= queueSize {
+		l.mu.Unlock()
+		return false
+	}
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, ready)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		return true
+	case <-timer.C:
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, w := range l.waiters {
+		if w == ready {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			return false
+		}
+	}
+	// 超时的同时已经拿到了名额
+	return true
+}
+
+// release 归还名额，有等待者时直接交给队首
+func (l *fairLimiter) release(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.waiters) > 0 && l.active <= limit {
+		next := l.waiters[0]
+		l.waiters = l.waiters[1:]
+		close(next)
+		return
+	}
+	l.active--
+}
+
+// toolConcurrencyLimit 读取工具的并发上限，0 表示只受全局上限约束
+func toolConcurrencyLimit(name string) int {
+	limit := 0
+	for _, spec := range []string{defaultToolLimits, getEnv("TOOL_CONCURRENCY_LIMITS", "")} {
+		for _, item := range strings.Split(spec, ",") {
+			tool, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+			if !ok || strings.TrimSpace(tool) != name {
+				continue
+			}
+			if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && n >= 0 {
+				limit = n
+			}
+		}
+	}
+	return limit
+}
+
+func toolLimiter(name string) *fairLimiter {
+	limiters.Lock()
+	defer limiters.Unlock()
+	l, ok := limiters.tools[name]
+	if !ok {
+		l = &fairLimiter{}
+		limiters.tools[name] = l
+	}
+	return l
+}
+
+// limitHandler 先占用工具自己的名额再占用全局名额，避免排队等待某个工具时占着全局名额
+func limitHandler(name string, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(request map[string]interface{}) (*mcp.CallToolResult, error) {
+		queueSize := getEnvLimit("TOOL_QUEUE_SIZE", defaultToolQueueSize)
+		timeout := time.Duration(getEnvInt("TOOL_QUEUE_TIMEOUT", defaultToolQueueTimeout)) * time.Second
+
+		if limit := toolConcurrencyLimit(name); limit > 0 {
+			l := toolLimiter(name)
+			if !l.acquire(limit, queueSize, timeout) {
+				return busyResult(name+" 的", limit), nil
+			}
+			defer l.release(limit)
+		}
+
+		if limit := getEnvLimit("TOOL_MAX_CONCURRENCY", defaultToolMaxConcurrency); limit > 0 {
+			if !limiters.global.acquire(limit, queueSize, timeout) {
+				return busyResult("全局", limit), nil
+			}
+			defer limiters.global.release(limit)
+		}
+
+		return handler(request)
+	}
+}
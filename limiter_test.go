@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func waitForWaiters(t *testing.T, l *fairLimiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		l.mu.Lock()
+		got := len(l.waiters)
+		l.mu.Unlock()
+		if got == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("limiter never reached %d waiters", n)
+}
+
+func TestFairLimiterOrder(t *testing.T) {
+	l := &fairLimiter{}
+	if !l.acquire(1, 2, time.Second) {
+		t.Fatal("first acquire failed")
+	}
+	order := make(chan string, 2)
+	for i, name := range []string{"a", "b"} {
+		name := name
+		go func() {
+			if l.acquire(1, 2, 5*time.Second) {
+				order <- name
+			}
+		}()
+		waitForWaiters(t, l, i+1)
+	}
+	if l.acquire(1, 2, time.Second) {
+		t.Fatal("acquire succeeded with a full queue")
+	}
+
+	l.release(1)
+	if got := <-order; got != "a" {
+		t.Fatalf("first waiter = %s, want a", got)
+	}
+	l.release(1)
+	if got := <-order; got != "b" {
+		t.Fatalf("second waiter = %s, want b", got)
+	}
+	l.release(1)
+	if l.active != 0 || len(l.waiters) != 0 {
+		t.Errorf("after release: active = %d, waiters = %d", l.active, len(l.waiters))
+	}
+}
+
+func TestFairLimiterTimeout(t *testing.T) {
+	l := &fairLimiter{}
+	l.acquire(1, 1, time.Second)
+	if l.acquire(1, 1, 20*time.Millisecond) {
+		t.Fatal("acquire succeeded while the slot was taken")
+	}
+	if len(l.waiters) != 0 {
+		t.Errorf("timed out waiter left in queue")
+	}
+	if l.acquire(1, 0, time.Second) {
+		t.Error("acquire queued with TOOL_QUEUE_SIZE=0")
+	}
+}
+
+// 同时到达的调用超过上限时排队，队列满时直接返回繁忙
+func TestLimiterQueuesConcurrentCalls(t *testing.T) {
+	t.Setenv("TOOL_MAX_CONCURRENCY", "1")
+	t.Setenv("TOOL_QUEUE_SIZE", "1")
+	t.Setenv("TOOL_QUEUE_TIMEOUT", "5")
+	t.Setenv("TOOL_CONCURRENCY_LIMITS", "")
+	limiters.global = &fairLimiter{}
+
+	started := make(chan string, 3)
+	release := make(chan struct{})
+	s := newToolServer("test", "1.0")
+	s.AddTool(mcp.NewTool("slow"), limitHandler("slow", func(request map[string]interface{}) (*mcp.CallToolResult, error) {
+		n, _ := request["n"].(string)
+		started <- n
+		<-release
+		return mcp.NewToolResultText("done " + n), nil
+	}))
+
+	type response struct {
+		id      int
+		text    string
+		isError bool
+	}
+	responses := make(chan response, 3)
+	conn := &mcpConn{write: func(msg []byte) error {
+		var m struct {
+			ID     int `json:"id"`
+			Result struct {
+				IsError bool `json:"isError"`
+				Content []struct {
+					Text string `json:"text"`
+				} `json:"content"`
+			} `json:"result"`
+		}
+		json.Unmarshal(msg, &m)
+		responses <- response{m.ID, m.Result.Content[0].Text, m.Result.IsError}
+		return nil
+	}}
+	call := func(id int, n string) {
+		go dispatch(s, conn, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":"slow","arguments":{"n":%q}}}`, id, n)))
+	}
+	next := func() response {
+		select {
+		case r := <-responses:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("no response")
+		}
+		return response{}
+	}
+
+	call(1, "1")
+	if got := <-started; got != "1" {
+		t.Fatalf("started %s, want 1", got)
+	}
+	call(2, "2")
+	waitForWaiters(t, limiters.global, 1)
+
+	call(3, "3")
+	if r := next(); r.id != 3 || !r.isError || !strings.Contains(r.text, "服务器繁忙") {
+		t.Fatalf("third call = %+v, want busy error", r)
+	}
+
+	close(release)
+	done := map[int]string{}
+	for i := 0; i < 2; i++ {
+		r := next()
+		if r.isError {
+			t.Fatalf("call %d failed: %s", r.id, r.text)
+		}
+		done[r.id] = r.text
+	}
+	if done[1] != "done 1" || done[2] != "done 2" {
+		t.Errorf("responses = %v", done)
+	}
+}
+
+// 处理函数 panic 时只有这次调用返回内部错误；调用上下文能取得 initialize 中的客户端名称
+func TestDispatchRecoversAndTracksCaller(t *testing.T) {
+	s := newToolServer("test", "1.0")
+	s.AddTool(mcp.NewTool("boom"), func(map[string]interface{}) (*mcp.CallToolResult, error) {
+		panic("boom")
+	})
+	// 经过中间件后仍能取得调用上下文，参数中只有客户端传入的键
+	s.AddTool(mcp.NewTool("whoami"), auditHandler("whoami", limitHandler("whoami", scrubHandler(func(request map[string]interface{}) (*mcp.CallToolResult, error) {
+		keys := make([]string, 0, len(request))
+		for k := range request {
+			keys = append(keys, k)
+		}
+		return mcp.NewToolResultText(clientOf(callOf(request)) + " " + strings.Join(keys, ",")), nil
+	}))))
+
+	var out []map[string]interface{}
+	conn := &mcpConn{write: func(msg []byte) error {
+		var m map[string]interface{}
+		json.Unmarshal(msg, &m)
+		out = append(out, m)
+		return nil
+	}}
+	send := func(id int, method, params string) map[string]interface{} {
+		out = nil
+		dispatch(s, conn, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":%q,"params":%s}`, id, method, params)))
+		if len(out) != 1 {
+			t.Fatalf("%s: got %d messages, want 1", method, len(out))
+		}
+		return out[0]
+	}
+
+	send(1, "initialize", `{"protocolVersion":"2024-11-05","clientInfo":{"name":"tester","version":"0.1"},"capabilities":{}}`)
+
+	resp := send(2, "tools/call", `{"name":"boom","arguments":{}}`)
+	errObj, _ := resp["error"].(map[string]interface{})
+	if errObj == nil || int(errObj["code"].(float64)) != mcp.INTERNAL_ERROR || resp["id"].(float64) != 2 {
+		t.Fatalf("panic response = %v", resp)
+	}
+
+	resp = send(3, "tools/call", `{"name":"whoami","arguments":{"database":"shop"}}`)
+	content := resp["result"].(map[string]interface{})["content"].([]interface{})
+	if got := content[0].(map[string]interface{})["text"]; got != "tester/0.1 database" {
+		t.Errorf("whoami = %q, want client tester/0.1 and only the database argument", got)
+	}
+	calls.Lock()
+	pending := len(calls.items)
+	calls.Unlock()
+	if pending != 0 {
+		t.Errorf("%d calls still registered", pending)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// 会话限制默认值，可通过 QUERY_MAX_EXECUTION_TIME（毫秒）/ QUERY_LOCK_WAIT_TIMEOUT（秒）调整，设为 0 表示不限制
+const (
+	defaultMaxExecutionTime = 30000
+	defaultLockWaitTimeout  = 10
+)
+
+// errMaxExecutionTime MySQL 因超过 max_execution_time 中断查询的错误码
+const errMaxExecutionTime = 3024
+
+// queryLimits 每次取出连接时设置的会话变量，0 表示不设置
+type queryLimits struct {
+	maxExecutionTime int  // max_execution_time，毫秒，只对 SELECT 生效
+	lockWaitTimeout  int  // innodb_lock_wait_timeout 和 lock_wait_timeout，秒
+	selectLimit      int  // sql_select_limit，没有 LIMIT 的 SELECT 最多返回的行数
+	readOnly         bool // transaction_read_only
+}
+
+func loadQueryLimits() queryLimits {
+	return queryLimits{
+		maxExecutionTime: getEnvLimit("QUERY_MAX_EXECUTION_TIME", defaultMaxExecutionTime),
+		lockWaitTimeout:  getEnvLimit("QUERY_LOCK_WAIT_TIMEOUT", defaultLockWaitTimeout),
+		selectLimit:      getEnvLimit("QUERY_SQL_SELECT_LIMIT", 0),
+		readOnly:         !strings.EqualFold(getEnv("QUERY_READ_ONLY_TRANSACTION", "true"), "false"),
+	}
+}
+
+// getEnvLimit 读取非负整数配置，0 表示关闭，未设置或无效时使用默认值
+func getEnvLimit(key string, defaultValue int) int {
+	if n, err := strconv.Atoi(lookupSetting(key)); err == nil && n >= 0 {
+		return n
+	}
+	return defaultValue
+}
+
+// assignments 返回 SET SESSION 的赋值列表和恢复默认值的列表，readOnly 为 false 时不设置只读事务（由会话自己决定）
+func (l queryLimits) assignments(readOnly bool) (set, reset []string) {
+	add := func(name string, value string) {
+		set = append(set, name+" = "+value)
+		reset = append(reset, name+" = DEFAULT")
+	}
+	if l.maxExecutionTime > 0 {
+		add("max_execution_time", strconv.Itoa(l.maxExecutionTime))
+	}
+	if l.lockWaitTimeout > 0 {
+		add("innodb_lock_wait_timeout", strconv.Itoa(l.lockWaitTimeout))
+		add("lock_wait_timeout", strconv.Itoa(l.lockWaitTimeout))
+	}
+	if l.selectLimit > 0 {
+		add("sql_select_limit", strconv.Itoa(l.selectLimit))
+	}
+	if readOnly && l.readOnly {
+		add("transaction_read_only", "ON")
+	}
+	return set, reset
+}
+
+// applyQueryLimits 在连接上设置会话限制，返回恢复默认值的函数。
+// 恢复失败时丢弃该连接，避免带着限制回到连接池被写入操作复用
+func applyQueryLimits(ctx context.Context, conn *sql.Conn, readOnly bool) (func(), error) {
+	set, reset := loadQueryLimits().assignments(readOnly)
+	if len(set) == 0 {
+		return func() {}, nil
+	}
+	if _, err := conn.ExecContext(ctx, "SET SESSION "+strings.Join(set, ", ")); err != nil {
+		return nil, fmt.Errorf("设置会话限制失败: %v（可通过 QUERY_MAX_EXECUTION_TIME / QUERY_LOCK_WAIT_TIMEOUT 等设为 0 关闭）", err)
+	}
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), "SET SESSION "+strings.Join(reset, ", ")); err != nil {
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+	}, nil
+}
+
+// checkoutConn 从连接池（主库或从库）取出一个连接并设置只读查询的会话限制，用完后调用 release 恢复并归还
+func checkoutConn(ctx context.Context, pool *sql.DB) (conn *sql.Conn, release func(), err error) {
+	return checkoutLimitedConn(ctx, pool, true)
+}
+
+// checkoutWriteConn 从主库取出一个设置了锁等待等会话限制的连接，供受控写入的试运行和提交使用
+func checkoutWriteConn(ctx context.Context) (conn *sql.Conn, release func(), err error) {
+	return checkoutLimitedConn(ctx, db, false)
+}
+
+func checkoutLimitedConn(ctx context.Context, pool *sql.DB, readOnly bool) (conn *sql.Conn, release func(), err error) {
+	conn, err = pool.Conn(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取连接失败: %v", err)
+	}
+	restore, err := applyQueryLimits(ctx, conn, readOnly)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, func() {
+		restore()
+		conn.Close()
+	}, nil
+}
+
+// limitErrorHint 查询因会话限制被中断时补充说明
+func limitErrorHint(err error) string {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) && myErr.Number == errMaxExecutionTime {
+		return fmt.Sprintf("（超过 QUERY_MAX_EXECUTION_TIME=%dms）", loadQueryLimits().maxExecutionTime)
+	}
+	return ""
+}
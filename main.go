@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"sync"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/mark3labs/mcp-go/mcp"
@@ -14,52 +17,142 @@ import (
 var db *sql.DB
 
 func main() {
-	// 从环境变量获取数据库连接信息
-	dbHost := getEnv("MYSQL_HOST", "localhost")
-	dbPort := getEnv("MYSQL_PORT", "3306")
-	dbUser := getEnv("MYSQL_USER", "root")
-	dbPass := getEnv("MYSQL_PASSWORD", "root")
-	dbName := getEnv("MYSQL_DATABASE", "")
-
-	// 构建 DSN
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&charset=utf8mb4",
-		dbUser, dbPass, dbHost, dbPort, dbName)
-
-	// 连接数据库
-	var err error
-	db, err = sql.Open("mysql", dsn)
+	// 日志中不出现密码等密钥
+	log.SetOutput(scrubWriter{os.Stderr})
+
+	// 环境变量未设置的项从配置文件（CONFIG_FILE）读取，文件修改或收到 SIGHUP 后重新加载
+	if err := loadConfigFile(); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	registerConfiguredSecrets()
+
+	// 数据库只能经跳板机访问时先建立 SSH 隧道
+	if err := openTunnel(); err != nil {
+		log.Fatalf("Failed to open SSH tunnel: %v", err)
+	}
+
+	// 连接数据库。sql.Open 不会建立连接，数据库暂时不可用时服务照常启动并在后台重连
+	network, addr := primaryAddr()
+	dsn, err := mysqlDSN(network, addr)
+	if err != nil {
+		log.Fatalf("Invalid connection settings: %v", err)
+	}
+	db, err = openMySQL(dsn)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer db.Close()
+	configurePool(db)
+	watchPrimary(addr)
 
-	// 测试连接
-	if err := db.Ping(); err != nil {
-		log.Fatalf("Failed to ping database: %v", err)
+	// 只读查询可路由到从库
+	if err := openReplicas(); err != nil {
+		log.Fatalf("Failed to open replicas: %v", err)
 	}
 
 	// 创建 MCP 服务器
-	s := server.NewMCPServer(
+	s := newToolServer(
 		"MySQL MCP Server",
 		"2.0.0",
+		server.WithLogging(),
 	)
 
-	// 注册工具
-	registerTools(s)
+	// 注册工具，每次调用都经过审计、连接检查和并发限制中间件
+	registerTools(wrappedTools{s})
+	watchConfig()
 
-	// 启动服务器
-	if err := server.ServeStdio(s); err != nil {
+	// 启动服务器，工具执行期间可通过同一输出发送进度通知
+	if err := serveStdio(s); err != nil {
 		log.Fatalf("Server error: %v", err)
 	}
 }
 
-func registerTools(s *server.MCPServer) {
+// toolRegistry 注册工具的接口，由 wrappedTools 实现
+type toolRegistry interface {
+	AddTool(tool mcp.Tool, handler server.ToolHandlerFunc)
+}
+
+// wrappedTools 注册工具时为每个处理函数套上中间件。审计在最外层，
+// 因繁忙或数据库不可用被拒绝的调用也会记录，耗时包含排队时间；数据库不可用时不占用排队名额
+type wrappedTools struct {
+	*toolServer
+}
+
+func (w wrappedTools) AddTool(tool mcp.Tool, handler server.ToolHandlerFunc) {
+	// 启动时被禁用的工具不注册，客户端看不到；之后重新启用需要重启
+	if !toolEnabled(tool.Name) {
+		toolSet.Lock()
+		toolSet.unregistered = append(toolSet.unregistered, tool.Name)
+		toolSet.Unlock()
+		return
+	}
+	w.toolServer.AddTool(tool, auditHandler(tool.Name, enabledHandler(tool.Name, availabilityHandler(tool.Name, limitHandler(tool.Name, scrubHandler(handler))))))
+}
+
+// toolNameSet 只记录工具名称的 toolRegistry，用于校验配置中的工具名
+type toolNameSet map[string]bool
+
+func (t toolNameSet) AddTool(tool mcp.Tool, _ server.ToolHandlerFunc) {
+	t[tool.Name] = true
+}
+
+var toolSet struct {
+	sync.Mutex
+	once         sync.Once
+	names        toolNameSet
+	unregistered []string // 启动时因配置禁用而未注册的工具
+}
+
+func knownTool(name string) bool {
+	toolSet.once.Do(func() {
+		toolSet.names = toolNameSet{}
+		registerTools(toolSet.names)
+	})
+	return toolSet.names[name]
+}
+
+func unregisteredTools() []string {
+	toolSet.Lock()
+	defer toolSet.Unlock()
+	return append([]string(nil), toolSet.unregistered...)
+}
+
+// toolEnabled 按 TOOLS_ENABLED（为空时全部启用）和 TOOLS_DISABLED 判断工具是否可用
+func toolEnabled(name string) bool {
+	listed := func(key string) (found bool, empty bool) {
+		names := splitPatterns(getEnv(key, ""))
+		for _, n := range names {
+			if n == name {
+				return true, false
+			}
+		}
+		return false, len(names) == 0
+	}
+	if found, empty := listed("TOOLS_ENABLED"); !found && !empty {
+		return false
+	}
+	found, _ := listed("TOOLS_DISABLED")
+	return !found
+}
+
+// enabledHandler 配置重新加载后被禁用的工具直接返回错误
+func enabledHandler(name string, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(request map[string]interface{}) (*mcp.CallToolResult, error) {
+		if !toolEnabled(name) {
+			return mcp.NewToolResultError(fmt.Sprintf("工具 %s 已在配置中禁用（tools.enabled / tools.disabled）", name)), nil
+		}
+		return handler(request)
+	}
+}
+
+func registerTools(s toolRegistry) {
 	// 1. 列出所有数据库
 	s.AddTool(mcp.NewTool("list_databases",
 		mcp.WithDescription("当用户询问“有哪些数据库”、“列出全部数据库”、“show databases”时调用。返回 MySQL 中的数据库列表。"),
 		mcp.WithString("pattern",
 			mcp.Description("可选的过滤模式，使用 SQL LIKE 语法"),
 		),
+		withRoute(),
 	), listDatabases)
 
 	// 2. 列出数据库中的所有表
@@ -69,6 +162,7 @@ func registerTools(s *server.MCPServer) {
 			mcp.Description("数据库名称"),
 			mcp.Required(),
 		),
+		withRoute(),
 	), listTables)
 
 	// 3. 查看表结构
@@ -82,20 +176,49 @@ func registerTools(s *server.MCPServer) {
 			mcp.Description("表名称"),
 			mcp.Required(),
 		),
+		withRoute(),
 	), describeTable)
 
 	// 4. 执行查询
 	s.AddTool(mcp.NewTool("execute_query",
-		mcp.WithDescription("当用户问“执行 SQL”、“查询数据”、“select 语句”、“运行 SQL”时调用。仅用于执行 SELECT/SHOW/DESCRIBE。"),
+		mcp.WithDescription("当用户问“执行 SQL”、“查询数据”、“select 语句”、“运行 SQL”时调用。仅用于执行 SELECT/SHOW/DESCRIBE。语句中的值应使用 ? 占位符并通过 args 传入，不要拼接到 SQL 中。"),
 		mcp.WithString("query",
 			mcp.Description("要执行的 SQL 查询语句"),
 			mcp.Required(),
 		),
+		withArray("args",
+			mcp.Description(`可选，绑定到 ? 占位符的参数数组，按顺序对应。普通值按 JSON 类型绑定（字符串、数字、布尔、null）；
+日期时间、二进制、大整数和精确小数使用 {"type": "datetime|date|bytes|int|decimal|number|string|bool|null", "value": ...}，
+bytes 可带 "encoding": "base64|hex"，也接受 base64:... / 0x... 形式。例如 [42, "abc", {"type": "datetime", "value": "2024-01-01T00:00:00Z"}]`),
+		),
 		mcp.WithNumber("limit",
-			mcp.Description("返回最大行数（默认100）"),
+			mcp.Description("每页最大行数（默认100）。结果还有剩余时返回 next_page_token，用 next_page 继续读取"),
+		),
+		mcp.WithString("format",
+			mcp.Description("结果格式：json（按列顺序的数组）/ jsonl / csv / tsv / markdown。文本格式中 NULL 输出为 NULL"),
+			mcp.DefaultString("json"),
+			mcp.Enum(resultFormats...),
+		),
+		mcp.WithString("binary_encoding",
+			mcp.Description("二进制列（BLOB / BINARY / VARBINARY）的编码：base64（输出 base64:...）或 hex（输出 0x...）"),
+			mcp.DefaultString("base64"),
+			mcp.Enum(binaryEncodings...),
 		),
+		mcp.WithString("session_id",
+			mcp.Description("可选，begin_session 返回的会话 ID，在该会话的事务中执行（翻页也在同一会话中）"),
+		),
+		withRoute(),
 	), executeQuery)
 
+	// 4.1 读取查询结果的下一页
+	s.AddTool(mcp.NewTool("next_page",
+		mcp.WithDescription("当 execute_query 的结果中 has_more 为 true、用户需要“继续”、“下一页”、“更多结果”时调用，传入上一页返回的 next_page_token。"),
+		mcp.WithString("token",
+			mcp.Description("上一页返回的 next_page_token"),
+			mcp.Required(),
+		),
+	), nextPage)
+
 	// 5. 查看表索引
 	s.AddTool(mcp.NewTool("show_indexes",
 		mcp.WithDescription("当用户问“索引是什么”、“怎么看索引”、“show index”、“索引结构”时调用。返回索引字段和类型。"),
@@ -107,6 +230,7 @@ func registerTools(s *server.MCPServer) {
 			mcp.Description("表名称"),
 			mcp.Required(),
 		),
+		withRoute(),
 	), showIndexes)
 
 	// 6. 获取表统计信息
@@ -119,6 +243,7 @@ func registerTools(s *server.MCPServer) {
 		mcp.WithString("table",
 			mcp.Description("表名称，可选。不指定则返回所有表的统计"),
 		),
+		withRoute(),
 	), getTableStats)
 
 	// 7. 外键关系
@@ -132,6 +257,7 @@ func registerTools(s *server.MCPServer) {
 			mcp.Description("表名称"),
 			mcp.Required(),
 		),
+		withRoute(),
 	), showForeignKeys)
 
 	// 8. 搜索表或字段
@@ -149,6 +275,7 @@ func registerTools(s *server.MCPServer) {
 			mcp.Description("table / column / both"),
 			mcp.DefaultString("both"),
 		),
+		withRoute(),
 	), searchSchema)
 
 	// 9. 查看建表语句
@@ -162,6 +289,7 @@ func registerTools(s *server.MCPServer) {
 			mcp.Description("表名称"),
 			mcp.Required(),
 		),
+		withRoute(),
 	), showCreateTable)
 
 	// 10. 分析字段值分布
@@ -179,6 +307,7 @@ func registerTools(s *server.MCPServer) {
 			mcp.Description("字段名称"),
 			mcp.Required(),
 		),
+		withRoute(),
 	), analyzeColumn)
 
 	// 11. 查看触发器
@@ -191,6 +320,7 @@ func registerTools(s *server.MCPServer) {
 		mcp.WithString("table",
 			mcp.Description("表名称，可选"),
 		),
+		withRoute(),
 	), showTriggers)
 
 	// 12. 查看系统变量
@@ -199,6 +329,7 @@ func registerTools(s *server.MCPServer) {
 		mcp.WithString("pattern",
 			mcp.Description("变量名过滤条件"),
 		),
+		withRoute(),
 	), showVariables)
 
 	// 13. 查看运行状态
@@ -207,11 +338,13 @@ func registerTools(s *server.MCPServer) {
 		mcp.WithString("pattern",
 			mcp.Description("状态名过滤模式"),
 		),
+		withRoute(),
 	), showStatus)
 
 	// 14. 查看进程列表
 	s.AddTool(mcp.NewTool("show_processlist",
 		mcp.WithDescription("当用户问“有哪些 SQL 在执行”、“阻塞查询”、“连接状态”时调用。"),
+		withRoute(),
 	), showProcesslist)
 
 	// 15. 查看表字符集
@@ -225,6 +358,7 @@ func registerTools(s *server.MCPServer) {
 			mcp.Description("表名称"),
 			mcp.Required(),
 		),
+		withRoute(),
 	), showTableCharset)
 
 	// 16. 辅助ai阅读网页
@@ -249,7 +383,7 @@ func registerTools(s *server.MCPServer) {
 	//17.生成文档
 	s.AddTool(mcp.NewTool("document_generator",
 		mcp.WithDescription(`
-		生成标准化 Markdown 文档工具。
+		生成标准化文档工具。
 		支持类型：
 		- api: 接口文档
 		- table: 表结构文档
@@ -258,8 +392,11 @@ func registerTools(s *server.MCPServer) {
 		
 		使用说明：
 		1. 输入 type/title/content。
-		2. 输出 Markdown 格式文档。
-		3. AI 可直接调用生成规范化文档。
+		2. 通过 format 选择输出格式：markdown / html / asciidoc / confluence。
+		3. 指定 output_file 时写入 DOC_OUTPUT_DIR 目录下的文件，返回文件路径；文件已存在时需传入 overwrite=true 才会覆盖。
+		4. 指定 spec_file（API_SPEC_DIR 下 OpenAPI 3 / Swagger 2 的 JSON 或 YAML 文件）时，根据接口定义生成“API 接口设计”章节；
+		   type 为 api 时仅输出该章节。
+		5. AI 可直接调用生成规范化文档。
 	`),
 		mcp.WithString("type",
 			mcp.Description("文档类型：api / table / module / custom"),
@@ -274,8 +411,19 @@ func registerTools(s *server.MCPServer) {
 			mcp.Required(),
 		),
 		mcp.WithString("format",
-			mcp.Description("输出格式（目前仅支持 markdown）"),
+			mcp.Description("输出格式：markdown / html / asciidoc / confluence"),
 			mcp.DefaultString("markdown"),
+			mcp.Enum("markdown", "html", "asciidoc", "confluence"),
+		),
+		mcp.WithString("spec_file",
+			mcp.Description("可选，OpenAPI 3 / Swagger 2 定义文件名（JSON 或 YAML，相对于 API_SPEC_DIR）"),
+		),
+		mcp.WithString("output_file",
+			mcp.Description("可选，输出文件名（相对于 DOC_OUTPUT_DIR），不指定则直接返回文档内容"),
+		),
+		mcp.WithBoolean("overwrite",
+			mcp.Description("output_file 已存在时是否覆盖，默认拒绝覆盖"),
+			mcp.DefaultBool(false),
 		),
 	), documentGeneratorHandler)
 
@@ -290,11 +438,283 @@ func registerTools(s *server.MCPServer) {
 		mcp.WithNumber("iterations", mcp.Description("每线程执行次数"), mcp.Required()),
 		mcp.WithString("random_param_json", mcp.Description("随机参数规则 JSON 字符串，例如 '{\"id\":\"1-1000\"}'")),
 	), concurrentRequestHandler)
+
+	// 19. 结构变更日志
+	s.AddTool(mcp.NewTool("schema_changelog",
+		mcp.WithDescription("当用户要求“保存表结构快照”、“对比数据库结构”、“生成结构变更日志”、“发布说明里的数据库变更”时调用。action=snapshot 保存当前结构到 JSON 快照文件，action=diff 将当前结构与快照对比并输出 Markdown 变更日志。"),
+		mcp.WithString("action",
+			mcp.Description("snapshot / diff"),
+			mcp.Required(),
+			mcp.Enum("snapshot", "diff"),
+		),
+		mcp.WithString("database",
+			mcp.Description("数据库名称。snapshot 时必需；diff 时为对比对象，不指定则使用快照所属的数据库"),
+		),
+		mcp.WithString("snapshot_file",
+			mcp.Description("快照文件名（相对于 SCHEMA_SNAPSHOT_DIR）。diff 时必需；snapshot 时不指定则自动生成"),
+		),
+		mcp.WithString("format",
+			mcp.Description("变更日志输出格式：markdown / html / asciidoc / confluence"),
+			mcp.DefaultString("markdown"),
+		),
+		withRoute(),
+	), schemaChangelog)
+
+	// 20. 导出查询结果到文件
+	s.AddTool(mcp.NewTool("export_query",
+		mcp.WithDescription("当用户需要“导出数据”、“导出到文件”、“大批量提取”、“导出 CSV / Parquet”时调用。将只读查询结果流式写入 EXPORT_DIR 下的文件（csv / jsonl / parquet，可 gzip 压缩），只返回路径、行数、字节数和 SHA-256 校验和，不返回数据本身。客户端在 _meta.progressToken 中给出进度令牌时，导出过程中以 MCP 进度通知（notifications/progress）报告已写入的行数；未给出令牌时改为发送日志通知。"),
+		mcp.WithString("query",
+			mcp.Description("要导出的 SQL 查询语句（仅 SELECT/SHOW/DESCRIBE）"),
+			mcp.Required(),
+		),
+		mcp.WithString("format",
+			mcp.Description("文件格式：csv / jsonl / parquet"),
+			mcp.DefaultString("csv"),
+			mcp.Enum(exportFormats...),
+		),
+		mcp.WithBoolean("gzip",
+			mcp.Description("是否压缩：csv / jsonl 输出 .gz 文件，parquet 使用 gzip 列压缩"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithString("file_name",
+			mcp.Description("可选，输出文件名（相对于 EXPORT_DIR），不指定则按时间生成；文件已存在时拒绝覆盖"),
+		),
+		mcp.WithNumber("max_rows",
+			mcp.Description("最多导出的行数，不能超过 EXPORT_MAX_ROWS"),
+		),
+		mcp.WithNumber("max_bytes",
+			mcp.Description("文件大小上限（字节），不能超过 EXPORT_MAX_BYTES"),
+		),
+		mcp.WithString("binary_encoding",
+			mcp.Description("csv / jsonl 中二进制列的编码：base64 或 hex；parquet 直接写入原始字节"),
+			mcp.DefaultString("base64"),
+			mcp.Enum(binaryEncodings...),
+		),
+		withRoute(),
+	), exportQuery)
+
+	// 21. 查询库：列出已保存的查询
+	s.AddTool(mcp.NewTool("list_saved_queries",
+		mcp.WithDescription("当用户提到“常用查询”、“查询库”、“有哪些保存的查询”，或在自己写 SQL 之前，先调用本工具查看 SAVED_QUERY_DIR 中已有的命名查询及其参数。"),
+		mcp.WithString("keyword",
+			mcp.Description("可选，按名称或描述过滤"),
+		),
+	), listSavedQueries)
+
+	// 22. 查询库：执行已保存的查询
+	s.AddTool(mcp.NewTool("run_saved_query",
+		mcp.WithDescription("按名称执行查询库中的查询，例如 orders_by_customer(customer_id=42)。参数按查询定义校验类型、必填和可选值；结果格式与分页同 execute_query。"),
+		mcp.WithString("name",
+			mcp.Description("查询名称（list_saved_queries 返回的 name）"),
+			mcp.Required(),
+		),
+		withObject("params",
+			mcp.Description(`查询参数，如 {"customer_id": 42}`),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("每页最大行数（默认100）"),
+		),
+		mcp.WithString("format",
+			mcp.Description("结果格式：json / jsonl / csv / tsv / markdown"),
+			mcp.DefaultString("json"),
+			mcp.Enum(resultFormats...),
+		),
+		mcp.WithString("binary_encoding",
+			mcp.Description("二进制列的编码：base64 或 hex"),
+			mcp.DefaultString("base64"),
+			mcp.Enum(binaryEncodings...),
+		),
+		mcp.WithString("session_id",
+			mcp.Description("可选，begin_session 返回的会话 ID"),
+		),
+		withRoute(),
+	), runSavedQuery)
+
+	// 23. 查询历史
+	s.AddTool(mcp.NewTool("query_history",
+		mcp.WithDescription("当用户问“之前执行过哪些查询”、“查询历史”、“刚才那条 SQL”、“哪些查询报错了”时调用。返回本地记录的查询历史（最新在前），包含语句、指纹、耗时、行数、错误和调用方。"),
+		mcp.WithString("keyword",
+			mcp.Description("可选，按语句内容过滤"),
+		),
+		mcp.WithString("fingerprint",
+			mcp.Description("可选，按规范化指纹过滤，找出同一类查询"),
+		),
+		mcp.WithString("tool",
+			mcp.Description("可选，按发起的工具过滤，如 execute_query / run_saved_query / export_query"),
+		),
+		mcp.WithBoolean("errors_only",
+			mcp.Description("只返回执行失败的记录"),
+		),
+		mcp.WithString("since",
+			mcp.Description("可选，只返回该时间之后的记录，如 2024-01-02 或 2024-01-02T15:04:05Z"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("最多返回的记录数（默认20）"),
+		),
+	), queryHistory)
+
+	// 24. 重放历史查询
+	s.AddTool(mcp.NewTool("replay_query",
+		mcp.WithDescription("当用户要求“再执行一次”、“重跑之前的查询”时调用。按 query_history 返回的 id 使用原语句和参数重新执行，结果格式与分页同 execute_query。"),
+		mcp.WithString("id",
+			mcp.Description("历史记录 ID"),
+			mcp.Required(),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("每页最大行数（默认100）"),
+		),
+		mcp.WithString("format",
+			mcp.Description("结果格式：json / jsonl / csv / tsv / markdown"),
+			mcp.DefaultString("json"),
+			mcp.Enum(resultFormats...),
+		),
+		mcp.WithString("binary_encoding",
+			mcp.Description("二进制列的编码：base64 或 hex"),
+			mcp.DefaultString("base64"),
+			mcp.Enum(binaryEncodings...),
+		),
+		mcp.WithString("session_id",
+			mcp.Description("可选，begin_session 返回的会话 ID，在该会话的事务中重放"),
+		),
+		withRoute(),
+	), replayQuery)
+
+	// 25. 受控写入
+	s.AddTool(mcp.NewTool("execute_write",
+		mcp.WithDescription(`执行 UPDATE / DELETE / INSERT / REPLACE，仅在服务端设置 WRITE_ENABLED=true 时可用。分两步：
+1. 不带 confirm_token 调用：UPDATE/DELETE 和 INSERT … SELECT 先用等价的 SELECT COUNT(*) 预览影响行数，
+   再在事务中试运行并回滚，返回实际影响行数、修改前后的样本行和确认令牌。
+   涉及非 InnoDB 表时无法试运行，须在用户确认后传入 allow_non_transactional=true 才签发令牌。
+2. 把预览结果告诉用户，得到确认后，用相同的 query 和 args 加上 confirm_token 再次调用才会提交。
+令牌只能使用一次，过期后需重新预览；提交时影响行数与试运行不一致会自动回滚。
+传入 read_write 会话的 session_id 时，两步都在会话事务中进行，确认后的修改要等 commit_session 才真正提交。`),
+		mcp.WithString("query",
+			mcp.Description("要执行的写语句（单条）"),
+			mcp.Required(),
+		),
+		withArray("args",
+			mcp.Description("可选，绑定到 ? 占位符的参数，格式同 execute_query"),
+		),
+		mcp.WithString("confirm_token",
+			mcp.Description("预览返回的 confirmation_token，传入后提交"),
+		),
+		mcp.WithString("session_id",
+			mcp.Description("可选，mode=read_write 的会话 ID，预览和确认须使用同一会话"),
+		),
+		mcp.WithBoolean("allow_non_transactional",
+			mcp.Description("可选，涉及的表不支持事务（如 MyISAM）时，确认不经试运行直接写入，提交后无法回滚"),
+		),
+	), executeWrite)
+
+	// 26. 开启事务会话
+	s.AddTool(mcp.NewTool("begin_session",
+		mcp.WithDescription(`当需要多条查询看到同一时刻的一致数据，或多条写语句需要一起提交时调用。
+占用一个专用连接并执行 START TRANSACTION WITH CONSISTENT SNAPSHOT，返回 session_id；
+之后在 execute_query / run_saved_query / replay_query / execute_write 中传入 session_id 即在同一事务中执行。
+用完必须调用 commit_session 或 rollback_session；空闲超时的会话会被自动回滚。`),
+		mcp.WithString("mode",
+			mcp.Description("read_only（默认，READ ONLY 事务）或 read_write（需要 WRITE_ENABLED=true）"),
+			mcp.DefaultString("read_only"),
+			mcp.Enum("read_only", "read_write"),
+		),
+		mcp.WithString("isolation_level",
+			mcp.Description("可选，事务隔离级别，不传时使用服务器默认值"),
+			mcp.Enum("READ UNCOMMITTED", "READ COMMITTED", "REPEATABLE READ", "SERIALIZABLE"),
+		),
+	), beginSession)
+
+	// 27. 提交事务会话
+	s.AddTool(mcp.NewTool("commit_session",
+		mcp.WithDescription("提交会话中的事务并释放连接。read_write 会话中经 execute_write 确认的修改在此时才真正生效。"),
+		mcp.WithString("session_id",
+			mcp.Description("begin_session 返回的会话 ID"),
+			mcp.Required(),
+		),
+	), commitSession)
+
+	// 28. 回滚事务会话
+	s.AddTool(mcp.NewTool("rollback_session",
+		mcp.WithDescription("回滚会话中的事务并释放连接，撤销会话中的所有修改。"),
+		mcp.WithString("session_id",
+			mcp.Description("begin_session 返回的会话 ID"),
+			mcp.Required(),
+		),
+	), rollbackSession)
+
+	// 29. 复制状态
+	s.AddTool(mcp.NewTool("replication_status",
+		mcp.WithDescription("当用户问“主从复制是否正常”、“从库延迟多少”、“复制报错了吗”、“组复制成员状态”时调用。返回复制通道的 IO/SQL 线程状态、延迟、最近的错误、binlog 位点、GTID 集合、组复制成员，以及健康结论。"),
+		mcp.WithString("server",
+			mcp.Description("要查看的实例：primary（默认，MYSQL_HOST 指向的实例）或 MYSQL_REPLICAS 中的从库地址 host:port"),
+		),
+	), replicationStatus)
+
+	// 30. 健康检查
+	s.AddTool(mcp.NewTool("health_check",
+		mcp.WithDescription("当用户问“数据库连得上吗”、“服务是否正常”、“SSH 隧道状态”时调用。检查主库连通性和延迟，返回 SSH 隧道（跳板机）的连接状态、重连次数，以及各从库的健康检查结果。"),
+	), healthCheck)
+
+	// 31. 连接状态
+	s.AddTool(mcp.NewTool("connection_status",
+		mcp.WithDescription("当工具返回“数据库不可用”，或用户问“数据库连上了吗”、“什么时候重连”时调用。返回主库连接状态（connecting / connected / unavailable）、最近的错误、连续失败次数、下次重试时间、重连次数、连接池统计，以及 SSH 隧道和从库状态。不需要数据库连接即可调用。"),
+	), connectionStatus)
+}
+
+// withArray 声明数组类型的参数（当前 mcp-go 版本没有提供对应的选项）
+func withArray(name string, opts ...mcp.PropertyOption) mcp.ToolOption {
+	return func(t *mcp.Tool) {
+		schema := map[string]interface{}{
+			"type":  "array",
+			"items": map[string]interface{}{},
+		}
+		for _, opt := range opts {
+			opt(schema)
+		}
+		t.InputSchema.Properties[name] = schema
+	}
+}
+
+// withRoute 声明 route 参数，用于按调用指定主库或从库
+func withRoute() mcp.ToolOption {
+	return mcp.WithString("route",
+		mcp.Description("主从路由：auto（默认，元数据和只读查询优先走从库，show_processlist 等走主库）、primary 强制主库、replica 强制从库"),
+		mcp.Enum(routeAuto, routePrimary, routeReplica),
+	)
+}
+
+// withObject 声明对象类型的参数
+func withObject(name string, opts ...mcp.PropertyOption) mcp.ToolOption {
+	return func(t *mcp.Tool) {
+		schema := map[string]interface{}{
+			"type": "object",
+		}
+		for _, opt := range opts {
+			opt(schema)
+		}
+		t.InputSchema.Properties[name] = schema
+	}
+}
+
+// configurePool 连接池设置，主库和从库相同
+func configurePool(pool *sql.DB) {
+	pool.SetMaxOpenConns(getEnvInt("MYSQL_MAX_OPEN_CONNS", 10))
+	pool.SetMaxIdleConns(getEnvInt("MYSQL_MAX_IDLE_CONNS", 5))
+	pool.SetConnMaxLifetime(time.Duration(getEnvInt("MYSQL_CONN_MAX_LIFETIME", 300)) * time.Second)
+	pool.SetConnMaxIdleTime(time.Duration(getEnvInt("MYSQL_CONN_MAX_IDLE_TIME", 60)) * time.Second)
 }
 
+// getEnv 读取字符串配置，环境变量优先，其次是配置文件（CONFIG_FILE）
 func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+	if value := lookupSetting(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+// getEnvInt 读取正整数配置，未设置或无效时使用默认值
+func getEnvInt(key string, defaultValue int) int {
+	if n, err := strconv.Atoi(lookupSetting(key)); err == nil && n > 0 {
+		return n
+	}
+	return defaultValue
+}
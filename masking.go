@@ -0,0 +1,583 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maskActions 支持的脱敏方式
+var maskActions = []string{"redact", "partial", "hash", "tokenize"}
+
+// maskingConfig 脱敏规则文件（MASKING_RULES_FILE）的内容
+type maskingConfig struct {
+	Columns   []columnMaskRule `yaml:"columns"`
+	Detectors []*valueDetector `yaml:"detectors"`
+}
+
+// columnMaskRule 按列脱敏：column 为 db.table.column、table.column 或 column 形式的 glob 模式
+type columnMaskRule struct {
+	Column string `yaml:"column"`
+	Action string `yaml:"action"`
+}
+
+// valueDetector 按值识别敏感信息，只替换值中匹配的部分。
+// type 为内置检测器（email / phone / id_card / credit_card）或 regex
+type valueDetector struct {
+	Type    string `yaml:"type"`
+	Pattern string `yaml:"pattern"`
+	Action  string `yaml:"action"`
+
+	re       *regexp.Regexp
+	validate func(string) bool
+	digits   bool // 前后不能紧跟数字或字母，避免命中更长数字串的一部分
+}
+
+// builtinDetectors 内置检测器的正则和校验
+var builtinDetectors = map[string]struct {
+	pattern  string
+	validate func(string) bool
+}{
+	"email":       {`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`, nil},
+	"phone":       {`(?:\+?86[- ]?)?1[3-9]\d(?:[- ]?\d{4}){2}`, nil},
+	"id_card":     {`[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]`, validIDCard},
+	"credit_card": {`\d(?:[ -]?\d){12,18}`, validLuhn},
+}
+
+// builtinExact 整值匹配内置检测器的正则，用于列规则的部分遮盖
+var builtinExact = func() map[string]*regexp.Regexp {
+	exact := map[string]*regexp.Regexp{}
+	for name, builtin := range builtinDetectors {
+		exact[name] = regexp.MustCompile(`^(?:` + builtin.pattern + `)$`)
+	}
+	return exact
+}()
+
+// masker 当前生效的脱敏规则
+type masker struct {
+	columns   []columnMaskRule
+	detectors []*valueDetector
+}
+
+var maskingCache struct {
+	sync.Mutex
+	key    string
+	masker *masker
+}
+
+// loadMasker 读取 MASKING_RULES_FILE 和 MASKING_DETECTORS，未配置任何规则时返回 nil。
+// 规则文件按修改时间缓存，修改后下次调用自动生效
+func loadMasker() (*masker, error) {
+	file := getEnv("MASKING_RULES_FILE", "")
+	detectors := getEnv("MASKING_DETECTORS", "")
+	if file == "" && detectors == "" {
+		return nil, nil
+	}
+
+	key := file + "\x00" + detectors
+	if file != "" {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取脱敏规则失败: %v", err)
+		}
+		key += fmt.Sprintf("\x00%d\x00%d", info.ModTime().UnixNano(), info.Size())
+	}
+	maskingCache.Lock()
+	defer maskingCache.Unlock()
+	if maskingCache.key == key {
+		return maskingCache.masker, nil
+	}
+
+	var cfg maskingConfig
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取脱敏规则失败: %v", err)
+		}
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("解析脱敏规则 %s 失败: %v", file, err)
+		}
+	}
+	// MASKING_DETECTORS 是启用内置检测器的简写，使用 partial 脱敏
+	for _, name := range strings.Split(detectors, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cfg.Detectors = append(cfg.Detectors, &valueDetector{Type: name, Action: "partial"})
+		}
+	}
+
+	m := &masker{}
+	for i, rule := range cfg.Columns {
+		if rule.Column == "" {
+			return nil, fmt.Errorf("脱敏规则 columns[%d] 缺少 column", i)
+		}
+		if !validMaskAction(rule.Action) {
+			return nil, fmt.Errorf("脱敏规则 %s 的 action 必须是 %s", rule.Column, strings.Join(maskActions, " / "))
+		}
+		rule.Column = strings.ToLower(rule.Column)
+		m.columns = append(m.columns, rule)
+	}
+	for i, d := range cfg.Detectors {
+		if d.Action == "" {
+			d.Action = "partial"
+		}
+		if !validMaskAction(d.Action) {
+			return nil, fmt.Errorf("检测器 %s 的 action 必须是 %s", d.Type, strings.Join(maskActions, " / "))
+		}
+		pattern := d.Pattern
+		if builtin, ok := builtinDetectors[d.Type]; ok {
+			pattern, d.validate, d.digits = builtin.pattern, builtin.validate, d.Type != "email"
+		} else if d.Type != "regex" {
+			return nil, fmt.Errorf("detectors[%d]: 未知的检测器类型 %s（可选 email / phone / id_card / credit_card / regex）", i, d.Type)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil || pattern == "" {
+			return nil, fmt.Errorf("detectors[%d]: 正则无效: %v", i, err)
+		}
+		d.re = re
+		m.detectors = append(m.detectors, d)
+	}
+
+	maskingCache.key, maskingCache.masker = key, m
+	return m, nil
+}
+
+func validMaskAction(action string) bool {
+	for _, a := range maskActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// columnAction 返回列命中的第一条列规则的动作，未命中返回空
+func (m *masker) columnAction(database, table, column string) string {
+	full := strings.ToLower(database + "." + table + "." + column)
+	for _, rule := range m.columns {
+		target := full
+		switch strings.Count(rule.Column, ".") {
+		case 0:
+			target = strings.ToLower(column)
+		case 1:
+			target = strings.ToLower(table + "." + column)
+		}
+		if ok, _ := path.Match(rule.Column, target); ok {
+			return rule.Action
+		}
+	}
+	return ""
+}
+
+// detect 依次用检测器扫描文本，替换其中的敏感信息
+func (m *masker) detect(s string) string {
+	for _, d := range m.detectors {
+		matches := d.re.FindAllStringIndex(s, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		var sb strings.Builder
+		last := 0
+		for _, loc := range matches {
+			text := s[loc[0]:loc[1]]
+			if d.digits && (loc[0] > 0 && isSQLWordChar(s[loc[0]-1]) || loc[1] < len(s) && isSQLWordChar(s[loc[1]])) {
+				continue
+			}
+			if d.validate != nil && !d.validate(text) {
+				continue
+			}
+			sb.WriteString(s[last:loc[0]])
+			sb.WriteString(applyMask(d.Action, text, d.Type))
+			last = loc[1]
+		}
+		sb.WriteString(s[last:])
+		s = sb.String()
+	}
+	return s
+}
+
+// maskValue 按列规则或检测器处理一个已转换的值，NULL 保持不变
+func (m *masker) maskValue(action string, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if action != "" {
+		text := cellText(v)
+		if t, ok := v.(time.Time); ok {
+			text = formatTimestamp(t)
+		}
+		return applyMask(action, text, m.kindOf(text))
+	}
+	if len(m.detectors) == 0 {
+		return v
+	}
+	switch val := v.(type) {
+	case string:
+		return m.detect(val)
+	case json.RawMessage:
+		return json.RawMessage(m.detect(string(val)))
+	}
+	return v
+}
+
+// kindOf 整个值符合某个内置检测器时返回其类型，用于选择部分遮盖的方式
+func (m *masker) kindOf(s string) string {
+	for _, name := range []string{"email", "id_card", "credit_card", "phone"} {
+		validate := builtinDetectors[name].validate
+		if builtinExact[name].MatchString(s) && (validate == nil || validate(s)) {
+			return name
+		}
+	}
+	return ""
+}
+
+var maskSecret struct {
+	once sync.Once
+	key  []byte
+}
+
+// maskKey hash / tokenize 使用的 HMAC 密钥。未配置 MASKING_SECRET 时每次启动随机生成，令牌只在本次运行内稳定
+func maskKey() []byte {
+	if secret := getEnv("MASKING_SECRET", ""); secret != "" {
+		return []byte(secret)
+	}
+	maskSecret.once.Do(func() {
+		maskSecret.key = make([]byte, 32)
+		rand.Read(maskSecret.key)
+	})
+	return maskSecret.key
+}
+
+// applyMask 按动作脱敏文本，kind 为检测到的值类型
+func applyMask(action, s, kind string) string {
+	switch action {
+	case "redact":
+		return "[REDACTED]"
+	case "hash":
+		mac := hmac.New(sha256.New, maskKey())
+		mac.Write([]byte(s))
+		return "sha256:" + hex.EncodeToString(mac.Sum(nil))
+	case "tokenize":
+		mac := hmac.New(sha256.New, maskKey())
+		mac.Write([]byte(s))
+		return "tok_" + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(mac.Sum(nil)[:10]))
+	}
+	return partialMask(s, kind)
+}
+
+// partialMask 部分遮盖：邮箱保留首字符和域名，手机号保留前 3 后 4 位，身份证保留前 6 后 4 位，
+// 银行卡只保留后 4 位，其他值保留首尾各约四分之一
+func partialMask(s, kind string) string {
+	switch kind {
+	case "email":
+		if at := strings.LastIndex(s, "@"); at > 0 {
+			return s[:1] + "***" + s[at:]
+		}
+	case "phone":
+		return maskDigits(s, 3, 4)
+	case "id_card":
+		return maskDigits(s, 6, 4)
+	case "credit_card":
+		return maskDigits(s, 0, 4)
+	}
+
+	runes := []rune(s)
+	n := len(runes)
+	if n <= 1 {
+		return strings.Repeat("*", n)
+	}
+	keep := n / 4
+	if keep == 0 {
+		keep = 1
+	}
+	if n <= 3 {
+		return string(runes[:1]) + strings.Repeat("*", n-1)
+	}
+	return string(runes[:keep]) + strings.Repeat("*", n-2*keep) + string(runes[n-keep:])
+}
+
+// maskDigits 保留前 head 位和后 tail 位数字，其余数字替换为 *，分隔符不变
+func maskDigits(s string, head, tail int) string {
+	total := 0
+	for _, c := range s {
+		if c >= '0' && c <= '9' || c == 'X' || c == 'x' {
+			total++
+		}
+	}
+	// 国际区号不计入保留的前几位
+	prefix := ""
+	if strings.HasPrefix(s, "+86") {
+		prefix, s, total = "+86", s[3:], total-2
+	}
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	i := 0
+	for _, c := range s {
+		if c >= '0' && c <= '9' || c == 'X' || c == 'x' {
+			if i >= head && i < total-tail {
+				c = '*'
+			}
+			i++
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// validIDCard 校验 18 位身份证号的校验位
+func validIDCard(s string) bool {
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i, w := range weights {
+		sum += int(s[i]-'0') * w
+	}
+	return strings.ToUpper(s[17:]) == string("10X98765432"[sum%11])
+}
+
+// validLuhn 校验银行卡号的 Luhn 校验位
+func validLuhn(s string) bool {
+	var digits []int
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			digits = append(digits, int(c-'0'))
+		}
+	}
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return len(digits) >= 13 && sum%10 == 0
+}
+
+// resultMasker 一个结果集的脱敏器，actions 为每列命中的列规则动作
+type resultMasker struct {
+	m       *masker
+	actions []string
+}
+
+// newResultMasker 按查询引用的表和结果列解析出每列的脱敏动作，未配置规则时返回 nil
+func newResultMasker(query string, columns []string) (*resultMasker, error) {
+	m, err := loadMasker()
+	if err != nil || m == nil {
+		return nil, err
+	}
+	rm := &resultMasker{m: m, actions: make([]string, len(columns))}
+	if len(m.columns) == 0 {
+		return rm, nil
+	}
+
+	tokens := tokenizeSQL(query)
+	tables := resolveQueryTargets(tokens).tables
+	current := ""
+	for i, t := range tables {
+		if t[0] == "" {
+			if current == "" {
+				current, _ = currentDatabase(db)
+			}
+			tables[i][0] = current
+		}
+	}
+	for i, sources := range resultColumnSources(tokens, columns) {
+		for _, col := range sources {
+			if action := m.columnAction("", "", col); action != "" && len(tables) == 0 {
+				rm.actions[i] = action
+			}
+			for _, t := range tables {
+				if action := m.columnAction(t[0], t[1], col); action != "" {
+					rm.actions[i] = action
+					break
+				}
+			}
+			if rm.actions[i] != "" {
+				break
+			}
+		}
+	}
+	return rm, nil
+}
+
+// masks 第 i 列是否整列脱敏
+func (rm *resultMasker) masks(i int) bool {
+	return rm != nil && rm.actions[i] != ""
+}
+
+// alters 脱敏是否会改变第 i 列的值 v
+func (rm *resultMasker) alters(i int, v interface{}) bool {
+	if rm == nil {
+		return false
+	}
+	if rm.actions[i] != "" {
+		return true
+	}
+	s, ok := v.(string)
+	return ok && rm.m.detect(s) != s
+}
+
+func (rm *resultMasker) maskRows(rows [][]interface{}) {
+	if rm == nil {
+		return
+	}
+	for _, row := range rows {
+		for i, v := range row {
+			row[i] = rm.m.maskValue(rm.actions[i], v)
+		}
+	}
+}
+
+// maskRaw 对驱动返回的原始行脱敏，供导出使用：整列脱敏的值转为文本，其余文本值经检测器处理
+func (rm *resultMasker) maskRaw(values []interface{}, typeNames []string, binaryEncoding string) {
+	if rm == nil {
+		return
+	}
+	for i, raw := range values {
+		action := rm.actions[i]
+		if raw == nil || (action == "" && (len(rm.m.detectors) == 0 || isBinaryType(typeNames[i]))) {
+			continue
+		}
+		converted := convertValue(raw, typeNames[i], binaryEncoding)
+		masked := rm.m.maskValue(action, converted)
+		if action == "" && cellText(masked) == cellText(converted) {
+			continue
+		}
+		values[i] = []byte(cellText(masked))
+	}
+}
+
+// maskMeta 在列类型信息中标注脱敏方式，脱敏后的值均为字符串
+func (rm *resultMasker) maskMeta(types []columnMeta) {
+	for i := range types {
+		if rm.masks(i) {
+			types[i].Masked, types[i].Encoding = rm.actions[i], ""
+		}
+	}
+}
+
+// selectItem SELECT 列表中的一项
+type selectItem struct {
+	name    string   // 输出列名：别名或简单列名，表达式为空
+	star    bool     // * 或 t.*
+	sources []string // 表达式中引用的列名（小写）
+}
+
+// resultColumnSources 返回每个结果列可能来源的列名。
+// 别名、表达式、派生表和 UNION 都会追溯到其中引用的列，宁可多遮盖也不漏掉
+func resultColumnSources(tokens []sqlToken, columns []string) [][]string {
+	lists := map[int][][]selectItem{} // 按 SELECT 所在的括号层级分组
+	aliases := map[string][]string{}
+	top := -1
+	for i, t := range tokens {
+		if !t.isWord("SELECT") {
+			continue
+		}
+		items := parseSelectItems(tokens, i)
+		lists[t.depth] = append(lists[t.depth], items)
+		if top < 0 || t.depth < top {
+			top = t.depth
+		}
+		for _, item := range items {
+			if item.name != "" {
+				key := strings.ToLower(item.name)
+				aliases[key] = append(aliases[key], item.sources...)
+			}
+		}
+	}
+
+	sources := make([][]string, len(columns))
+	// 没有 * 且列数一致时按位置对应，否则按列名对应
+	positional := len(lists[top]) > 0
+	for _, items := range lists[top] {
+		if len(items) != len(columns) {
+			positional = false
+		}
+		for _, item := range items {
+			positional = positional && !item.star
+		}
+	}
+	for i, col := range columns {
+		names := []string{strings.ToLower(col)}
+		if positional {
+			for _, items := range lists[top] {
+				names = append(names, items[i].sources...)
+			}
+		}
+		// 沿别名展开到底层的列名
+		seen := map[string]bool{}
+		for j := 0; j < len(names); j++ {
+			if seen[names[j]] {
+				continue
+			}
+			seen[names[j]] = true
+			names = append(names, aliases[names[j]]...)
+		}
+		for name := range seen {
+			sources[i] = append(sources[i], name)
+		}
+	}
+	return sources
+}
+
+// parseSelectItems 解析 tokens[start] 处 SELECT 的列表，到同层的 FROM 等子句为止
+func parseSelectItems(tokens []sqlToken, start int) []selectItem {
+	depth := tokens[start].depth
+	var items []selectItem
+	var cur []sqlToken
+	flush := func() {
+		if len(cur) == 0 {
+			return
+		}
+		item := selectItem{}
+		last := cur[len(cur)-1]
+		body := cur
+		switch {
+		case last.text == "*":
+			item.star = true
+		case len(cur) >= 2 && cur[len(cur)-2].isWord("AS") && isIdentToken(last):
+			item.name, body = last.name(), cur[:len(cur)-2]
+		case len(cur) >= 2 && isIdentToken(last) && (cur[len(cur)-2].kind != tokPunct || cur[len(cur)-2].text == ")"):
+			item.name, body = last.name(), cur[:len(cur)-1]
+		case isIdentToken(last):
+			item.name = last.name()
+		}
+		for j, t := range body {
+			if !isIdentToken(t) {
+				continue
+			}
+			if j+1 < len(body) && (body[j+1].text == "(" || body[j+1].text == ".") {
+				continue
+			}
+			item.sources = append(item.sources, strings.ToLower(t.name()))
+		}
+		items = append(items, item)
+		cur = nil
+	}
+	for i := start + 1; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.depth < depth || t.depth == depth && t.isWord("FROM", "INTO", "WHERE", "GROUP", "HAVING", "WINDOW", "ORDER", "LIMIT", "UNION", "FOR", "LOCK") {
+			break
+		}
+		if t.depth == depth && t.text == "," {
+			flush()
+			continue
+		}
+		cur = append(cur, t)
+	}
+	flush()
+	return items
+}
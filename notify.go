@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// sendLogNotification 发送 notifications/message 日志通知：call 不为 nil 时只发给发起调用的客户端，否则发给所有客户端
+func sendLogNotification(call *toolCall, level mcp.LoggingLevel, logger string, data interface{}) {
+	msg, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": mcp.JSONRPC_VERSION,
+		"method":  "notifications/message",
+		"params": map[string]interface{}{
+			"level":  level,
+			"logger": logger,
+			"data":   data,
+		},
+	})
+	if err != nil {
+		return
+	}
+	if call != nil && call.conn != nil {
+		call.conn.send(msg)
+		return
+	}
+	broadcast(msg)
+}
+
+// sendProgressNotification 发送 notifications/progress 进度通知。只在调用方请求了进度（给出 progressToken）时发送，
+// 返回是否已发送。total 为 0 表示总量未知
+func sendProgressNotification(call *toolCall, progress, total int64, message string) bool {
+	if call == nil || call.conn == nil || len(call.progressToken) == 0 {
+		return false
+	}
+	params := map[string]interface{}{
+		"progressToken": call.progressToken,
+		"progress":      progress,
+	}
+	if total > 0 {
+		params["total"] = total
+	}
+	if message != "" {
+		params["message"] = message
+	}
+	msg, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": mcp.JSONRPC_VERSION,
+		"method":  "notifications/progress",
+		"params":  params,
+	})
+	if err != nil {
+		return false
+	}
+	call.conn.send(msg)
+	return true
+}
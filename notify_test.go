@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestExportProgressNotifications(t *testing.T) {
+	s := newToolServer("test", "1.0")
+	s.AddTool(mcp.NewTool("export"), func(request map[string]interface{}) (*mcp.CallToolResult, error) {
+		call := callOf(request)
+		reportExportProgress(call, map[string]interface{}{"rows": int64(10), "bytes": int64(100)}, 0)
+		reportExportProgress(call, map[string]interface{}{"rows": int64(25), "bytes": int64(250), "done": true}, 25)
+		return mcp.NewToolResultText("ok"), nil
+	})
+
+	tests := []struct {
+		name   string
+		params string
+		want   []string // 每条通知的 method
+		token  string
+	}{
+		{"with progress token", `{"name":"export","_meta":{"progressToken":"tok-1"}}`,
+			[]string{"notifications/progress", "notifications/progress"}, `"tok-1"`},
+		{"numeric progress token", `{"name":"export","_meta":{"progressToken":7}}`,
+			[]string{"notifications/progress", "notifications/progress"}, `7`},
+		{"without progress token", `{"name":"export"}`,
+			[]string{"notifications/message", "notifications/message"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out []map[string]json.RawMessage
+			conn := &mcpConn{write: func(msg []byte) error {
+				var m map[string]json.RawMessage
+				json.Unmarshal(msg, &m)
+				out = append(out, m)
+				return nil
+			}}
+			dispatch(s, conn, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":`+tt.params+`}`))
+			if len(out) != len(tt.want)+1 {
+				t.Fatalf("got %d messages, want %d", len(out), len(tt.want)+1)
+			}
+			for i, method := range tt.want {
+				var got string
+				json.Unmarshal(out[i]["method"], &got)
+				if got != method {
+					t.Errorf("message %d method = %s, want %s", i, got, method)
+				}
+			}
+			if tt.token == "" {
+				return
+			}
+			var first, last struct {
+				ProgressToken json.RawMessage `json:"progressToken"`
+				Progress      int64           `json:"progress"`
+				Total         *int64          `json:"total"`
+			}
+			json.Unmarshal(out[0]["params"], &first)
+			json.Unmarshal(out[1]["params"], &last)
+			if string(first.ProgressToken) != tt.token || first.Progress != 10 || first.Total != nil {
+				t.Errorf("first progress = %s %d %v", first.ProgressToken, first.Progress, first.Total)
+			}
+			if last.Progress != 25 || last.Total == nil || *last.Total != 25 {
+				t.Errorf("final progress = %d %v, want 25/25", last.Progress, last.Total)
+			}
+		})
+	}
+}
@@ -0,0 +1,680 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// openAPISpec 解析后的 OpenAPI 3 / Swagger 2 文档，保留原始结构以便解析 $ref
+type openAPISpec struct {
+	root    map[string]interface{}
+	swagger bool // true 表示 Swagger 2.0
+}
+
+// openAPIMethods 按固定顺序输出的 HTTP 方法
+var openAPIMethods = []string{"get", "post", "put", "patch", "delete", "head", "options", "trace"}
+
+// maxSchemaDepth 展开嵌套 schema 的最大层级，防止循环引用或过深结构
+const maxSchemaDepth = 6
+
+// yamlErrorLine 提取 YAML 错误中的行号
+var yamlErrorLine = regexp.MustCompile(`line (\d+)`)
+
+// loadOpenAPISpec 读取 API_SPEC_DIR 下 JSON / YAML 格式的 OpenAPI 或 Swagger 文件。
+// 解析错误只报告位置，不回显文件内容
+func loadOpenAPISpec(name string) (*openAPISpec, error) {
+	specDir := getEnv("API_SPEC_DIR", "")
+	if specDir == "" {
+		return nil, fmt.Errorf("未配置 API_SPEC_DIR，无法读取 API 定义文件")
+	}
+	path, err := resolveUnderDir(specDir, name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 API 定义文件 %s 失败", name)
+	}
+
+	var root map[string]interface{}
+	trimmed := strings.TrimSpace(string(data))
+	if strings.EqualFold(filepath.Ext(path), ".json") || strings.HasPrefix(trimmed, "{") {
+		if err := json.Unmarshal(data, &root); err != nil {
+			if syntaxErr, ok := err.(*json.SyntaxError); ok {
+				return nil, fmt.Errorf("解析 JSON 失败：第 %d 字节附近有语法错误", syntaxErr.Offset)
+			}
+			return nil, fmt.Errorf("解析 JSON 失败：顶层必须是对象")
+		}
+	} else {
+		var raw interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+				return nil, fmt.Errorf("解析 YAML 失败：第 %s 行有语法错误", m[1])
+			}
+			return nil, fmt.Errorf("解析 YAML 失败")
+		}
+		root, _ = normalizeYAML(raw).(map[string]interface{})
+	}
+
+	spec := &openAPISpec{root: root}
+	switch {
+	case mapString(root, "swagger") != "":
+		spec.swagger = true
+	case mapString(root, "openapi") != "":
+	default:
+		return nil, fmt.Errorf("文件不是 OpenAPI 3 或 Swagger 2 定义（缺少 openapi / swagger 字段）")
+	}
+	if _, ok := root["paths"].(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("API 定义中没有 paths")
+	}
+	return spec, nil
+}
+
+// openAPIOperation 单个接口
+type openAPIOperation struct {
+	method string
+	path   string
+	op     map[string]interface{}
+	params []interface{} // 路径级公共参数
+}
+
+func (s *openAPISpec) operations() []openAPIOperation {
+	paths, _ := s.root["paths"].(map[string]interface{})
+
+	keys := make([]string, 0, len(paths))
+	for k := range paths {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var ops []openAPIOperation
+	for _, p := range keys {
+		item := s.resolve(paths[p])
+		if item == nil {
+			continue
+		}
+		shared, _ := item["parameters"].([]interface{})
+		for _, m := range openAPIMethods {
+			if op, ok := item[m].(map[string]interface{}); ok {
+				ops = append(ops, openAPIOperation{method: strings.ToUpper(m), path: p, op: op, params: shared})
+			}
+		}
+	}
+	return ops
+}
+
+// resolve 解析本地 $ref（#/components/... 或 #/definitions/...），返回对象本身
+func (s *openAPISpec) resolve(v interface{}) map[string]interface{} {
+	obj, _ := v.(map[string]interface{})
+	for i := 0; obj != nil && i < 16; i++ {
+		ref := mapString(obj, "$ref")
+		if ref == "" {
+			return obj
+		}
+		obj = s.lookupRef(ref)
+	}
+	return obj
+}
+
+func (s *openAPISpec) lookupRef(ref string) map[string]interface{} {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil // 不支持外部文件引用
+	}
+	var cur interface{} = s.root
+	for _, part := range strings.Split(ref[2:], "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	obj, _ := cur.(map[string]interface{})
+	return obj
+}
+
+func refName(v interface{}) string {
+	obj, _ := v.(map[string]interface{})
+	ref := mapString(obj, "$ref")
+	if i := strings.LastIndex(ref, "/"); i >= 0 {
+		return ref[i+1:]
+	}
+	return ""
+}
+
+// schemaType 返回 schema 的可读类型描述
+func (s *openAPISpec) schemaType(v interface{}) string {
+	if name := refName(v); name != "" {
+		return name
+	}
+	schema := s.resolve(v)
+	if schema == nil {
+		return ""
+	}
+
+	t := mapString(schema, "type")
+	switch {
+	case t == "array":
+		return s.schemaType(schema["items"]) + "[]"
+	case t == "" && schema["allOf"] != nil:
+		return "object"
+	case t == "" && schema["oneOf"] != nil:
+		return "oneOf"
+	case t == "" && schema["anyOf"] != nil:
+		return "anyOf"
+	case t == "" && schema["properties"] != nil:
+		t = "object"
+	}
+	if f := mapString(schema, "format"); f != "" {
+		t += "(" + f + ")"
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		vals := make([]string, len(enum))
+		for i, e := range enum {
+			vals[i] = fmt.Sprint(e)
+		}
+		t += " 枚举: " + strings.Join(vals, "/")
+	}
+	return t
+}
+
+// schemaRows 将 schema 展开为“字段 | 类型 | 必填 | 说明”表格行
+func (s *openAPISpec) schemaRows(v interface{}) [][]string {
+	var rows [][]string
+	s.collectSchemaRows(v, "", 0, map[string]bool{}, &rows)
+	return rows
+}
+
+func (s *openAPISpec) collectSchemaRows(v interface{}, prefix string, depth int, seen map[string]bool, rows *[][]string) {
+	if depth > maxSchemaDepth {
+		return
+	}
+	if name := refName(v); name != "" {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		defer delete(seen, name)
+	}
+
+	schema := s.resolve(v)
+	if schema == nil {
+		return
+	}
+
+	switch {
+	case mapString(schema, "type") == "array":
+		s.collectSchemaRows(schema["items"], prefix+"[]", depth+1, seen, rows)
+		return
+	case schema["allOf"] != nil:
+		all, _ := schema["allOf"].([]interface{})
+		for _, sub := range all {
+			s.collectSchemaRows(sub, prefix, depth+1, seen, rows)
+		}
+	}
+
+	props, _ := schema["properties"].(map[string]interface{})
+	if len(props) == 0 {
+		return
+	}
+
+	required := map[string]bool{}
+	if req, ok := schema["required"].([]interface{}); ok {
+		for _, r := range req {
+			required[fmt.Sprint(r)] = true
+		}
+	}
+
+	names := make([]string, 0, len(props))
+	for k := range props {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field := name
+		if prefix != "" {
+			field = prefix + "." + name
+		}
+		prop := s.resolve(props[name])
+		*rows = append(*rows, []string{
+			field,
+			s.schemaType(props[name]),
+			yesNo(required[name]),
+			schemaDescription(prop),
+		})
+		s.collectSchemaRows(props[name], field, depth+1, seen, rows)
+	}
+}
+
+func schemaDescription(schema map[string]interface{}) string {
+	desc := mapString(schema, "description")
+	if desc == "" {
+		desc = mapString(schema, "title")
+	}
+	if def, ok := schema["default"]; ok {
+		desc = strings.TrimSpace(fmt.Sprintf("%s（默认: %v）", desc, def))
+	}
+	return desc
+}
+
+// schemaExample 优先使用定义中的 example，否则按 schema 生成示例值
+func (s *openAPISpec) schemaExample(v interface{}, depth int, seen map[string]bool) interface{} {
+	if depth > maxSchemaDepth {
+		return nil
+	}
+	if name := refName(v); name != "" {
+		if seen[name] {
+			return nil
+		}
+		seen[name] = true
+		defer delete(seen, name)
+	}
+
+	schema := s.resolve(v)
+	if schema == nil {
+		return nil
+	}
+	if ex, ok := schema["example"]; ok {
+		return ex
+	}
+	if def, ok := schema["default"]; ok {
+		return def
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		merged := map[string]interface{}{}
+		for _, sub := range all {
+			if m, ok := s.schemaExample(sub, depth+1, seen).(map[string]interface{}); ok {
+				for k, val := range m {
+					merged[k] = val
+				}
+			}
+		}
+		return merged
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if alts, ok := schema[key].([]interface{}); ok && len(alts) > 0 {
+			return s.schemaExample(alts[0], depth+1, seen)
+		}
+	}
+
+	switch mapString(schema, "type") {
+	case "array":
+		if item := s.schemaExample(schema["items"], depth+1, seen); item != nil {
+			return []interface{}{item}
+		}
+		return []interface{}{}
+	case "integer":
+		return 0
+	case "number":
+		return 0.0
+	case "boolean":
+		return false
+	case "string":
+		switch mapString(schema, "format") {
+		case "date":
+			return "2024-01-01"
+		case "date-time":
+			return "2024-01-01T00:00:00Z"
+		case "uuid":
+			return "00000000-0000-0000-0000-000000000000"
+		}
+		return "string"
+	}
+
+	obj := map[string]interface{}{}
+	if props, ok := schema["properties"].(map[string]interface{}); ok {
+		for name, prop := range props {
+			obj[name] = s.schemaExample(prop, depth+1, seen)
+		}
+	}
+	return obj
+}
+
+// mediaExample 取 OpenAPI 3 media type 中的 example / examples
+func (s *openAPISpec) mediaExample(media map[string]interface{}) interface{} {
+	if ex, ok := media["example"]; ok {
+		return ex
+	}
+	if exs, ok := media["examples"].(map[string]interface{}); ok {
+		names := make([]string, 0, len(exs))
+		for k := range exs {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if ex := s.resolve(exs[name]); ex != nil {
+				if val, ok := ex["value"]; ok {
+					return val
+				}
+			}
+		}
+	}
+	return s.schemaExample(media["schema"], 0, map[string]bool{})
+}
+
+// firstMedia 选择优先的 content type（JSON 优先）
+func firstMedia(content map[string]interface{}) (string, map[string]interface{}) {
+	if len(content) == 0 {
+		return "", nil
+	}
+	types := make([]string, 0, len(content))
+	for k := range content {
+		types = append(types, k)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		ji, jj := strings.Contains(types[i], "json"), strings.Contains(types[j], "json")
+		if ji != jj {
+			return ji
+		}
+		return types[i] < types[j]
+	})
+	media, _ := content[types[0]].(map[string]interface{})
+	return types[0], media
+}
+
+// buildAPISections 按照模块模板“3. API 接口设计”的布局生成接口章节
+func (s *openAPISpec) buildAPISections(doc *document) {
+	ops := s.operations()
+
+	doc.addSection(2, "3. API 接口设计")
+
+	info, _ := s.root["info"].(map[string]interface{})
+	overview := doc.addSection(3, "3.1 接口列表")
+	var summary []string
+	if title := mapString(info, "title"); title != "" {
+		summary = append(summary, fmt.Sprintf("服务名称：%s", title))
+	}
+	if version := mapString(info, "version"); version != "" {
+		summary = append(summary, fmt.Sprintf("接口版本：%s", version))
+	}
+	if base := s.baseURL(); base != "" {
+		summary = append(summary, fmt.Sprintf("服务地址：`%s`", base))
+	}
+	if len(summary) > 0 {
+		overview.list(summary...)
+	}
+
+	rows := make([][]string, 0, len(ops))
+	for _, o := range ops {
+		rows = append(rows, []string{o.method, "`" + o.path + "`", operationSummary(o.op)})
+	}
+	overview.table([]string{"方法", "路径", "说明"}, rows).rule()
+
+	for i, o := range ops {
+		sec := doc.addSection(3, fmt.Sprintf("3.%d `%s %s` — %s", i+2, o.method, o.path, operationSummary(o.op)))
+		if desc := mapString(o.op, "description"); desc != "" && desc != mapString(o.op, "summary") {
+			sec.paragraph(desc)
+		}
+		if mapBool(o.op, "deprecated") {
+			sec.label("已废弃")
+		}
+
+		s.buildParameters(doc, o)
+		s.buildRequestBody(doc, o)
+		s.buildResponses(doc, o)
+		doc.sections[len(doc.sections)-1].rule()
+	}
+}
+
+func operationSummary(op map[string]interface{}) string {
+	if summary := mapString(op, "summary"); summary != "" {
+		return summary
+	}
+	if id := mapString(op, "operationId"); id != "" {
+		return id
+	}
+	return "-"
+}
+
+func (s *openAPISpec) baseURL() string {
+	if s.swagger {
+		host := mapString(s.root, "host")
+		if host == "" {
+			return mapString(s.root, "basePath")
+		}
+		scheme := "https"
+		if schemes, ok := s.root["schemes"].([]interface{}); ok && len(schemes) > 0 {
+			scheme = fmt.Sprint(schemes[0])
+		}
+		return scheme + "://" + host + mapString(s.root, "basePath")
+	}
+	if servers, ok := s.root["servers"].([]interface{}); ok && len(servers) > 0 {
+		if srv, ok := servers[0].(map[string]interface{}); ok {
+			return mapString(srv, "url")
+		}
+	}
+	return ""
+}
+
+// mergedParameters 合并路径级与操作级参数，操作级同名参数覆盖路径级
+func (s *openAPISpec) mergedParameters(o openAPIOperation) []map[string]interface{} {
+	var params []map[string]interface{}
+	index := map[string]int{}
+	add := func(list []interface{}) {
+		for _, raw := range list {
+			p := s.resolve(raw)
+			if p == nil {
+				continue
+			}
+			key := mapString(p, "in") + ":" + mapString(p, "name")
+			if i, ok := index[key]; ok {
+				params[i] = p
+				continue
+			}
+			index[key] = len(params)
+			params = append(params, p)
+		}
+	}
+	add(o.params)
+	opParams, _ := o.op["parameters"].([]interface{})
+	add(opParams)
+	return params
+}
+
+func (s *openAPISpec) buildParameters(doc *document, o openAPIOperation) {
+	var rows [][]string
+	for _, p := range s.mergedParameters(o) {
+		if mapString(p, "in") == "body" {
+			continue // Swagger 2 的 body 参数作为请求体展示
+		}
+		typ := s.schemaType(p["schema"])
+		if typ == "" {
+			typ = s.schemaType(p) // Swagger 2 的参数类型直接写在参数上
+		}
+		rows = append(rows, []string{
+			mapString(p, "name"),
+			mapString(p, "in"),
+			typ,
+			yesNo(mapBool(p, "required")),
+			mapString(p, "description"),
+		})
+	}
+	if len(rows) == 0 {
+		return
+	}
+	doc.addSection(4, "请求参数").table([]string{"参数名", "位置", "类型", "必填", "说明"}, rows)
+}
+
+func (s *openAPISpec) buildRequestBody(doc *document, o openAPIOperation) {
+	var contentType string
+	var schema, example interface{}
+	var required bool
+	var description string
+
+	if s.swagger {
+		for _, p := range s.mergedParameters(o) {
+			if mapString(p, "in") != "body" {
+				continue
+			}
+			schema = p["schema"]
+			required = mapBool(p, "required")
+			description = mapString(p, "description")
+			example = s.schemaExample(schema, 0, map[string]bool{})
+			contentType = "application/json"
+			if consumes, ok := o.op["consumes"].([]interface{}); ok && len(consumes) > 0 {
+				contentType = fmt.Sprint(consumes[0])
+			}
+		}
+	} else if body := s.resolve(o.op["requestBody"]); body != nil {
+		content, _ := body["content"].(map[string]interface{})
+		var media map[string]interface{}
+		contentType, media = firstMedia(content)
+		if media != nil {
+			schema = media["schema"]
+			example = s.mediaExample(media)
+		}
+		required = mapBool(body, "required")
+		description = mapString(body, "description")
+	}
+
+	if contentType == "" {
+		return
+	}
+
+	sec := doc.addSection(4, "请求体")
+	sec.list(fmt.Sprintf("Content-Type：`%s`", contentType), fmt.Sprintf("必填：%s", yesNo(required)))
+	if description != "" {
+		sec.paragraph(description)
+	}
+	if rows := s.schemaRows(schema); len(rows) > 0 {
+		sec.table([]string{"字段", "类型", "必填", "说明"}, rows)
+	} else if typ := s.schemaType(schema); typ != "" {
+		sec.paragraph("类型：" + typ)
+	}
+	if example != nil {
+		sec.label("请求示例：").code("json", prettyJSON(example))
+	}
+}
+
+func (s *openAPISpec) buildResponses(doc *document, o openAPIOperation) {
+	responses, _ := o.op["responses"].(map[string]interface{})
+	if len(responses) == 0 {
+		return
+	}
+
+	codes := make([]string, 0, len(responses))
+	for k := range responses {
+		codes = append(codes, k)
+	}
+	sort.Strings(codes) // "default" 排在数字状态码之后
+
+	sec := doc.addSection(4, "响应")
+	for _, code := range codes {
+		resp := s.resolve(responses[code])
+		if resp == nil {
+			continue
+		}
+
+		var schema, example interface{}
+		if s.swagger {
+			schema = resp["schema"]
+			if exs, ok := resp["examples"].(map[string]interface{}); ok {
+				_, example = firstMediaValue(exs)
+			}
+			if example == nil && schema != nil {
+				example = s.schemaExample(schema, 0, map[string]bool{})
+			}
+		} else {
+			content, _ := resp["content"].(map[string]interface{})
+			if _, media := firstMedia(content); media != nil {
+				schema = media["schema"]
+				example = s.mediaExample(media)
+			}
+		}
+
+		label := code
+		if desc := mapString(resp, "description"); desc != "" {
+			label += " — " + desc
+		}
+		sec.label(label)
+		if rows := s.schemaRows(schema); len(rows) > 0 {
+			sec.table([]string{"字段", "类型", "必填", "说明"}, rows)
+		} else if typ := s.schemaType(schema); typ != "" {
+			sec.paragraph("类型：" + typ)
+		}
+		if example != nil {
+			sec.code("json", prettyJSON(example))
+		}
+	}
+}
+
+func firstMediaValue(m map[string]interface{}) (string, interface{}) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		return "", nil
+	}
+	return keys[0], m[keys[0]]
+}
+
+// normalizeYAML 将 YAML 中的非字符串键（如响应码 200）统一转为字符串键
+func normalizeYAML(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = normalizeYAML(item)
+		}
+		return val
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[fmt.Sprint(k)] = normalizeYAML(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range val {
+			val[i] = normalizeYAML(item)
+		}
+		return val
+	}
+	return v
+}
+
+func prettyJSON(v interface{}) string {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+func mapString(m map[string]interface{}, key string) string {
+	if m == nil {
+		return ""
+	}
+	switch v := m[key].(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func mapBool(m map[string]interface{}, key string) bool {
+	b, _ := m[key].(bool)
+	return b
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "是"
+	}
+	return "否"
+}
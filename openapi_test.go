@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadOpenAPISpecDir(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("API_SPEC_DIR", dir)
+	os.WriteFile(filepath.Join(dir, "broken.yaml"), []byte("openapi: 3.0.0\npaths:\n  /x: [secret-value\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{"openapi": "3.0.0", secret-value}`), 0o644)
+
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"absolute path", "/etc/passwd"},
+		{"parent directory", "../outside.yaml"},
+		{"missing file", "missing.yaml"},
+		{"yaml syntax error", "broken.yaml"},
+		{"json syntax error", "broken.json"},
+	}
+	for _, tt := range tests {
+		_, err := loadOpenAPISpec(tt.file)
+		if err == nil {
+			t.Errorf("%s: loadOpenAPISpec(%q) succeeded", tt.name, tt.file)
+			continue
+		}
+		if strings.Contains(err.Error(), "secret-value") || strings.Contains(err.Error(), dir) {
+			t.Errorf("%s: error leaks file content or path: %v", tt.name, err)
+		}
+	}
+
+	t.Setenv("API_SPEC_DIR", "")
+	if _, err := loadOpenAPISpec("broken.yaml"); err == nil {
+		t.Error("loadOpenAPISpec without API_SPEC_DIR succeeded")
+	}
+}
+
+func TestOpenAPIMalformedAllOf(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("API_SPEC_DIR", dir)
+	spec := `openapi: 3.0.0
+info: {title: t, version: "1"}
+paths:
+  /items:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              allOf: {not: a-list}
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              schema:
+                allOf: oops
+`
+	os.WriteFile(filepath.Join(dir, "api.yaml"), []byte(spec), 0o644)
+	s, err := loadOpenAPISpec("api.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := &document{}
+	s.buildAPISections(doc)
+	if _, err := renderDocument(doc, "markdown"); err != nil {
+		t.Fatal(err)
+	}
+}
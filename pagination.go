@@ -0,0 +1,657 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 分页方式
+const (
+	pageKeyset = "keyset" // 按唯一排序键续读：WHERE key > 上一页最后的值
+	pageOffset = "offset" // 追加 LIMIT / OFFSET
+	pageWindow = "window" // 语句自带 LIMIT 常量，改写为本页所在的范围
+	pageSkip   = "skip"   // SHOW / DESCRIBE 或 LIMIT 中有占位符，执行原语句后跳过已返回的行
+)
+
+// defaultPageMaxBytes 单页结果的默认字节上限
+const defaultPageMaxBytes = 64 * 1024
+
+// pageState 分页状态，编码后作为 next_page_token 返回给调用方
+type pageState struct {
+	Query          string            `json:"q"`
+	Args           []json.RawMessage `json:"a,omitempty"` // 绑定参数的原始 JSON，每页重新绑定
+	Mode           string            `json:"m"`
+	PageSize       int               `json:"n"`
+	Offset         int               `json:"o,omitempty"`  // 已返回的行数
+	LastKey        string            `json:"v,omitempty"`  // keyset 模式下上一页最后一行的排序键
+	LastKeyKind    string            `json:"vk,omitempty"` // 排序键类型：i 有符号整数 / u 无符号整数 / s 字符串
+	Format         string            `json:"f,omitempty"`
+	BinaryEncoding string            `json:"b,omitempty"`
+	SessionID      string            `json:"s,omitempty"` // 在会话的事务中执行
+	Route          string            `json:"r,omitempty"` // 主从路由，见 readDB
+	Replica        string            `json:"h,omitempty"` // 第一页所用从库的地址，后续页固定在该从库上
+
+	tool     string // 发起查询的工具，记录到查询历史
+	replayOf string // replay_query 重放的历史记录 ID
+	call     *toolCall
+}
+
+// keysetPlan 可按唯一键续读的查询结构
+type keysetPlan struct {
+	keyExpr   string // ORDER BY 中的排序键写法，如 `o`.`id`
+	keyColumn string // 结果集中的列名
+	desc      bool
+	whereIdx  int // 顶层 WHERE 的位置，-1 表示没有
+	orderIdx  int // 顶层 ORDER 的位置
+	schema    string
+	table     string
+}
+
+// pageTokenKey 分页令牌的签名密钥，每次启动随机生成，重启后旧令牌失效
+var pageTokenKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// encodePageToken 令牌为 base64(JSON).base64(HMAC-SHA256)，防止调用方修改语句或分页方式
+func encodePageToken(state *pageState) string {
+	data, _ := json.Marshal(state)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signPageToken(payload))
+}
+
+func signPageToken(payload string) []byte {
+	mac := hmac.New(sha256.New, pageTokenKey)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func decodePageToken(token string) (*pageState, error) {
+	payload, sig, ok := strings.Cut(strings.TrimSpace(token), ".")
+	if !ok {
+		return nil, fmt.Errorf("无效的分页令牌")
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, signPageToken(payload)) {
+		return nil, fmt.Errorf("无效的分页令牌：令牌已被修改，或服务重启后已失效，请重新执行查询")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("无效的分页令牌")
+	}
+	var state pageState
+	if err := json.Unmarshal(data, &state); err != nil || state.Query == "" || state.PageSize <= 0 {
+		return nil, fmt.Errorf("无效的分页令牌")
+	}
+	return &state, nil
+}
+
+// pageMaxBytes 单页结果的字节预算，防止结果撑爆模型上下文
+func pageMaxBytes() int {
+	if n, err := strconv.Atoi(getEnv("QUERY_PAGE_MAX_BYTES", "")); err == nil && n > 0 {
+		return n
+	}
+	return defaultPageMaxBytes
+}
+
+// newPageState 根据语句结构选择分页方式
+func newPageState(query string, pageSize int) *pageState {
+	state := &pageState{Query: query, PageSize: pageSize, Mode: pageSkip}
+
+	tokens := tokenizeSQL(query)
+	if firstKeyword(tokens) != "SELECT" {
+		return state
+	}
+	if hasTopLevelLimit(tokens) {
+		if _, _, _, ok := ownLimit(tokens); ok {
+			state.Mode = pageWindow
+		}
+		return state
+	}
+
+	// 排序键是否唯一非空要查表结构，在执行第一页的连接上确认，见 runQueryPage
+	state.Mode = pageOffset
+	if _, ok := planKeyset(tokens, query); ok {
+		state.Mode = pageKeyset
+	}
+	return state
+}
+
+// planKeyset 判断查询是否为“单表 + 按单列排序”的简单 SELECT，排序键是否唯一由 isUniqueNotNullColumn 确认
+func planKeyset(tokens []sqlToken, query string) (*keysetPlan, bool) {
+	if len(tokens) < 2 || !tokens[0].isWord("SELECT") || tokens[1].isWord("DISTINCT", "DISTINCTROW") {
+		return nil, false
+	}
+	if findTopLevel(tokens, 0, "UNION", "GROUP", "HAVING", "LIMIT", "INTO", "FOR", "LOCK", "WINDOW", "INTERSECT", "EXCEPT") >= 0 {
+		return nil, false
+	}
+
+	fromIdx := findTopLevel(tokens, 0, "FROM")
+	orderIdx := findTopLevel(tokens, 0, "ORDER")
+	if fromIdx < 0 || orderIdx < 0 || orderIdx+2 >= len(tokens) || !tokens[orderIdx+1].isWord("BY") {
+		return nil, false
+	}
+	whereIdx := findTopLevel(tokens, fromIdx, "WHERE")
+	tableEnd := orderIdx
+	if whereIdx >= 0 {
+		tableEnd = whereIdx
+	}
+
+	// FROM 子句只允许一个表：[schema.]table [[AS] alias]
+	schema, table, alias, ok := parseSingleTable(tokens[fromIdx+1 : tableEnd])
+	if !ok {
+		return nil, false
+	}
+
+	// ORDER BY 只允许一个列：[qualifier.]column [ASC|DESC]
+	rest := tokens[orderIdx+2:]
+	plan := &keysetPlan{whereIdx: whereIdx, orderIdx: orderIdx, schema: schema, table: table}
+	if n := len(rest); n > 0 && rest[n-1].isWord("ASC", "DESC") {
+		plan.desc = rest[n-1].isWord("DESC")
+		rest = rest[:n-1]
+	}
+	var qualifier string
+	switch {
+	case len(rest) == 1 && isIdentToken(rest[0]):
+		plan.keyColumn = rest[0].name()
+	case len(rest) == 3 && isIdentToken(rest[0]) && rest[1].text == "." && isIdentToken(rest[2]):
+		qualifier, plan.keyColumn = rest[0].name(), rest[2].name()
+	default:
+		return nil, false
+	}
+	if qualifier != "" && !strings.EqualFold(qualifier, alias) && !strings.EqualFold(qualifier, table) {
+		return nil, false
+	}
+	plan.keyExpr = query[rest[0].pos:rest[len(rest)-1].end]
+
+	// ORDER BY 中的名称优先匹配 SELECT 列表中的别名，别名指向其他表达式时不能按该列续读
+	if aliasShadows(tokens[1:fromIdx], plan.keyColumn) {
+		return nil, false
+	}
+	return plan, true
+}
+
+// aliasShadows 判断 SELECT 列表中是否有名为 column 的别名且其表达式不是该列本身
+func aliasShadows(items []sqlToken, column string) bool {
+	for len(items) > 0 {
+		end := 0
+		for end < len(items) && !(items[end].text == "," && items[end].depth == 0) {
+			end++
+		}
+		item := items[:end]
+		if end < len(items) {
+			end++
+		}
+		items = items[end:]
+
+		n := len(item)
+		if n < 2 || item[n-2].text == "." {
+			continue
+		}
+		last := item[n-1]
+		var alias string
+		switch {
+		case isIdentToken(last):
+			alias = last.name()
+		case last.kind == tokString:
+			alias = last.text[1 : len(last.text)-1]
+		default:
+			continue
+		}
+		if !strings.EqualFold(alias, column) {
+			continue
+		}
+		expr := item[:n-1]
+		if len(expr) > 0 && expr[len(expr)-1].isWord("AS") {
+			expr = expr[:len(expr)-1]
+		}
+		switch {
+		case len(expr) == 1 && isIdentToken(expr[0]) && strings.EqualFold(expr[0].name(), column):
+		case len(expr) == 3 && expr[1].text == "." && isIdentToken(expr[2]) && strings.EqualFold(expr[2].name(), column):
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// ownLimit 解析语句末尾的顶层 LIMIT n / LIMIT o, n / LIMIT n OFFSET o，返回 LIMIT 的位置；含占位符时返回 false
+func ownLimit(tokens []sqlToken) (limitIdx int, offset, count uint64, ok bool) {
+	limitIdx = findTopLevel(tokens, 0, "LIMIT")
+	if limitIdx < 0 {
+		return 0, 0, 0, false
+	}
+	args := tokens[limitIdx+1:]
+	num := func(t sqlToken) (uint64, bool) {
+		if t.kind != tokNumber {
+			return 0, false
+		}
+		n, err := strconv.ParseUint(t.text, 10, 64)
+		return n, err == nil
+	}
+	var okCount, okOffset bool
+	switch {
+	case len(args) == 1:
+		count, okCount = num(args[0])
+		okOffset = true
+	case len(args) == 3 && args[1].text == ",":
+		offset, okOffset = num(args[0])
+		count, okCount = num(args[2])
+	case len(args) == 3 && args[1].isWord("OFFSET"):
+		count, okCount = num(args[0])
+		offset, okOffset = num(args[2])
+	}
+	return limitIdx, offset, count, okCount && okOffset
+}
+
+func isIdentToken(t sqlToken) bool {
+	return t.kind == tokIdent || t.kind == tokWord
+}
+
+// parseSingleTable 解析只包含一个表引用的 FROM 子句
+func parseSingleTable(tokens []sqlToken) (schema, table, alias string, ok bool) {
+	switch {
+	case len(tokens) >= 1 && isIdentToken(tokens[0]) && (len(tokens) < 2 || tokens[1].text != "."):
+		table = tokens[0].name()
+		tokens = tokens[1:]
+	case len(tokens) >= 3 && isIdentToken(tokens[0]) && tokens[1].text == "." && isIdentToken(tokens[2]):
+		schema, table = tokens[0].name(), tokens[2].name()
+		tokens = tokens[3:]
+	default:
+		return "", "", "", false
+	}
+
+	if len(tokens) > 0 && tokens[0].isWord("AS") {
+		tokens = tokens[1:]
+	}
+	switch {
+	case len(tokens) == 0:
+	case len(tokens) == 1 && isIdentToken(tokens[0]) && !tokens[0].isWord("JOIN", "STRAIGHT_JOIN", "NATURAL", "LEFT", "RIGHT", "INNER", "CROSS", "USE", "FORCE", "IGNORE", "PARTITION"):
+		alias = tokens[0].name()
+	default:
+		return "", "", "", false
+	}
+	return schema, table, alias, true
+}
+
+// isUniqueNotNullColumn 判断列是否为非空且有单列唯一索引（含主键），保证按该列排序的结果没有重复值
+func isUniqueNotNullColumn(q queryer, schema, table, column string) bool {
+	if schema == "" {
+		var err error
+		if schema, err = currentDatabase(q); err != nil {
+			return false
+		}
+	}
+
+	columns, err := fetchColumns(q, schema, table)
+	if err != nil {
+		return false
+	}
+	notNull := false
+	for _, c := range columns {
+		if strings.EqualFold(c.Field, column) {
+			notNull = c.Null == "NO"
+		}
+	}
+	if !notNull {
+		return false
+	}
+
+	indexRows, err := fetchIndexRows(q, schema, table)
+	if err != nil {
+		return false
+	}
+	for _, idx := range groupIndexes(indexRows) {
+		if idx.Unique && len(idx.Columns) == 1 && strings.EqualFold(idx.Columns[0], column) {
+			return true
+		}
+	}
+	return false
+}
+
+// pageSQL 根据分页状态生成本页实际执行的 SQL 和追加的参数。
+// keyset 条件插在 ORDER BY 之前，原语句的占位符都在它前面，追加的参数排在绑定参数之后。
+func pageSQL(state *pageState) (string, []interface{}) {
+	query := state.Query
+	// 多取一行用于判断是否还有下一页；换行避免被语句末尾的行注释吞掉
+	limit := fmt.Sprintf("\nLIMIT %d", state.PageSize+1)
+
+	switch state.Mode {
+	case pageOffset:
+		if state.Offset > 0 {
+			limit += fmt.Sprintf(" OFFSET %d", state.Offset)
+		}
+		return query + limit, nil
+
+	case pageKeyset:
+		if state.LastKeyKind == "" {
+			return query + limit, nil
+		}
+		tokens := tokenizeSQL(query)
+		plan, ok := planKeyset(tokens, query)
+		if !ok {
+			// 无法按排序键续读，退回 OFFSET 分页
+			state.Mode = pageOffset
+			return pageSQL(state)
+		}
+
+		op := ">"
+		if plan.desc {
+			op = "<"
+		}
+		cond := fmt.Sprintf("%s %s ?", plan.keyExpr, op)
+		orderPos := tokens[plan.orderIdx].pos
+		var sqlText string
+		if plan.whereIdx >= 0 {
+			wherePos := tokens[plan.whereIdx].end
+			sqlText = query[:wherePos] + " (" + strings.TrimSpace(query[wherePos:orderPos]) + "\n) AND " + cond + "\n" + query[orderPos:]
+		} else {
+			sqlText = strings.TrimRight(query[:orderPos], " \t\r\n") + "\nWHERE " + cond + "\n" + query[orderPos:]
+		}
+		return sqlText + limit, []interface{}{keyArg(state.LastKey, state.LastKeyKind)}
+
+	case pageWindow:
+		tokens := tokenizeSQL(query)
+		limitIdx, offset, count, ok := ownLimit(tokens)
+		if !ok {
+			state.Mode = pageSkip
+			return query, nil
+		}
+		// 在原 LIMIT 范围内取本页，多取一行判断是否还有下一页
+		take := uint64(state.PageSize) + 1
+		if done := uint64(state.Offset); done >= count {
+			take = 0
+		} else if count-done < take {
+			take = count - done
+		}
+		return query[:tokens[limitIdx].pos] + fmt.Sprintf("LIMIT %d, %d", offset+uint64(state.Offset), take), nil
+	}
+
+	return query, nil
+}
+
+// pageDB 选择执行本页的连接池。第一页按 route 选择后把结果记入分页状态，
+// 后续页固定在同一个实例上，避免各页落到复制进度不同的从库
+func pageDB(state *pageState) (*sql.DB, error) {
+	if state.Replica != "" {
+		return replicaDB(state.Replica)
+	}
+	pool, addr, err := routeDB(map[string]interface{}{"route": state.Route}, true)
+	if err != nil {
+		return nil, err
+	}
+	if addr != "" {
+		state.Replica = addr
+	} else {
+		state.Route = routePrimary
+	}
+	return pool, nil
+}
+
+func keyArg(value, kind string) interface{} {
+	switch kind {
+	case "i":
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	case "u":
+		if n, err := strconv.ParseUint(value, 10, 64); err == nil {
+			return n
+		}
+	}
+	return value
+}
+
+// runQueryPage 执行一页查询，返回结果和下一页令牌
+func runQueryPage(state *pageState) (*mcp.CallToolResult, error) {
+	start := time.Now()
+	record := func(rows int, err error) {
+		entry := historyEntry{
+			call:       state.call,
+			Time:       start,
+			Tool:       state.tool,
+			Query:      state.Query,
+			Args:       state.Args,
+			DurationMs: time.Since(start).Milliseconds(),
+			Rows:       int64(rows),
+			ReplayOf:   state.replayOf,
+			Session:    state.SessionID,
+		}
+		if entry.Tool == "" {
+			entry.Tool = "execute_query"
+		}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		recordQuery(entry)
+	}
+
+	if err := checkQueryAccess(state.Query); err != nil {
+		record(0, err)
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	args, err := bindArgs(state.Args)
+	if err != nil {
+		record(0, err)
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var q queryer
+	if state.SessionID != "" {
+		sess, err := acquireSession(state.SessionID)
+		if err != nil {
+			record(0, err)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		defer sess.release()
+		q = sess.conn
+	} else {
+		pool, err := pageDB(state)
+		if err != nil {
+			record(0, err)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		conn, release, err := checkoutConn(context.Background(), pool)
+		if err != nil {
+			record(0, err)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		defer release()
+		q = conn
+	}
+
+	// 排序键必须唯一且非空才能按键续读，否则退回 OFFSET 分页；每页都在执行查询的连接上确认，表结构变化时同样退回
+	if state.Mode == pageKeyset {
+		if plan, ok := planKeyset(tokenizeSQL(state.Query), state.Query); !ok || !isUniqueNotNullColumn(q, plan.schema, plan.table, plan.keyColumn) {
+			state.Mode = pageOffset
+			state.LastKey, state.LastKeyKind = "", ""
+		}
+	}
+	sqlText, keyArgs := pageSQL(state)
+	args = append(args, keyArgs...)
+
+	// 只在第一页执行前检查代价，后续页沿用同一查询
+	var costWarnings []string
+	if state.Offset == 0 && state.LastKeyKind == "" {
+		if costWarnings, err = guardQueryCost(q, sqlText, args); err != nil {
+			record(0, err)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+
+	rows, err := q.QueryContext(context.Background(), sqlText, args...)
+	if err != nil {
+		record(0, err)
+		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v%s", err, limitErrorHint(err))), nil
+	}
+	defer rows.Close()
+
+	// skip 模式只读取到本页为止，不把整个结果集载入内存
+	maxRows := 0
+	if state.Mode == pageSkip {
+		maxRows = state.Offset + state.PageSize + 1
+	}
+	results, err := scanRows(rows, state.BinaryEncoding, maxRows)
+	if err != nil {
+		record(0, err)
+		return mcp.NewToolResultError(err.Error() + limitErrorHint(err)), nil
+	}
+	rm, err := newResultMasker(state.Query, results.columns)
+	if err != nil {
+		record(0, err)
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// skip 模式下跳过已经返回过的行
+	if state.Mode == pageSkip {
+		if state.Offset >= len(results.rows) {
+			results.rows = results.rows[:0]
+		} else {
+			results.rows = results.rows[state.Offset:]
+		}
+	}
+
+	// 按行数和字节预算截取本页
+	budget := pageMaxBytes()
+	used, take := 0, 0
+	truncatedByBytes := false
+	for take < len(results.rows) && take < state.PageSize {
+		size := rowSize(results.rows[take])
+		if take > 0 && used+size > budget {
+			truncatedByBytes = true
+			break
+		}
+		used += size
+		take++
+	}
+	hasMore := take < len(results.rows)
+	results.rows = results.rows[:take]
+	record(take, nil)
+
+	page := map[string]interface{}{
+		"mode":      state.Mode,
+		"offset":    state.Offset,
+		"page_size": state.PageSize,
+		"rows":      take,
+		"bytes":     used,
+		"has_more":  hasMore,
+	}
+	if truncatedByBytes {
+		page["truncated_by_bytes"] = budget
+	}
+	if len(costWarnings) > 0 {
+		page["cost_warnings"] = costWarnings
+		sendLogNotification(state.call, mcp.LoggingLevelWarning, "cost_guard", costWarnings)
+	}
+	if hasMore {
+		page["next_page_token"] = encodePageToken(nextPageState(state, results, take, rm))
+	}
+	rm.maskRows(results.rows)
+	rm.maskMeta(results.types)
+
+	output, err := formatQueryResult(sqlText, results, state.Format, page)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	result := mcp.NewToolResultText(output)
+	if !isJSONResultFormat(state.Format) && (hasMore || len(costWarnings) > 0) {
+		// 文本格式无法内嵌分页信息，作为第二段内容返回
+		info, _ := json.Marshal(page)
+		result.Content = append(result.Content, mcp.NewTextContent(string(info)))
+	}
+	return result, nil
+}
+
+// nextPageState 生成下一页的分页状态，排序键需要脱敏时不写入令牌
+func nextPageState(state *pageState, results *queryResult, taken int, rm *resultMasker) *pageState {
+	next := *state
+	next.Offset = state.Offset + taken
+
+	if state.Mode != pageKeyset {
+		return &next
+	}
+
+	plan, ok := planKeyset(tokenizeSQL(state.Query), state.Query)
+	keyIdx := -1
+	if ok {
+		for i, col := range results.columns {
+			if strings.EqualFold(col, plan.keyColumn) {
+				keyIdx = i
+				break
+			}
+		}
+	}
+	if keyIdx < 0 || taken == 0 || rm.alters(keyIdx, results.rows[taken-1][keyIdx]) {
+		// 结果集中没有排序键，无法续读，退回 OFFSET 分页
+		next.Mode = pageOffset
+		next.LastKey, next.LastKeyKind = "", ""
+		return &next
+	}
+
+	// 仅整数和字符串键可以无损地写入令牌，其他类型退回 OFFSET 分页
+	switch v := results.rows[taken-1][keyIdx].(type) {
+	case int64:
+		next.LastKey, next.LastKeyKind = strconv.FormatInt(v, 10), "i"
+		return &next
+	case uint64:
+		next.LastKey, next.LastKeyKind = strconv.FormatUint(v, 10), "u"
+		return &next
+	case string:
+		if t := results.types[keyIdx].Type; t == "CHAR" || t == "VARCHAR" {
+			next.LastKey, next.LastKeyKind = v, "s"
+			return &next
+		}
+	}
+	next.Mode = pageOffset
+	next.LastKey, next.LastKeyKind = "", ""
+	return &next
+}
+
+func rowSize(row []interface{}) int {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+func isJSONResultFormat(format string) bool {
+	return format == "" || format == "json"
+}
+
+// nextPage 使用 execute_query 返回的令牌读取下一页
+func nextPage(request map[string]interface{}) (*mcp.CallToolResult, error) {
+	token, ok := request["token"].(string)
+	if !ok || token == "" {
+		return mcp.NewToolResultError("token 参数是必需的"), nil
+	}
+
+	state, err := decodePageToken(token)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	// 令牌可被调用方修改，续读前重新做只读检查
+	if err := checkReadOnlyQuery(state.Query); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	state.tool = "next_page"
+	state.call = callOf(request)
+
+	return runQueryPage(state)
+}
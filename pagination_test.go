@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPageTokenRoundTrip(t *testing.T) {
+	state := &pageState{
+		Query:       "SELECT * FROM t WHERE a = ? ORDER BY id",
+		Args:        []json.RawMessage{json.RawMessage(`42`)},
+		Mode:        pageKeyset,
+		PageSize:    50,
+		Offset:      100,
+		LastKey:     "1234",
+		LastKeyKind: "i",
+		Format:      "csv",
+		SessionID:   "s1",
+		Route:       "primary",
+		Replica:     "10.0.0.11:3306",
+	}
+	got, err := decodePageToken(encodePageToken(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, state) {
+		t.Errorf("round trip = %+v, want %+v", got, state)
+	}
+}
+
+// 第一页选中的实例记入分页状态，后续页固定在同一个从库上，该从库不可用时报错而不是换实例
+func TestPageDBPinsInstance(t *testing.T) {
+	r := &replica{addr: "10.0.0.11:3306", db: &sql.DB{}, healthy: true}
+	saved := replicas.items
+	replicas.items = []*replica{r}
+	defer func() { replicas.items = saved }()
+
+	state := &pageState{}
+	if pool, err := pageDB(state); err != nil || pool != r.db || state.Replica != r.addr {
+		t.Fatalf("first page: pool = %p, replica = %q, err = %v", pool, state.Replica, err)
+	}
+	next := *state
+	if pool, err := pageDB(&next); err != nil || pool != r.db {
+		t.Fatalf("next page: pool = %p, err = %v", pool, err)
+	}
+	r.healthy = false
+	if _, err := pageDB(&next); err == nil || !strings.Contains(err.Error(), r.addr) {
+		t.Errorf("unhealthy pinned replica: err = %v", err)
+	}
+
+	// 自动路由回落到主库时固定为主库，从库恢复后续页也不会换过去
+	state = &pageState{}
+	if _, err := pageDB(state); err != nil || state.Route != routePrimary || state.Replica != "" {
+		t.Errorf("fallback to primary: route = %q, replica = %q, err = %v", state.Route, state.Replica, err)
+	}
+}
+
+func TestPageTokenTampered(t *testing.T) {
+	token := encodePageToken(&pageState{Query: "SELECT * FROM t", Mode: pageOffset, PageSize: 10})
+	payload, sig, _ := strings.Cut(token, ".")
+
+	forged, _ := json.Marshal(&pageState{Query: "SELECT * FROM t", Mode: pageSkip, PageSize: 10})
+	tests := map[string]string{
+		"unsigned":       payload,
+		"forged payload": base64.RawURLEncoding.EncodeToString(forged) + "." + sig,
+		"bad signature":  payload + "." + base64.RawURLEncoding.EncodeToString([]byte("x")),
+		"garbage":        "not a token",
+		"empty":          "",
+	}
+	for name, token := range tests {
+		if _, err := decodePageToken(token); err == nil {
+			t.Errorf("%s: decodePageToken accepted %q", name, token)
+		}
+	}
+}
+
+func TestOwnLimit(t *testing.T) {
+	tests := []struct {
+		query         string
+		offset, count uint64
+		ok            bool
+	}{
+		{"SELECT * FROM t LIMIT 10", 0, 10, true},
+		{"SELECT * FROM t ORDER BY id LIMIT 5, 20", 5, 20, true},
+		{"SELECT * FROM t LIMIT 20 OFFSET 5", 5, 20, true},
+		{"SELECT * FROM t LIMIT ?", 0, 0, false},
+		{"SELECT * FROM t LIMIT 10 FOR UPDATE", 0, 0, false},
+		{"SELECT * FROM (SELECT * FROM t LIMIT 3) x", 0, 0, false},
+		{"SELECT * FROM t", 0, 0, false},
+	}
+	for _, tt := range tests {
+		_, offset, count, ok := ownLimit(tokenizeSQL(tt.query))
+		if ok != tt.ok || (ok && (offset != tt.offset || count != tt.count)) {
+			t.Errorf("ownLimit(%q) = %d, %d, %v; want %d, %d, %v", tt.query, offset, count, ok, tt.offset, tt.count, tt.ok)
+		}
+	}
+}
+
+func TestPageSQLWindow(t *testing.T) {
+	tests := []struct {
+		query    string
+		pageSize int
+		offset   int
+		want     string
+	}{
+		{"SELECT * FROM t ORDER BY id LIMIT 100", 10, 0, "SELECT * FROM t ORDER BY id LIMIT 0, 11"},
+		{"SELECT * FROM t ORDER BY id LIMIT 100", 10, 30, "SELECT * FROM t ORDER BY id LIMIT 30, 11"},
+		{"SELECT * FROM t ORDER BY id LIMIT 100", 10, 95, "SELECT * FROM t ORDER BY id LIMIT 95, 5"},
+		{"SELECT * FROM t ORDER BY id LIMIT 100", 10, 100, "SELECT * FROM t ORDER BY id LIMIT 100, 0"},
+		{"SELECT * FROM t LIMIT 20, 15", 10, 10, "SELECT * FROM t LIMIT 30, 5"},
+		{"SELECT * FROM t LIMIT 15 OFFSET 20", 10, 0, "SELECT * FROM t LIMIT 20, 11"},
+	}
+	for _, tt := range tests {
+		state := newPageState(tt.query, tt.pageSize)
+		if state.Mode != pageWindow {
+			t.Fatalf("newPageState(%q).Mode = %s, want %s", tt.query, state.Mode, pageWindow)
+		}
+		state.Offset = tt.offset
+		if got, _ := pageSQL(state); got != tt.want {
+			t.Errorf("pageSQL(%q, offset %d) = %q, want %q", tt.query, tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestNewPageStateSkip(t *testing.T) {
+	for _, query := range []string{"SHOW TABLES", "DESCRIBE t", "SELECT * FROM t LIMIT ?"} {
+		if state := newPageState(query, 10); state.Mode != pageSkip {
+			t.Errorf("newPageState(%q).Mode = %s, want %s", query, state.Mode, pageSkip)
+		}
+	}
+}
+
+func TestAliasShadows(t *testing.T) {
+	tests := []struct {
+		query  string
+		column string
+		want   bool
+	}{
+		{"SELECT * FROM t", "id", false},
+		{"SELECT id, name FROM t", "id", false},
+		{"SELECT t.id AS id, name FROM t", "id", false},
+		{"SELECT `id` `id` FROM t", "id", false},
+		{"SELECT name AS id FROM t", "id", true},
+		{"SELECT name id FROM t", "id", true},
+		{"SELECT name AS `ID` FROM t", "id", true},
+		{"SELECT name AS 'id' FROM t", "id", true},
+		{"SELECT id + 1 AS id FROM t", "id", true},
+		{"SELECT id, COALESCE(a, b) AS x FROM t", "id", false},
+		{"SELECT CONCAT(a, ',', b) id FROM t", "id", true},
+	}
+	for _, tt := range tests {
+		tokens := tokenizeSQL(tt.query)
+		from := findTopLevel(tokens, 0, "FROM")
+		if got := aliasShadows(tokens[1:from], tt.column); got != tt.want {
+			t.Errorf("aliasShadows(%q, %s) = %v, want %v", tt.query, tt.column, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// 从库健康检查默认值，可通过 REPLICA_MAX_LAG（秒）/ REPLICA_CHECK_INTERVAL（秒）调整
+const (
+	defaultReplicaMaxLag        = 30
+	defaultReplicaCheckInterval = 10
+)
+
+// 路由方式，由工具的 route 参数指定
+const (
+	routeAuto    = "auto"    // 按工具默认：元数据和只读查询走从库，其余走主库
+	routePrimary = "primary" // 强制主库
+	routeReplica = "replica" // 强制从库，没有可用从库时报错
+)
+
+// replica 一个从库及其最近一次健康检查的结果
+type replica struct {
+	addr string
+	db   *sql.DB
+
+	mu        sync.Mutex
+	healthy   bool
+	lag       sql.NullInt64 // Seconds_Behind_Source，复制线程停止时为 NULL
+	lastError string
+	checkedAt time.Time
+}
+
+var replicas struct {
+	sync.Mutex
+	items []*replica
+	next  int
+}
+
+// openReplicas 按 MYSQL_REPLICAS 打开从库连接池。每项可以是完整的 DSN，
+// 也可以是 host[:port]，此时沿用主库的用户名、密码、数据库、TLS 和额外参数
+func openReplicas() error {
+	for _, item := range strings.Split(getEnv("MYSQL_REPLICAS", ""), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var dsn string
+		open := openMySQL // 沿用主库账号的从库与主库一样在连接时解析密码
+		if strings.ContainsAny(item, "@/") {
+			cfg, err := mysql.ParseDSN(item)
+			if err != nil {
+				return fmt.Errorf("从库 DSN 无效: %v", err)
+			}
+			if name := unsafeDSNConfig(cfg); name != "" {
+				return fmt.Errorf("从库 DSN 不允许设置 %s", name)
+			}
+			cfg.ParseTime = true
+			registerSecret(cfg.Passwd)
+			dsn = cfg.FormatDSN()
+			open = func(dsn string) (*sql.DB, error) { return sql.Open("mysql", dsn) }
+		} else {
+			host, port, ok := strings.Cut(item, ":")
+			if !ok {
+				port = "3306"
+			}
+			var err error
+			if dsn, err = mysqlDSN("tcp", host+":"+port); err != nil {
+				return err
+			}
+		}
+		cfg, _ := mysql.ParseDSN(dsn)
+
+		pool, err := open(dsn)
+		if err != nil {
+			return fmt.Errorf("打开从库 %s 失败: %v", cfg.Addr, err)
+		}
+		configurePool(pool)
+		replicas.items = append(replicas.items, &replica{addr: cfg.Addr, db: pool})
+	}
+	if len(replicas.items) == 0 {
+		return nil
+	}
+
+	// 在后台立即检查一次，之后定期检查；检查完成前只读查询走主库，从库不可达时不拖慢启动
+	go func() {
+		for {
+			checkReplicas()
+			time.Sleep(time.Duration(getEnvInt("REPLICA_CHECK_INTERVAL", defaultReplicaCheckInterval)) * time.Second)
+		}
+	}()
+	return nil
+}
+
+func checkReplicas() {
+	var wg sync.WaitGroup
+	for _, r := range replicas.items {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			r.check()
+		}(r)
+	}
+	wg.Wait()
+}
+
+// check 检查连通性和复制状态：复制线程未运行或延迟超过 REPLICA_MAX_LAG 时视为不可用
+func (r *replica) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	lag, err := replicationLag(ctx, r.db)
+	maxLag := int64(getEnvInt("REPLICA_MAX_LAG", defaultReplicaMaxLag))
+	if err == nil && lag.Int64 > maxLag {
+		err = fmt.Errorf("复制延迟 %d 秒，超过 REPLICA_MAX_LAG=%d", lag.Int64, maxLag)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case err != nil && (r.healthy || r.checkedAt.IsZero()):
+		log.Printf("replica %s unavailable: %v", r.addr, err)
+	case err == nil && !r.healthy && !r.checkedAt.IsZero():
+		log.Printf("replica %s recovered", r.addr)
+	}
+	r.healthy, r.lag, r.checkedAt = err == nil, lag, time.Now()
+	r.lastError = ""
+	if err != nil {
+		r.lastError = err.Error()
+	}
+}
+
+// replicationLag 读取 SHOW REPLICA STATUS 中的复制延迟，多源复制时取各通道中最大的
+func replicationLag(ctx context.Context, pool *sql.DB) (sql.NullInt64, error) {
+	channels, err := replicaStatusRows(ctx, pool)
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+	if len(channels) == 0 {
+		return sql.NullInt64{}, fmt.Errorf("未配置复制")
+	}
+	var lag sql.NullInt64
+	for _, ch := range channels {
+		v := statusField(ch, "Seconds_Behind_Source", "Seconds_Behind_Master")
+		n, err := strconv.ParseInt(v.String, 10, 64)
+		if !v.Valid || err != nil {
+			return sql.NullInt64{}, fmt.Errorf("复制线程未运行")
+		}
+		if !lag.Valid || n > lag.Int64 {
+			lag = sql.NullInt64{Int64: n, Valid: true}
+		}
+	}
+	return lag, nil
+}
+
+// replicaStatusRows 按服务器版本执行 SHOW REPLICA STATUS 或 SHOW SLAVE STATUS，
+// 不是从库时返回空，多源复制时每个通道一行
+func replicaStatusRows(ctx context.Context, pool *sql.DB) ([]map[string]sql.NullString, error) {
+	version, err := fetchServerVersion(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	statement := "SHOW SLAVE STATUS"
+	if version.mariaDB && version.atLeast(10, 5, 1) || !version.mariaDB && version.atLeast(8, 0, 22) {
+		statement = "SHOW REPLICA STATUS"
+	}
+	return queryNamedRows(ctx, pool, statement)
+}
+
+// statusField 按新旧两种列名读取 SHOW REPLICA STATUS 的字段（如 Source_Host / Master_Host）
+func statusField(row map[string]sql.NullString, names ...string) sql.NullString {
+	for _, name := range names {
+		if v, ok := row[name]; ok {
+			return v
+		}
+	}
+	return sql.NullString{}
+}
+
+// queryNamedRows 执行查询并按列名返回每一行
+func queryNamedRows(ctx context.Context, pool *sql.DB, query string) ([]map[string]sql.NullString, error) {
+	rows, err := pool.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var result []map[string]sql.NullString
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]sql.NullString, len(columns))
+		for i, c := range columns {
+			row[c] = values[i]
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// serverVersion 解析后的 VERSION()，如 8.0.36、5.7.44-log、10.11.6-MariaDB
+type serverVersion struct {
+	raw                 string
+	major, minor, patch int
+	mariaDB             bool
+}
+
+func fetchServerVersion(ctx context.Context, pool *sql.DB) (serverVersion, error) {
+	var v serverVersion
+	if err := pool.QueryRowContext(ctx, "SELECT VERSION()").Scan(&v.raw); err != nil {
+		return v, err
+	}
+	v.mariaDB = strings.Contains(strings.ToLower(v.raw), "mariadb")
+	numbers, _, _ := strings.Cut(v.raw, "-")
+	parts := strings.SplitN(numbers, ".", 3)
+	fields := []*int{&v.major, &v.minor, &v.patch}
+	for i, part := range parts {
+		*fields[i], _ = strconv.Atoi(part)
+	}
+	return v, nil
+}
+
+func (v serverVersion) atLeast(major, minor, patch int) bool {
+	if v.major != major {
+		return v.major > major
+	}
+	if v.minor != minor {
+		return v.minor > minor
+	}
+	return v.patch >= patch
+}
+
+// replicaHealth 各从库最近一次健康检查的结果
+func replicaHealth() []map[string]interface{} {
+	var list []map[string]interface{}
+	for _, r := range replicas.items {
+		r.mu.Lock()
+		item := map[string]interface{}{
+			"addr":       r.addr,
+			"healthy":    r.healthy,
+			"checked_at": r.checkedAt.Format(time.RFC3339),
+		}
+		if r.lag.Valid {
+			item["lag_seconds"] = r.lag.Int64
+		}
+		if r.lastError != "" {
+			item["error"] = r.lastError
+		}
+		r.mu.Unlock()
+		list = append(list, item)
+	}
+	return list
+}
+
+// pickReplica 在健康的从库中轮询选择一个，没有时返回 nil
+func pickReplica() *replica {
+	replicas.Lock()
+	defer replicas.Unlock()
+	n := len(replicas.items)
+	for i := 0; i < n; i++ {
+		r := replicas.items[(replicas.next+i)%n]
+		r.mu.Lock()
+		healthy := r.healthy
+		r.mu.Unlock()
+		if healthy {
+			replicas.next = (replicas.next + i + 1) % n
+			return r
+		}
+	}
+	return nil
+}
+
+// readDB 按 route 参数选择执行查询的连接池。preferReplica 为工具的默认倾向：
+// 元数据和只读查询工具为 true，processlist 等与具体实例相关的工具为 false。
+// 自动路由时没有健康的从库则回落到主库
+func readDB(request map[string]interface{}, preferReplica bool) (*sql.DB, error) {
+	pool, _, err := routeDB(request, preferReplica)
+	return pool, err
+}
+
+// routeDB 同 readDB，同时返回选中的从库地址，选中主库时地址为空
+func routeDB(request map[string]interface{}, preferReplica bool) (*sql.DB, string, error) {
+	route, _ := request["route"].(string)
+	switch route {
+	case "", routeAuto:
+		if preferReplica {
+			if r := pickReplica(); r != nil {
+				return r.db, r.addr, nil
+			}
+		}
+		return db, "", nil
+	case routePrimary:
+		return db, "", nil
+	case routeReplica:
+		if len(replicas.items) == 0 {
+			return nil, "", fmt.Errorf("未配置从库（MYSQL_REPLICAS）")
+		}
+		if r := pickReplica(); r != nil {
+			return r.db, r.addr, nil
+		}
+		return nil, "", fmt.Errorf("没有可用的从库，所有从库均未通过健康检查")
+	}
+	return nil, "", fmt.Errorf("route 只能是 %s / %s / %s", routeAuto, routePrimary, routeReplica)
+}
+
+// replicaDB 返回指定地址的从库，该从库已不健康时报错而不是换到其他实例
+func replicaDB(addr string) (*sql.DB, error) {
+	for _, r := range replicas.items {
+		if r.addr != addr {
+			continue
+		}
+		r.mu.Lock()
+		healthy := r.healthy
+		r.mu.Unlock()
+		if !healthy {
+			return nil, fmt.Errorf("从库 %s 已未通过健康检查，请重新执行查询", addr)
+		}
+		return r.db, nil
+	}
+	return nil, fmt.Errorf("从库 %s 不存在，请重新执行查询", addr)
+}
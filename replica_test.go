@@ -0,0 +1,80 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+// useReplicas 临时替换从库列表，测试结束后恢复
+func useReplicas(t *testing.T, items ...*replica) {
+	t.Helper()
+	replicas.Lock()
+	saved, savedNext := replicas.items, replicas.next
+	replicas.items, replicas.next = items, 0
+	replicas.Unlock()
+	t.Cleanup(func() {
+		replicas.Lock()
+		replicas.items, replicas.next = saved, savedNext
+		replicas.Unlock()
+	})
+}
+
+// 健康的从库之间轮询，跳过未通过健康检查的从库
+func TestPickReplica(t *testing.T) {
+	a := &replica{addr: "a:3306", healthy: true}
+	b := &replica{addr: "b:3306"}
+	c := &replica{addr: "c:3306", healthy: true}
+	useReplicas(t, a, b, c)
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, pickReplica().addr)
+	}
+	if strings.Join(got, ",") != "a:3306,c:3306,a:3306,c:3306" {
+		t.Errorf("picked = %v", got)
+	}
+
+	a.healthy, c.healthy = false, false
+	if r := pickReplica(); r != nil {
+		t.Errorf("picked unhealthy replica %s", r.addr)
+	}
+}
+
+func TestReadDBRouting(t *testing.T) {
+	primary := db
+	defer func() { db = primary }()
+	db = &sql.DB{}
+	r := &replica{addr: "r:3306", db: &sql.DB{}, healthy: true}
+
+	tests := []struct {
+		replicas      []*replica
+		route         string
+		preferReplica bool
+		want          *sql.DB
+		wantErr       string
+	}{
+		{[]*replica{r}, "", true, r.db, ""},
+		{[]*replica{r}, routeAuto, false, db, ""},
+		{[]*replica{r}, routePrimary, true, db, ""},
+		{[]*replica{r}, routeReplica, false, r.db, ""},
+		{nil, "", true, db, ""},
+		{nil, routeReplica, true, nil, "未配置从库"},
+		{[]*replica{{addr: "down:3306"}}, "", true, db, ""},
+		{[]*replica{{addr: "down:3306"}}, routeReplica, true, nil, "没有可用的从库"},
+		{nil, "standby", true, nil, "route 只能是"},
+	}
+	for _, tt := range tests {
+		useReplicas(t, tt.replicas...)
+		got, err := readDB(map[string]interface{}{"route": tt.route}, tt.preferReplica)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("route %q with %d replicas: err = %v, want %q", tt.route, len(tt.replicas), err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("route %q, preferReplica %v: pool = %p, err = %v; want %p", tt.route, tt.preferReplica, got, err, tt.want)
+		}
+	}
+}
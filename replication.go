@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// replicationIssue 复制状态检查发现的问题，level 为 error 或 warning
+type replicationIssue struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// replicationStatus 查看复制状态：从库通道、binlog 位点、GTID、performance_schema 中的连接和应用线程状态以及组复制成员，
+// 并给出健康结论
+func replicationStatus(request map[string]interface{}) (*mcp.CallToolResult, error) {
+	pool, name, err := replicationTarget(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	version, err := fetchServerVersion(ctx, pool)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("查询失败: %v", err)), nil
+	}
+
+	report := map[string]interface{}{
+		"server":  name,
+		"version": version.raw,
+	}
+	issues := []replicationIssue{}
+	unavailable := map[string]string{}
+
+	// 作为从库的复制通道
+	channels, err := replicaStatusRows(ctx, pool)
+	if err != nil {
+		unavailable["replica_status"] = err.Error()
+	}
+	var channelInfo []map[string]interface{}
+	var maxLag sql.NullInt64
+	for _, ch := range channels {
+		info, chIssues := describeChannel(ch)
+		channelInfo = append(channelInfo, info)
+		issues = append(issues, chIssues...)
+		if lag, ok := info["lag_seconds"].(int64); ok && (!maxLag.Valid || lag > maxLag.Int64) {
+			maxLag = sql.NullInt64{Int64: lag, Valid: true}
+		}
+	}
+	if len(channelInfo) > 0 {
+		report["replica_channels"] = channelInfo
+	}
+
+	// 作为主库的 binlog 位点，8.2 起改名为 SHOW BINARY LOG STATUS
+	binlogStatement := "SHOW MASTER STATUS"
+	if !version.mariaDB && version.atLeast(8, 2, 0) {
+		binlogStatement = "SHOW BINARY LOG STATUS"
+	}
+	if rows, err := queryNamedRows(ctx, pool, binlogStatement); err != nil {
+		unavailable["binary_log"] = err.Error()
+	} else if len(rows) > 0 {
+		report["binary_log"] = nullRowMap(rows[0])
+	}
+
+	gtidVariable := "@@GLOBAL.gtid_mode"
+	if version.mariaDB {
+		gtidVariable = "@@GLOBAL.gtid_current_pos"
+	}
+	var gtid sql.NullString
+	if err := pool.QueryRowContext(ctx, "SELECT "+gtidVariable).Scan(&gtid); err == nil && gtid.Valid {
+		report[strings.TrimPrefix(gtidVariable, "@@GLOBAL.")] = gtid.String
+	}
+
+	// performance_schema 中的接收和应用线程状态，以及组复制成员（MariaDB 没有这些表）
+	var members []map[string]sql.NullString
+	if !version.mariaDB {
+		for _, table := range []string{"replication_connection_status", "replication_applier_status_by_worker", "replication_group_members"} {
+			rows, err := queryNamedRows(ctx, pool, "SELECT * FROM performance_schema."+table)
+			if err != nil {
+				unavailable[table] = err.Error()
+				continue
+			}
+			switch table {
+			case "replication_connection_status":
+				for _, row := range rows {
+					if msg := row["LAST_ERROR_MESSAGE"].String; msg != "" && row["SERVICE_STATE"].String != "ON" {
+						issues = append(issues, replicationIssue{"error", fmt.Sprintf("%s接收线程 %s：%s", channelLabel(row["CHANNEL_NAME"].String), row["SERVICE_STATE"].String, msg)})
+					}
+				}
+			case "replication_applier_status_by_worker":
+				for _, row := range rows {
+					if n := row["LAST_ERROR_NUMBER"].String; n != "" && n != "0" && row["SERVICE_STATE"].String != "ON" {
+						issues = append(issues, replicationIssue{"error", fmt.Sprintf("%s应用线程 %s 出错 %s：%s", channelLabel(row["CHANNEL_NAME"].String), row["WORKER_ID"].String, n, row["LAST_ERROR_MESSAGE"].String)})
+					}
+				}
+			case "replication_group_members":
+				// 未开启组复制时也会有一行 MEMBER_STATE 为空或 OFFLINE 的本机记录
+				active := false
+				for _, row := range rows {
+					state := row["MEMBER_STATE"].String
+					active = active || state != "" && state != "OFFLINE"
+				}
+				if !active {
+					continue
+				}
+				members = rows
+			}
+			if len(rows) > 0 {
+				list := make([]map[string]interface{}, len(rows))
+				for i, row := range rows {
+					list[i] = nullRowMap(row)
+				}
+				report[table] = list
+			}
+		}
+	}
+
+	online := 0
+	for _, m := range members {
+		if m["MEMBER_STATE"].String == "ONLINE" {
+			online++
+		} else {
+			issues = append(issues, replicationIssue{"warning", fmt.Sprintf("组复制成员 %s:%s 状态为 %s", m["MEMBER_HOST"].String, m["MEMBER_PORT"].String, m["MEMBER_STATE"].String)})
+		}
+	}
+	if len(members) > 0 && online*2 <= len(members) {
+		issues = append(issues, replicationIssue{"error", fmt.Sprintf("组复制只有 %d/%d 个成员在线，已失去多数派", online, len(members))})
+	}
+
+	role := "standalone"
+	switch {
+	case len(members) > 0:
+		role = "group_member"
+	case len(channels) > 0:
+		role = "replica"
+	case report["binary_log"] != nil:
+		role = "source"
+	}
+	report["role"] = role
+
+	verdict := "healthy"
+	for _, issue := range issues {
+		if issue.Level == "error" {
+			verdict = "error"
+			break
+		}
+		verdict = "warning"
+	}
+	report["verdict"] = verdict
+	report["summary"] = replicationSummary(role, verdict, issues, len(channels), maxLag, online, len(members), report["binary_log"])
+	report["issues"] = issues
+	if len(unavailable) > 0 {
+		report["unavailable"] = unavailable
+	}
+	if len(replicas.items) > 0 {
+		report["configured_replicas"] = replicaHealth()
+	}
+
+	jsonData, _ := json.MarshalIndent(report, "", "  ")
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+// replicationTarget server 参数为空或 primary 时查看主库，否则查看 MYSQL_REPLICAS 中对应地址的从库（不论是否健康）
+func replicationTarget(request map[string]interface{}) (*sql.DB, string, error) {
+	server, _ := request["server"].(string)
+	if server == "" || server == routePrimary {
+		return db, routePrimary, nil
+	}
+	var addrs []string
+	for _, r := range replicas.items {
+		if r.addr == server {
+			return r.db, r.addr, nil
+		}
+		addrs = append(addrs, r.addr)
+	}
+	if len(addrs) == 0 {
+		return nil, "", fmt.Errorf("未配置从库（MYSQL_REPLICAS），server 只能是 primary")
+	}
+	return nil, "", fmt.Errorf("未找到从库 %s，可选：primary、%s", server, strings.Join(addrs, "、"))
+}
+
+// describeChannel 整理 SHOW REPLICA STATUS 的一行，并检查线程状态和延迟
+func describeChannel(ch map[string]sql.NullString) (map[string]interface{}, []replicationIssue) {
+	field := func(names ...string) string {
+		return statusField(ch, names...).String
+	}
+	label := channelLabel(field("Channel_Name", "Connection_name"))
+	ioRunning := field("Replica_IO_Running", "Slave_IO_Running")
+	sqlRunning := field("Replica_SQL_Running", "Slave_SQL_Running")
+	source := field("Source_Host", "Master_Host") + ":" + field("Source_Port", "Master_Port")
+
+	info := map[string]interface{}{
+		"channel":     field("Channel_Name", "Connection_name"),
+		"source":      source,
+		"io_running":  ioRunning,
+		"sql_running": sqlRunning,
+		"io_state":    field("Replica_IO_State", "Slave_IO_State"),
+		"sql_state":   field("Replica_SQL_Running_State", "Slave_SQL_Running_State"),
+	}
+	// 已读取到和已执行到的主库 binlog 位点
+	if file := field("Source_Log_File", "Master_Log_File"); file != "" {
+		info["read_position"] = file + ":" + field("Read_Source_Log_Pos", "Read_Master_Log_Pos")
+	}
+	if file := field("Relay_Source_Log_File", "Relay_Master_Log_File"); file != "" {
+		info["exec_position"] = file + ":" + field("Exec_Source_Log_Pos", "Exec_Master_Log_Pos")
+	}
+	lag := statusField(ch, "Seconds_Behind_Source", "Seconds_Behind_Master")
+	if n, err := strconv.ParseInt(lag.String, 10, 64); lag.Valid && err == nil {
+		info["lag_seconds"] = n
+	} else {
+		info["lag_seconds"] = nil
+	}
+	optional := map[string][]string{
+		"last_io_error":       {"Last_IO_Error"},
+		"last_io_error_time":  {"Last_IO_Error_Timestamp"},
+		"last_sql_error":      {"Last_SQL_Error"},
+		"last_sql_error_time": {"Last_SQL_Error_Timestamp"},
+		"retrieved_gtid_set":  {"Retrieved_Gtid_Set"},
+		"executed_gtid_set":   {"Executed_Gtid_Set"},
+		"auto_position":       {"Auto_Position"},
+		"gtid_io_pos":         {"Gtid_IO_Pos"},
+		"using_gtid":          {"Using_Gtid"},
+	}
+	for key, names := range optional {
+		if v := field(names...); v != "" {
+			info[key] = v
+		}
+	}
+
+	var issues []replicationIssue
+	switch ioRunning {
+	case "Yes":
+	case "Connecting":
+		issues = append(issues, replicationIssue{"warning", fmt.Sprintf("%sIO 线程正在连接主库 %s%s", label, source, errorDetail(field("Last_IO_Error")))})
+	default:
+		issues = append(issues, replicationIssue{"error", fmt.Sprintf("%sIO 线程未运行%s", label, errorDetail(field("Last_IO_Error")))})
+	}
+	if sqlRunning != "Yes" {
+		issues = append(issues, replicationIssue{"error", fmt.Sprintf("%sSQL 线程未运行%s", label, errorDetail(field("Last_SQL_Error")))})
+	}
+	if ioRunning == "Yes" && sqlRunning == "Yes" {
+		maxLag := int64(getEnvInt("REPLICA_MAX_LAG", defaultReplicaMaxLag))
+		if n, ok := info["lag_seconds"].(int64); !ok {
+			issues = append(issues, replicationIssue{"warning", label + "无法获取复制延迟"})
+		} else if n > maxLag {
+			issues = append(issues, replicationIssue{"warning", fmt.Sprintf("%s复制延迟 %d 秒，超过 REPLICA_MAX_LAG=%d", label, n, maxLag)})
+		}
+	}
+	return info, issues
+}
+
+func errorDetail(msg string) string {
+	if msg == "" {
+		return ""
+	}
+	return "：" + msg
+}
+
+func channelLabel(channel string) string {
+	if channel == "" {
+		return ""
+	}
+	return fmt.Sprintf("通道 %s 的", channel)
+}
+
+// replicationSummary 用一句话概括复制状态
+func replicationSummary(role, verdict string, issues []replicationIssue, channels int, maxLag sql.NullInt64, online, members int, binlog interface{}) string {
+	if verdict != "healthy" {
+		messages := make([]string, len(issues))
+		for i, issue := range issues {
+			messages[i] = issue.Message
+		}
+		prefix := "复制存在风险："
+		if verdict == "error" {
+			prefix = "复制异常："
+		}
+		return prefix + strings.Join(messages, "；")
+	}
+	switch role {
+	case "group_member":
+		return fmt.Sprintf("组复制正常，%d/%d 个成员在线", online, members)
+	case "replica":
+		if maxLag.Valid {
+			return fmt.Sprintf("从库复制正常，%d 个通道，最大延迟 %d 秒", channels, maxLag.Int64)
+		}
+		return fmt.Sprintf("从库复制正常，%d 个通道", channels)
+	case "source":
+		log, _ := binlog.(map[string]interface{})
+		return fmt.Sprintf("本实例没有作为从库复制，binlog 当前位于 %v:%v", log["File"], log["Position"])
+	}
+	return "本实例没有配置复制，也没有开启 binlog"
+}
+
+// nullRowMap 把按列名读取的一行转为 JSON 友好的 map，NULL 为 nil
+func nullRowMap(row map[string]sql.NullString) map[string]interface{} {
+	out := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		if v.Valid {
+			out[k] = v.String
+		} else {
+			out[k] = nil
+		}
+	}
+	return out
+}
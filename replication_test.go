@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func statusRow(fields map[string]string, nulls ...string) map[string]sql.NullString {
+	row := map[string]sql.NullString{}
+	for k, v := range fields {
+		row[k] = sql.NullString{String: v, Valid: true}
+	}
+	for _, k := range nulls {
+		row[k] = sql.NullString{}
+	}
+	return row
+}
+
+// 新旧两种列名（Replica_* / Slave_*）都能识别，线程状态和延迟按 REPLICA_MAX_LAG 给出问题
+func TestDescribeChannel(t *testing.T) {
+	t.Setenv("REPLICA_MAX_LAG", "30")
+	tests := []struct {
+		name    string
+		row     map[string]sql.NullString
+		lag     interface{}
+		wantMsg []string
+	}{
+		{"healthy", statusRow(map[string]string{
+			"Replica_IO_Running": "Yes", "Replica_SQL_Running": "Yes", "Source_Host": "db1", "Source_Port": "3306",
+			"Seconds_Behind_Source": "3", "Source_Log_File": "binlog.000007", "Read_Source_Log_Pos": "120",
+		}), int64(3), nil},
+		{"legacy lagging", statusRow(map[string]string{
+			"Slave_IO_Running": "Yes", "Slave_SQL_Running": "Yes", "Master_Host": "db1", "Master_Port": "3306",
+			"Seconds_Behind_Master": "120",
+		}), int64(120), []string{"warning:复制延迟 120 秒，超过 REPLICA_MAX_LAG=30"}},
+		{"connecting", statusRow(map[string]string{
+			"Replica_IO_Running": "Connecting", "Replica_SQL_Running": "Yes", "Source_Host": "db1", "Source_Port": "3306",
+			"Last_IO_Error": "access denied", "Channel_Name": "c1",
+		}, "Seconds_Behind_Source"), nil, []string{"warning:通道 c1 的IO 线程正在连接主库 db1:3306：access denied"}},
+		{"sql stopped", statusRow(map[string]string{
+			"Replica_IO_Running": "Yes", "Replica_SQL_Running": "No", "Source_Host": "db1", "Source_Port": "3306",
+			"Last_SQL_Error": "duplicate key",
+		}, "Seconds_Behind_Source"), nil, []string{"error:SQL 线程未运行：duplicate key"}},
+		{"lag unknown", statusRow(map[string]string{
+			"Replica_IO_Running": "Yes", "Replica_SQL_Running": "Yes", "Source_Host": "db1", "Source_Port": "3306",
+		}, "Seconds_Behind_Source"), nil, []string{"warning:无法获取复制延迟"}},
+	}
+	for _, tt := range tests {
+		info, issues := describeChannel(tt.row)
+		if info["source"] != "db1:3306" || !reflect.DeepEqual(info["lag_seconds"], tt.lag) {
+			t.Errorf("%s: source = %v, lag = %#v, want %#v", tt.name, info["source"], info["lag_seconds"], tt.lag)
+		}
+		var got []string
+		for _, issue := range issues {
+			got = append(got, issue.Level+":"+issue.Message)
+		}
+		if !reflect.DeepEqual(got, tt.wantMsg) {
+			t.Errorf("%s: issues = %q, want %q", tt.name, got, tt.wantMsg)
+		}
+	}
+
+	info, _ := describeChannel(tests[0].row)
+	if info["read_position"] != "binlog.000007:120" {
+		t.Errorf("read_position = %v", info["read_position"])
+	}
+}
+
+func TestReplicationSummary(t *testing.T) {
+	lag := sql.NullInt64{Int64: 4, Valid: true}
+	binlog := map[string]interface{}{"File": "binlog.000003", "Position": "157"}
+	issues := []replicationIssue{{"error", "IO 线程未运行"}, {"warning", "无法获取复制延迟"}}
+	tests := []struct {
+		role, verdict string
+		want          string
+	}{
+		{"replica", "healthy", "从库复制正常，2 个通道，最大延迟 4 秒"},
+		{"group_member", "healthy", "组复制正常，2/3 个成员在线"},
+		{"source", "healthy", "本实例没有作为从库复制，binlog 当前位于 binlog.000003:157"},
+		{"standalone", "healthy", "本实例没有配置复制，也没有开启 binlog"},
+		{"replica", "error", "复制异常：IO 线程未运行；无法获取复制延迟"},
+		{"replica", "warning", "复制存在风险：IO 线程未运行；无法获取复制延迟"},
+	}
+	for _, tt := range tests {
+		if got := replicationSummary(tt.role, tt.verdict, issues, 2, lag, 2, 3, binlog); got != tt.want {
+			t.Errorf("%s/%s = %q, want %q", tt.role, tt.verdict, got, tt.want)
+		}
+	}
+}
+
+// server 参数选择主库或 MYSQL_REPLICAS 中的从库，不健康的从库也可以查看
+func TestReplicationTarget(t *testing.T) {
+	r := &replica{addr: "10.0.0.11:3306", db: &sql.DB{}}
+	useReplicas(t, r)
+
+	if _, name, err := replicationTarget(map[string]interface{}{}); err != nil || name != routePrimary {
+		t.Errorf("default target = %s, %v", name, err)
+	}
+	if pool, name, err := replicationTarget(map[string]interface{}{"server": r.addr}); err != nil || pool != r.db || name != r.addr {
+		t.Errorf("replica target = %s, %v", name, err)
+	}
+	if _, _, err := replicationTarget(map[string]interface{}{"server": "10.0.0.12:3306"}); err == nil || !strings.Contains(err.Error(), "可选：primary、10.0.0.11:3306") {
+		t.Errorf("unknown target: err = %v", err)
+	}
+}
+
+func TestServerVersionAtLeast(t *testing.T) {
+	v := serverVersion{major: 8, minor: 0, patch: 22}
+	for _, tt := range []struct {
+		major, minor, patch int
+		want                bool
+	}{
+		{8, 0, 22, true},
+		{8, 0, 23, false},
+		{5, 7, 44, true},
+		{8, 1, 0, false},
+	} {
+		if got := v.atLeast(tt.major, tt.minor, tt.patch); got != tt.want {
+			t.Errorf("8.0.22 atLeast(%d.%d.%d) = %v, want %v", tt.major, tt.minor, tt.patch, got, tt.want)
+		}
+	}
+}
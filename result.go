@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nullText 文本类格式（csv / tsv / markdown）中 NULL 的统一表示
+const nullText = "NULL"
+
+// resultFormats execute_query 支持的输出格式
+var resultFormats = []string{"json", "jsonl", "csv", "tsv", "markdown"}
+
+// binaryEncodings 二进制数据的输出编码
+var binaryEncodings = []string{"base64", "hex"}
+
+// queryResult 按列顺序保存的查询结果
+type queryResult struct {
+	columns []string
+	types   []columnMeta
+	rows    [][]interface{}
+}
+
+// columnMeta 返回给调用方的列类型信息
+type columnMeta struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Nullable  *bool  `json:"nullable,omitempty"`
+	Length    *int64 `json:"length,omitempty"`
+	Precision *int64 `json:"precision,omitempty"`
+	Scale     *int64 `json:"scale,omitempty"`
+	Encoding  string `json:"encoding,omitempty"` // 值的表示方式：string（精确小数）、json、base64、hex
+	Masked    string `json:"masked,omitempty"`   // 整列脱敏的方式：redact / partial / hash / tokenize
+}
+
+// scanRows 读取结果行（maxRows 大于 0 时最多读取 maxRows 行），列顺序与 rows.Columns() 一致，值按列类型转换
+func scanRows(rows *sql.Rows, binaryEncoding string, maxRows int) (*queryResult, error) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &queryResult{
+		columns: make([]string, len(columnTypes)),
+		types:   make([]columnMeta, len(columnTypes)),
+		rows:    [][]interface{}{},
+	}
+	for i, ct := range columnTypes {
+		result.columns[i] = ct.Name()
+		result.types[i] = newColumnMeta(ct, binaryEncoding)
+	}
+
+	for (maxRows <= 0 || len(result.rows) < maxRows) && rows.Next() {
+		values := make([]interface{}, len(columnTypes))
+		valuePtrs := make([]interface{}, len(columnTypes))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, err
+		}
+
+		for i, val := range values {
+			values[i] = convertValue(val, columnTypes[i].DatabaseTypeName(), binaryEncoding)
+		}
+		result.rows = append(result.rows, values)
+	}
+	return result, rows.Err()
+}
+
+func newColumnMeta(ct *sql.ColumnType, binaryEncoding string) columnMeta {
+	meta := columnMeta{Name: ct.Name(), Type: ct.DatabaseTypeName()}
+	if nullable, ok := ct.Nullable(); ok {
+		meta.Nullable = &nullable
+	}
+	if length, ok := ct.Length(); ok {
+		meta.Length = &length
+	}
+	if precision, scale, ok := ct.DecimalSize(); ok {
+		meta.Precision, meta.Scale = &precision, &scale
+	}
+
+	switch {
+	case meta.Type == "DECIMAL":
+		meta.Encoding = "string"
+	case meta.Type == "JSON":
+		meta.Encoding = "json"
+	case isBinaryType(meta.Type):
+		meta.Encoding = normalizeBinaryEncoding(binaryEncoding)
+	}
+	return meta
+}
+
+func isBinaryType(typeName string) bool {
+	switch typeName {
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "GEOMETRY":
+		return true
+	}
+	return false
+}
+
+func normalizeBinaryEncoding(encoding string) string {
+	if encoding == "hex" {
+		return "hex"
+	}
+	return "base64"
+}
+
+// convertValue 按 MySQL 列类型转换驱动返回的值。
+// 文本协议下驱动对所有列返回 []byte，预处理语句（二进制协议）下返回具体类型，两种情况都需要处理。
+func convertValue(val interface{}, typeName, binaryEncoding string) interface{} {
+	if val == nil {
+		return nil
+	}
+
+	b, isBytes := val.([]byte)
+	switch typeName {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR":
+		if isBytes {
+			if n, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+				return n
+			}
+		}
+	case "UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED INT", "UNSIGNED BIGINT":
+		if isBytes {
+			if n, err := strconv.ParseUint(string(b), 10, 64); err == nil {
+				return n
+			}
+		}
+	case "FLOAT", "DOUBLE":
+		if isBytes {
+			if f, err := strconv.ParseFloat(string(b), 64); err == nil {
+				return f
+			}
+		}
+	case "DECIMAL":
+		// 精确小数保持字符串，避免转为 float64 丢失精度
+		if isBytes {
+			return string(b)
+		}
+		return fmt.Sprint(val)
+	case "BIT":
+		if isBytes {
+			var n uint64
+			for _, c := range b {
+				n = n<<8 | uint64(c)
+			}
+			return n
+		}
+	case "JSON":
+		if isBytes && json.Valid(b) {
+			return json.RawMessage(append([]byte(nil), b...))
+		}
+	case "DATE":
+		if t, ok := val.(time.Time); ok {
+			return t.Format("2006-01-02")
+		}
+	case "DATETIME", "TIMESTAMP":
+		if t, ok := val.(time.Time); ok {
+			return formatTimestamp(t)
+		}
+		if isBytes {
+			// 未开启 parseTime 时驱动返回文本，按驱动默认的 UTC 解析；零值日期保持原样
+			if t, err := time.ParseInLocation("2006-01-02 15:04:05.999999", string(b), time.UTC); err == nil {
+				return formatTimestamp(t)
+			}
+		}
+	default:
+		if isBinaryType(typeName) && isBytes {
+			return encodeBinary(b, binaryEncoding)
+		}
+	}
+
+	if isBytes {
+		return string(b)
+	}
+	return val
+}
+
+// formatTimestamp 输出带时区的 ISO 8601 时间
+func formatTimestamp(t time.Time) string {
+	return t.Format("2006-01-02T15:04:05.999999Z07:00")
+}
+
+// encodeBinary 二进制数据编码为带前缀标记的字符串：base64:xxx 或 0xABCD
+func encodeBinary(b []byte, encoding string) string {
+	if normalizeBinaryEncoding(encoding) == "hex" {
+		return "0x" + strings.ToUpper(hex.EncodeToString(b))
+	}
+	return "base64:" + base64.StdEncoding.EncodeToString(b)
+}
+
+// formatQueryResult 将查询结果渲染为指定格式，page 为分页信息（仅 json 格式内嵌输出）
+func formatQueryResult(query string, result *queryResult, format string, page map[string]interface{}) (string, error) {
+	switch format {
+	case "", "json":
+		out := map[string]interface{}{
+			"query":        query,
+			"columns":      result.columns,
+			"column_types": result.types,
+			"rows":         result.rows,
+			"count":        len(result.rows),
+		}
+		if page != nil {
+			out["page"] = page
+		}
+		// 使用紧凑格式，避免逐个值换行占用上下文
+		data, err := json.Marshal(out)
+		return string(data), err
+	case "jsonl":
+		return formatJSONLines(result)
+	case "csv":
+		return formatDelimited(result, ',')
+	case "tsv":
+		return formatTSV(result), nil
+	case "markdown", "md":
+		return formatMarkdownTable(result), nil
+	default:
+		return "", fmt.Errorf("不支持的输出格式: %s（可选 %s）", format, strings.Join(resultFormats, " / "))
+	}
+}
+
+// formatJSONLines 每行一个 JSON 对象，对象字段按列顺序输出
+func formatJSONLines(result *queryResult) (string, error) {
+	var sb strings.Builder
+	for _, row := range result.rows {
+		line, err := orderedJSONObject(result.columns, row)
+		if err != nil {
+			return "", err
+		}
+		sb.Write(line)
+		sb.WriteByte('\n')
+	}
+	return sb.String(), nil
+}
+
+// orderedJSONObject 按给定顺序输出 JSON 对象（map 无法保证字段顺序）
+func orderedJSONObject(columns []string, row []interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, col := range columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(col)
+		buf.Write(key)
+		buf.WriteByte(':')
+		val, err := json.Marshal(row[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func formatDelimited(result *queryResult, comma rune) (string, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = comma
+
+	if err := w.Write(result.columns); err != nil {
+		return "", err
+	}
+	record := make([]string, len(result.columns))
+	for _, row := range result.rows {
+		for i, v := range row {
+			record[i] = cellText(v)
+		}
+		if err := w.Write(record); err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+	return buf.String(), w.Error()
+}
+
+// formatTSV 输出制表符分隔文本，值中的制表符和换行使用反斜杠转义
+func formatTSV(result *queryResult) string {
+	escape := strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+	var sb strings.Builder
+	for i, col := range result.columns {
+		if i > 0 {
+			sb.WriteByte('\t')
+		}
+		sb.WriteString(escape.Replace(col))
+	}
+	sb.WriteByte('\n')
+	for _, row := range result.rows {
+		for i, v := range row {
+			if i > 0 {
+				sb.WriteByte('\t')
+			}
+			sb.WriteString(escape.Replace(cellText(v)))
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func formatMarkdownTable(result *queryResult) string {
+	rows := make([][]string, len(result.rows))
+	for i, row := range result.rows {
+		cells := make([]string, len(row))
+		for j, v := range row {
+			cells[j] = cellText(v)
+		}
+		rows[i] = cells
+	}
+	return markdownTable(result.columns, rows)
+}
+
+// cellText 将单元格值转为文本，NULL 统一输出为 nullText
+func cellText(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return nullText
+	case string:
+		return val
+	case json.RawMessage:
+		return string(val)
+	case time.Time:
+		return val.Format("2006-01-02 15:04:05")
+	default:
+		return fmt.Sprint(val)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 文本协议返回的 []byte 和二进制协议返回的具体类型都按列类型转换
+func TestConvertValue(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	tests := []struct {
+		val      interface{}
+		typeName string
+		encoding string
+		want     interface{}
+	}{
+		{nil, "INT", "", nil},
+		{[]byte("-42"), "INT", "", int64(-42)},
+		{[]byte("18446744073709551615"), "UNSIGNED BIGINT", "", uint64(18446744073709551615)},
+		{[]byte("1.5"), "DOUBLE", "", 1.5},
+		{[]byte("12345678901234567890.123"), "DECIMAL", "", "12345678901234567890.123"},
+		{1.25, "DECIMAL", "", "1.25"},
+		{[]byte{0x01, 0x02}, "BIT", "", uint64(258)},
+		{[]byte(`{"a":1}`), "JSON", "", json.RawMessage(`{"a":1}`)},
+		{[]byte(`not json`), "JSON", "", "not json"},
+		{time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), "DATE", "", "2024-01-02"},
+		{time.Date(2024, 1, 2, 15, 4, 5, 500000000, shanghai), "DATETIME", "", "2024-01-02T15:04:05.5+08:00"},
+		{[]byte("2024-01-02 15:04:05"), "TIMESTAMP", "", "2024-01-02T15:04:05Z"},
+		{[]byte("0000-00-00 00:00:00"), "DATETIME", "", "0000-00-00 00:00:00"},
+		{[]byte("hi"), "BLOB", "", "base64:aGk="},
+		{[]byte("hi"), "VARBINARY", "hex", "0x6869"},
+		{[]byte("abc"), "VARCHAR", "hex", "abc"},
+		{int64(7), "INT", "", int64(7)},
+	}
+	for _, tt := range tests {
+		if got := convertValue(tt.val, tt.typeName, tt.encoding); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("convertValue(%#v, %s) = %#v, want %#v", tt.val, tt.typeName, got, tt.want)
+		}
+	}
+}
+
+// 各输出格式保持列顺序，NULL 输出为 NULL，分隔符和换行按格式转义
+func TestFormatQueryResult(t *testing.T) {
+	result := &queryResult{
+		columns: []string{"id", "name", "note"},
+		rows: [][]interface{}{
+			{int64(1), "a,b", nil},
+			{int64(2), "tab\there", json.RawMessage(`{"k":1}`)},
+		},
+	}
+	tests := []struct{ format, want string }{
+		{"jsonl", `{"id":1,"name":"a,b","note":null}` + "\n" + `{"id":2,"name":"tab\there","note":{"k":1}}` + "\n"},
+		{"csv", "id,name,note\n1,\"a,b\",NULL\n2,tab\there,\"{\"\"k\"\":1}\"\n"},
+		{"tsv", "id\tname\tnote\n1\ta,b\tNULL\n2\ttab\\there\t{\"k\":1}\n"},
+		{"markdown", "| id | name | note |\n| --- | --- | --- |\n| 1 | a,b | NULL |\n| 2 | tab\there | {\"k\":1} |\n"},
+	}
+	for _, tt := range tests {
+		got, err := formatQueryResult("SELECT 1", result, tt.format, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s:\n got %q\nwant %q", tt.format, got, tt.want)
+		}
+	}
+
+	// json 格式内嵌分页信息
+	got, err := formatQueryResult("SELECT 1", result, "", map[string]interface{}{"has_more": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Columns []string               `json:"columns"`
+		Count   int                    `json:"count"`
+		Page    map[string]interface{} `json:"page"`
+	}
+	if err := json.Unmarshal([]byte(got), &out); err != nil || out.Count != 2 || strings.Join(out.Columns, ",") != "id,name,note" || out.Page["has_more"] != true {
+		t.Errorf("json = %s, err = %v", got, err)
+	}
+
+	if _, err := formatQueryResult("SELECT 1", result, "xml", nil); err == nil || !strings.Contains(err.Error(), "不支持的输出格式") {
+		t.Errorf("xml: err = %v", err)
+	}
+}
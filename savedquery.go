@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"gopkg.in/yaml.v3"
+)
+
+// savedQuery 查询库中的一条命名查询
+type savedQuery struct {
+	Name        string       `yaml:"name" json:"name"`
+	Description string       `yaml:"description" json:"description,omitempty"`
+	Connection  string       `yaml:"connection" json:"connection,omitempty"` // 默认路由，取值同 route 参数
+	Params      []savedParam `yaml:"params" json:"params,omitempty"`
+	File        string       `yaml:"-" json:"file"`
+	SQL         string       `yaml:"-" json:"-"`
+}
+
+// savedParam 查询参数定义，type 与 execute_query 的 args 类型一致
+type savedParam struct {
+	Name        string        `yaml:"name" json:"name"`
+	Type        string        `yaml:"type" json:"type"`
+	Required    bool          `yaml:"required" json:"required,omitempty"`
+	Default     interface{}   `yaml:"default" json:"default,omitempty"`
+	Enum        []interface{} `yaml:"enum" json:"enum,omitempty"`
+	Description string        `yaml:"description" json:"description,omitempty"`
+}
+
+// savedQueryDir 查询库目录
+func savedQueryDir() string {
+	return getEnv("SAVED_QUERY_DIR", "queries")
+}
+
+// loadSavedQueries 读取目录（含子目录）下的全部 .sql 文件，解析失败的文件记录在 errs 中
+func loadSavedQueries(dir string) (queries []*savedQuery, errs []string, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".sql") {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		q, err := parseSavedQueryFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", rel, err))
+			return nil
+		}
+		q.File = rel
+		queries = append(queries, q)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取查询库目录失败: %v", err)
+	}
+	sort.Slice(queries, func(i, j int) bool { return queries[i].Name < queries[j].Name })
+	return queries, errs, nil
+}
+
+// parseSavedQueryFile 解析查询文件。文件开头为 YAML front-matter，支持两种写法：
+//
+//	---                 -- ---
+//	name: xxx           -- name: xxx
+//	---                 -- ---
+//
+// 后一种写在注释中，文件本身仍是合法的 SQL。
+func parseSavedQueryFile(path string) (*savedQuery, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+
+	start := 0
+	for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	prefix := ""
+	switch {
+	case start < len(lines) && strings.TrimSpace(lines[start]) == "---":
+	case start < len(lines) && strings.TrimSpace(lines[start]) == "-- ---":
+		prefix = "--"
+	default:
+		return nil, fmt.Errorf("缺少 front-matter")
+	}
+
+	var meta []string
+	end := -1
+	for i := start + 1; i < len(lines); i++ {
+		line := lines[i]
+		if prefix != "" {
+			trimmed := strings.TrimLeft(line, " \t")
+			if !strings.HasPrefix(trimmed, prefix) {
+				break
+			}
+			line = strings.TrimPrefix(strings.TrimPrefix(trimmed, prefix), " ")
+		}
+		if strings.TrimSpace(line) == "---" {
+			end = i
+			break
+		}
+		meta = append(meta, line)
+	}
+	if end < 0 {
+		return nil, fmt.Errorf("front-matter 没有结束标记 ---")
+	}
+
+	var q savedQuery
+	if err := yaml.Unmarshal([]byte(strings.Join(meta, "\n")), &q); err != nil {
+		return nil, fmt.Errorf("front-matter 解析失败: %v", err)
+	}
+	if q.Name == "" {
+		q.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	q.SQL = trimStatement(strings.Join(lines[end+1:], "\n"))
+	if q.SQL == "" {
+		return nil, fmt.Errorf("查询语句为空")
+	}
+	if err := checkReadOnlyQuery(q.SQL); err != nil {
+		return nil, err
+	}
+	switch q.Connection {
+	case "", routeAuto, routePrimary, routeReplica:
+	case "default": // 早期版本唯一支持的取值
+		q.Connection = routeAuto
+	default:
+		return nil, fmt.Errorf("connection 只能是 %s / %s / %s", routeAuto, routePrimary, routeReplica)
+	}
+
+	declared := map[string]bool{}
+	for i, p := range q.Params {
+		if p.Name == "" {
+			return nil, fmt.Errorf("params[%d] 缺少 name", i)
+		}
+		if declared[p.Name] {
+			return nil, fmt.Errorf("参数 %s 重复定义", p.Name)
+		}
+		declared[p.Name] = true
+		if p.Type == "" {
+			q.Params[i].Type = "string"
+		}
+		q.Params[i].Default = yamlScalarText(p.Default, q.Params[i].Type)
+		for j, e := range p.Enum {
+			p.Enum[j] = yamlScalarText(e, q.Params[i].Type)
+		}
+	}
+	for _, name := range namedPlaceholders(q.SQL) {
+		if !declared[name] {
+			return nil, fmt.Errorf("语句中的 :%s 没有在 params 中声明", name)
+		}
+	}
+	return &q, nil
+}
+
+// yamlScalarText YAML 会把未加引号的日期解析为 time.Time，转回参数类型对应的文本
+func yamlScalarText(v interface{}, typ string) interface{} {
+	t, ok := v.(time.Time)
+	if !ok {
+		return v
+	}
+	if typ == "date" {
+		return t.Format("2006-01-02")
+	}
+	return formatTimestamp(t)
+}
+
+// namedPlaceholders 按出现顺序返回语句中的 :name 占位符
+func namedPlaceholders(query string) []string {
+	var names []string
+	tokens := tokenizeSQL(query)
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i].text == ":" && tokens[i+1].kind == tokWord && tokens[i+1].pos == tokens[i].end {
+			names = append(names, tokens[i+1].text)
+		}
+	}
+	return names
+}
+
+// bindNamedPlaceholders 将 :name 替换为 ?，返回按占位符顺序排列的参数
+func bindNamedPlaceholders(query string, values map[string]json.RawMessage) (string, []json.RawMessage) {
+	var sb strings.Builder
+	var args []json.RawMessage
+	tokens := tokenizeSQL(query)
+	last := 0
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i].text == ":" && tokens[i+1].kind == tokWord && tokens[i+1].pos == tokens[i].end {
+			sb.WriteString(query[last:tokens[i].pos])
+			sb.WriteByte('?')
+			last = tokens[i+1].end
+			args = append(args, values[tokens[i+1].text])
+			i++
+		}
+	}
+	sb.WriteString(query[last:])
+	return sb.String(), args
+}
+
+// findSavedQuery 按名称查找查询，名称重复时报错
+func findSavedQuery(name string) (*savedQuery, error) {
+	queries, _, err := loadSavedQueries(savedQueryDir())
+	if err != nil {
+		return nil, err
+	}
+	var found []*savedQuery
+	for _, q := range queries {
+		if q.Name == name {
+			found = append(found, q)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("查询库中没有名为 %s 的查询，可用 list_saved_queries 查看", name)
+	case 1:
+		return found[0], nil
+	}
+	files := make([]string, len(found))
+	for i, q := range found {
+		files[i] = q.File
+	}
+	return nil, fmt.Errorf("查询名 %s 重复定义: %s", name, strings.Join(files, ", "))
+}
+
+// resolveSavedParams 校验调用参数并补齐默认值，返回每个参数的带类型 JSON
+func resolveSavedParams(q *savedQuery, values map[string]interface{}) (map[string]json.RawMessage, error) {
+	declared := map[string]bool{}
+	for _, p := range q.Params {
+		declared[p.Name] = true
+	}
+	for name := range values {
+		if !declared[name] {
+			return nil, fmt.Errorf("查询 %s 没有参数 %s", q.Name, name)
+		}
+	}
+
+	resolved := map[string]json.RawMessage{}
+	for _, p := range q.Params {
+		value, ok := values[p.Name]
+		if !ok || value == nil {
+			if p.Required {
+				return nil, fmt.Errorf("缺少必需参数 %s", p.Name)
+			}
+			value = p.Default
+		}
+		if value != nil && len(p.Enum) > 0 && !enumContains(p.Enum, value) {
+			return nil, fmt.Errorf("参数 %s 的值 %v 不在可选范围 %v 内", p.Name, value, p.Enum)
+		}
+
+		// 先按声明的类型校验，避免执行时才报错
+		typed, err := json.Marshal(map[string]interface{}{"type": p.Type, "value": value})
+		if err != nil {
+			return nil, fmt.Errorf("参数 %s: %v", p.Name, err)
+		}
+		if value == nil {
+			typed = json.RawMessage("null")
+		} else if _, err := bindArg(typed); err != nil {
+			return nil, fmt.Errorf("参数 %s: %v", p.Name, err)
+		}
+		resolved[p.Name] = typed
+	}
+	return resolved, nil
+}
+
+func enumContains(enum []interface{}, value interface{}) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// listSavedQueries 列出查询库中的查询及参数说明
+func listSavedQueries(request map[string]interface{}) (*mcp.CallToolResult, error) {
+	keyword, _ := request["keyword"].(string)
+
+	dir := savedQueryDir()
+	queries, errs, err := loadSavedQueries(dir)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	matched := []*savedQuery{}
+	for _, q := range queries {
+		if keyword == "" ||
+			strings.Contains(strings.ToLower(q.Name), strings.ToLower(keyword)) ||
+			strings.Contains(strings.ToLower(q.Description), strings.ToLower(keyword)) {
+			matched = append(matched, q)
+		}
+	}
+
+	out := map[string]interface{}{
+		"directory": dir,
+		"queries":   matched,
+		"count":     len(matched),
+	}
+	if len(errs) > 0 {
+		out["errors"] = errs
+	}
+	jsonData, _ := json.MarshalIndent(out, "", "  ")
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+// runSavedQuery 按名称执行查询库中的查询，结果格式和分页与 execute_query 相同
+func runSavedQuery(request map[string]interface{}) (*mcp.CallToolResult, error) {
+	name, ok := request["name"].(string)
+	if !ok || name == "" {
+		return mcp.NewToolResultError("name 参数是必需的"), nil
+	}
+
+	var values map[string]interface{}
+	switch v := request["params"].(type) {
+	case nil:
+	case map[string]interface{}:
+		values = v
+	case string:
+		if strings.TrimSpace(v) != "" {
+			if err := json.Unmarshal([]byte(v), &values); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("params 必须是 JSON 对象: %v", err)), nil
+			}
+		}
+	default:
+		return mcp.NewToolResultError("params 必须是对象"), nil
+	}
+
+	q, err := findSavedQuery(name)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	resolved, err := resolveSavedParams(q, values)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	query, args := bindNamedPlaceholders(q.SQL, resolved)
+	if n := countPlaceholders(query); n != len(args) {
+		return mcp.NewToolResultError(fmt.Sprintf("查询 %s 中有 %d 个 ? 占位符，请改用 :name 形式的命名参数", q.Name, n-len(args))), nil
+	}
+
+	limit := 100
+	if l, ok := request["limit"].(float64); ok && l >= 1 {
+		limit = int(l)
+	}
+
+	state := newPageState(query, limit)
+	state.Args = args
+	state.Format, _ = request["format"].(string)
+	state.BinaryEncoding, _ = request["binary_encoding"].(string)
+	state.tool = "run_saved_query"
+	state.call = callOf(request)
+	state.SessionID, _ = request["session_id"].(string)
+	// 调用方未指定 route 时使用查询定义的 connection
+	state.Route, _ = request["route"].(string)
+	if state.Route == "" {
+		state.Route = q.Connection
+	}
+
+	return runQueryPage(state)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeSavedQuery(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseSavedQueryFrontMatter(t *testing.T) {
+	dir := t.TempDir()
+
+	// 写在注释中的 front-matter，文件本身是合法 SQL
+	q, err := parseSavedQueryFile(writeSavedQuery(t, dir, "orders.sql", `
+-- ---
+-- name: recent_orders
+-- description: 某客户最近的订单
+-- params:
+--   - name: customer_id
+--     type: int
+--     required: true
+--   - name: since
+--     type: date
+--     default: 2024-01-01
+--   - name: status
+--     enum: [paid, shipped]
+-- ---
+SELECT id, total FROM orders
+WHERE customer_id = :customer_id AND created_at >= :since AND status = :status;
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Name != "recent_orders" || q.Description != "某客户最近的订单" {
+		t.Errorf("name = %q, description = %q", q.Name, q.Description)
+	}
+	if want := "SELECT id, total FROM orders\nWHERE customer_id = :customer_id AND created_at >= :since AND status = :status"; q.SQL != want {
+		t.Errorf("SQL = %q, want %q", q.SQL, want)
+	}
+	if len(q.Params) != 3 || !q.Params[0].Required || q.Params[1].Default != "2024-01-01" || q.Params[2].Type != "string" {
+		t.Errorf("params = %+v", q.Params)
+	}
+
+	// 直接用 --- 包围，未写 name 时取文件名
+	q, err = parseSavedQueryFile(writeSavedQuery(t, dir, "top_users.sql", "---\ndescription: 活跃用户\nconnection: replica\n---\r\nSELECT * FROM users LIMIT 10\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Name != "top_users" || q.SQL != "SELECT * FROM users LIMIT 10" || q.Connection != routeReplica {
+		t.Errorf("name = %q, SQL = %q, connection = %q", q.Name, q.SQL, q.Connection)
+	}
+}
+
+func TestParseSavedQueryErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct{ content, want string }{
+		{"SELECT 1", "缺少 front-matter"},
+		{"-- ---\n-- name: x\nSELECT 1", "没有结束标记"},
+		{"---\nname: [x\n---\nSELECT 1", "front-matter 解析失败"},
+		{"---\nname: x\n---\n", "查询语句为空"},
+		{"---\nname: x\n---\nDELETE FROM t", "只允许执行 SELECT"},
+		{"---\nparams:\n  - type: int\n---\nSELECT 1", "params[0] 缺少 name"},
+		{"---\nparams:\n  - name: a\n  - name: a\n---\nSELECT :a", "参数 a 重复定义"},
+		{"---\nparams:\n  - name: a\n---\nSELECT :a, :b", "语句中的 :b 没有在 params 中声明"},
+		{"---\nconnection: reporting\n---\nSELECT 1", "connection 只能是"},
+	}
+	for _, tt := range tests {
+		_, err := parseSavedQueryFile(writeSavedQuery(t, dir, "q.sql", tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: err = %v, want %q", tt.content, err, tt.want)
+		}
+	}
+}
+
+func TestResolveSavedParams(t *testing.T) {
+	q := &savedQuery{Name: "q", Params: []savedParam{
+		{Name: "id", Type: "int", Required: true},
+		{Name: "status", Type: "string", Default: "paid", Enum: []interface{}{"paid", "shipped"}},
+	}}
+
+	resolved, err := resolveSavedParams(q, map[string]interface{}{"id": float64(42)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, args := bindNamedPlaceholders("SELECT * FROM o WHERE id = :id AND status = :status AND ':id' <> ''", resolved)
+	if query != "SELECT * FROM o WHERE id = ? AND status = ? AND ':id' <> ''" {
+		t.Errorf("query = %q", query)
+	}
+	want := []json.RawMessage{json.RawMessage(`{"type":"int","value":42}`), json.RawMessage(`{"type":"string","value":"paid"}`)}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %s, want %s", args, want)
+	}
+
+	for _, tt := range []struct {
+		values map[string]interface{}
+		want   string
+	}{
+		{map[string]interface{}{}, "缺少必需参数 id"},
+		{map[string]interface{}{"id": float64(1), "other": 1}, "没有参数 other"},
+		{map[string]interface{}{"id": float64(1), "status": "refunded"}, "不在可选范围"},
+		{map[string]interface{}{"id": "abc"}, "参数 id"},
+	} {
+		if _, err := resolveSavedParams(q, tt.values); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%v: err = %v, want %q", tt.values, err, tt.want)
+		}
+	}
+}
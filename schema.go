@@ -0,0 +1,528 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// tableColumn DESCRIBE 返回的字段信息
+type tableColumn struct {
+	Field   string         `json:"field"`
+	Type    string         `json:"type"`
+	Null    string         `json:"null"`
+	Key     string         `json:"key"`
+	Default sql.NullString `json:"default"`
+	Extra   string         `json:"extra"`
+}
+
+// quoteIdent 用反引号包裹标识符，名称中的反引号加倍转义
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// fetchTables 返回数据库中的所有表名，不含按可见性规则隐藏的表
+func fetchTables(pool *sql.DB, database string) ([]string, error) {
+	rows, err := pool.Query("SHOW TABLES FROM " + quoteIdent(database))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var tableName string
+		if err := rows.Scan(&tableName); err != nil {
+			return nil, err
+		}
+		tables = append(tables, tableName)
+	}
+	return filterTables(database, tables), rows.Err()
+}
+
+// fetchColumns 返回 DESCRIBE 的字段信息
+func fetchColumns(q queryer, database, table string) ([]tableColumn, error) {
+	rows, err := q.QueryContext(context.Background(), "DESCRIBE "+quoteIdent(database)+"."+quoteIdent(table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []tableColumn
+	for rows.Next() {
+		var col tableColumn
+		if err := rows.Scan(&col.Field, &col.Type, &col.Null, &col.Key, &col.Default, &col.Extra); err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+// currentDatabase 返回连接当前使用的数据库，未选择数据库时报错
+func currentDatabase(q queryer) (string, error) {
+	var current *string
+	if err := q.QueryRowContext(context.Background(), "SELECT DATABASE()").Scan(&current); err != nil {
+		return "", err
+	}
+	if current == nil {
+		return "", fmt.Errorf("未选择数据库")
+	}
+	return *current, nil
+}
+
+// fetchIndexRows 返回 SHOW INDEX 的原始行，列名保持 MySQL 的返回
+func fetchIndexRows(q queryer, database, table string) ([]map[string]interface{}, error) {
+	rows, err := q.QueryContext(context.Background(), "SHOW INDEX FROM "+quoteIdent(database)+"."+quoteIdent(table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var indexes []map[string]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		valuePtrs := make([]interface{}, len(columns))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]interface{})
+		for i, col := range columns {
+			val := values[i]
+			if b, ok := val.([]byte); ok {
+				row[col] = string(b)
+			} else {
+				row[col] = val
+			}
+		}
+		indexes = append(indexes, row)
+	}
+	return indexes, rows.Err()
+}
+
+// schemaSnapshot 数据库结构快照，序列化为 JSON 文件
+type schemaSnapshot struct {
+	Database   string                    `json:"database"`
+	CapturedAt string                    `json:"captured_at"`
+	Tables     map[string]*tableSnapshot `json:"tables"`
+}
+
+type tableSnapshot struct {
+	Columns []snapshotColumn `json:"columns"`
+	Indexes []snapshotIndex  `json:"indexes"`
+}
+
+type snapshotColumn struct {
+	Name    string  `json:"name"`
+	Type    string  `json:"type"`
+	Null    bool    `json:"null"`
+	Key     string  `json:"key,omitempty"`
+	Default *string `json:"default"`
+	Extra   string  `json:"extra,omitempty"`
+}
+
+type snapshotIndex struct {
+	Name    string   `json:"name"`
+	Unique  bool     `json:"unique"`
+	Type    string   `json:"type,omitempty"`
+	Columns []string `json:"columns"`
+}
+
+// captureSchema 读取数据库当前结构
+func captureSchema(pool *sql.DB, database string) (*schemaSnapshot, error) {
+	if database == "" {
+		return nil, fmt.Errorf("未指定数据库")
+	}
+	if err := checkDatabaseAccess(database); err != nil {
+		return nil, err
+	}
+	tables, err := fetchTables(pool, database)
+	if err != nil {
+		return nil, fmt.Errorf("读取表列表失败: %v", err)
+	}
+
+	snap := &schemaSnapshot{
+		Database:   database,
+		CapturedAt: time.Now().Format(time.RFC3339),
+		Tables:     make(map[string]*tableSnapshot, len(tables)),
+	}
+
+	for _, table := range tables {
+		columns, err := fetchColumns(pool, database, table)
+		if err != nil {
+			return nil, fmt.Errorf("读取表 %s 的字段失败: %v", table, err)
+		}
+		indexRows, err := fetchIndexRows(pool, database, table)
+		if err != nil {
+			return nil, fmt.Errorf("读取表 %s 的索引失败: %v", table, err)
+		}
+
+		ts := &tableSnapshot{Indexes: groupIndexes(indexRows)}
+		for _, c := range columns {
+			col := snapshotColumn{
+				Name:  c.Field,
+				Type:  c.Type,
+				Null:  c.Null == "YES",
+				Key:   c.Key,
+				Extra: c.Extra,
+			}
+			if c.Default.Valid {
+				def := c.Default.String
+				col.Default = &def
+			}
+			ts.Columns = append(ts.Columns, col)
+		}
+		snap.Tables[table] = ts
+	}
+	return snap, nil
+}
+
+// groupIndexes 将 SHOW INDEX 的逐列记录合并为索引
+func groupIndexes(rows []map[string]interface{}) []snapshotIndex {
+	type part struct {
+		seq    int
+		column string
+	}
+	byName := map[string]*snapshotIndex{}
+	parts := map[string][]part{}
+	var names []string
+
+	for _, row := range rows {
+		name := fmt.Sprint(row["Key_name"])
+		idx, ok := byName[name]
+		if !ok {
+			idx = &snapshotIndex{
+				Name:   name,
+				Unique: fmt.Sprint(row["Non_unique"]) == "0",
+				Type:   fmt.Sprint(row["Index_type"]),
+			}
+			byName[name] = idx
+			names = append(names, name)
+		}
+
+		seq, _ := strconv.Atoi(fmt.Sprint(row["Seq_in_index"]))
+		column := fmt.Sprint(row["Column_name"])
+		if row["Column_name"] == nil {
+			column = fmt.Sprintf("(%v)", row["Expression"]) // 函数索引
+		}
+		if sub := row["Sub_part"]; sub != nil {
+			column = fmt.Sprintf("%s(%v)", column, sub)
+		}
+		parts[name] = append(parts[name], part{seq: seq, column: column})
+	}
+
+	sort.Strings(names)
+	indexes := make([]snapshotIndex, 0, len(names))
+	for _, name := range names {
+		ps := parts[name]
+		sort.Slice(ps, func(i, j int) bool { return ps[i].seq < ps[j].seq })
+		idx := byName[name]
+		for _, p := range ps {
+			idx.Columns = append(idx.Columns, p.column)
+		}
+		indexes = append(indexes, *idx)
+	}
+	return indexes
+}
+
+// schemaSnapshotDir 快照文件所在目录
+func schemaSnapshotDir() string {
+	return getEnv("SCHEMA_SNAPSHOT_DIR", "schema_snapshots")
+}
+
+// schemaChangelog 保存结构快照，或将当前结构与快照对比生成变更日志
+func schemaChangelog(request map[string]interface{}) (*mcp.CallToolResult, error) {
+	action, _ := request["action"].(string)
+	database, _ := request["database"].(string)
+	snapshotFile, _ := request["snapshot_file"].(string)
+	format, _ := request["format"].(string)
+	pool, err := readDB(request, true)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	switch action {
+	case "snapshot":
+		if database == "" {
+			return mcp.NewToolResultError("database 参数是必需的"), nil
+		}
+		if snapshotFile == "" {
+			snapshotFile = fmt.Sprintf("%s-%s.json", database, time.Now().Format("20060102-150405"))
+		}
+		path, err := resolveUnderDir(schemaSnapshotDir(), snapshotFile)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		snap, err := captureSchema(pool, database)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		data, _ := json.MarshalIndent(snap, "", "  ")
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("创建目录失败: %v", err)), nil
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("写入快照失败: %v", err)), nil
+		}
+
+		result, _ := json.MarshalIndent(map[string]interface{}{
+			"message":     "结构快照已保存",
+			"database":    database,
+			"path":        path,
+			"snapshot":    snapshotFile,
+			"table_count": len(snap.Tables),
+			"captured_at": snap.CapturedAt,
+		}, "", "  ")
+		return mcp.NewToolResultText(string(result)), nil
+
+	case "diff":
+		if snapshotFile == "" {
+			return mcp.NewToolResultError("snapshot_file 参数是必需的"), nil
+		}
+		path, err := resolveUnderDir(schemaSnapshotDir(), snapshotFile)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("读取快照失败: %v", err)), nil
+		}
+		var base schemaSnapshot
+		if err := json.Unmarshal(data, &base); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("解析快照失败: %v", err)), nil
+		}
+
+		// 不指定 database 时与快照所属数据库的当前结构对比
+		if database == "" {
+			database = base.Database
+		}
+		if database == "" {
+			return mcp.NewToolResultError("快照中没有记录数据库，请指定 database 参数"), nil
+		}
+		current, err := captureSchema(pool, database)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		doc := buildSchemaChangelog(&base, current, snapshotFile)
+		content, err := renderDocument(doc, format)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return mcp.NewToolResultText(content), nil
+
+	default:
+		return mcp.NewToolResultError("action 参数必须是 snapshot 或 diff"), nil
+	}
+}
+
+// buildSchemaChangelog 对比两个快照，生成适合放入发布说明的变更日志
+func buildSchemaChangelog(base, current *schemaSnapshot, snapshotFile string) *document {
+	doc := &document{
+		title: fmt.Sprintf("数据库结构变更：%s", current.Database),
+		meta: []docMeta{
+			{label: "基线快照", value: fmt.Sprintf("%s（%s，%s）", snapshotFile, base.Database, base.CapturedAt)},
+			{label: "对比对象", value: fmt.Sprintf("%s（%s）", current.Database, current.CapturedAt)},
+		},
+	}
+
+	var added, dropped, common []string
+	for name := range current.Tables {
+		if _, ok := base.Tables[name]; ok {
+			common = append(common, name)
+		} else {
+			added = append(added, name)
+		}
+	}
+	for name := range base.Tables {
+		if _, ok := current.Tables[name]; !ok {
+			dropped = append(dropped, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(dropped)
+	sort.Strings(common)
+
+	changed := false
+
+	if len(added) > 0 {
+		changed = true
+		items := make([]string, len(added))
+		for i, name := range added {
+			t := current.Tables[name]
+			items[i] = fmt.Sprintf("`%s`（%d 个字段，%d 个索引）", name, len(t.Columns), len(t.Indexes))
+		}
+		doc.addSection(2, "新增表").list(items...)
+	}
+	if len(dropped) > 0 {
+		changed = true
+		items := make([]string, len(dropped))
+		for i, name := range dropped {
+			items[i] = fmt.Sprintf("`%s`", name)
+		}
+		doc.addSection(2, "删除表").list(items...)
+	}
+
+	for _, name := range common {
+		if diffTable(doc, name, base.Tables[name], current.Tables[name]) {
+			changed = true
+		}
+	}
+
+	if !changed {
+		doc.addSection(2, "变更内容").paragraph("无结构变更")
+	}
+	return doc
+}
+
+// diffTable 输出单表的字段与索引变更，没有变更时返回 false
+func diffTable(doc *document, name string, base, current *tableSnapshot) bool {
+	baseCols := map[string]snapshotColumn{}
+	for _, c := range base.Columns {
+		baseCols[c.Name] = c
+	}
+	curCols := map[string]snapshotColumn{}
+	for _, c := range current.Columns {
+		curCols[c.Name] = c
+	}
+
+	var addedCols, droppedCols []string
+	var colChanges [][]string
+	for _, c := range current.Columns {
+		old, ok := baseCols[c.Name]
+		if !ok {
+			addedCols = append(addedCols, fmt.Sprintf("`%s` %s", c.Name, describeSnapshotColumn(c)))
+			continue
+		}
+		if old.Type != c.Type {
+			colChanges = append(colChanges, []string{c.Name, "类型", old.Type, c.Type})
+		}
+		if old.Null != c.Null {
+			colChanges = append(colChanges, []string{c.Name, "允许 NULL", yesNo(old.Null), yesNo(c.Null)})
+		}
+		if defaultString(old.Default) != defaultString(c.Default) {
+			colChanges = append(colChanges, []string{c.Name, "默认值", defaultString(old.Default), defaultString(c.Default)})
+		}
+		if old.Extra != c.Extra {
+			colChanges = append(colChanges, []string{c.Name, "附加属性", emptyDash(old.Extra), emptyDash(c.Extra)})
+		}
+	}
+	for _, c := range base.Columns {
+		if _, ok := curCols[c.Name]; !ok {
+			droppedCols = append(droppedCols, fmt.Sprintf("`%s` %s", c.Name, c.Type))
+		}
+	}
+
+	baseIdx := map[string]snapshotIndex{}
+	for _, idx := range base.Indexes {
+		baseIdx[idx.Name] = idx
+	}
+	curIdx := map[string]snapshotIndex{}
+	for _, idx := range current.Indexes {
+		curIdx[idx.Name] = idx
+	}
+
+	var addedIdx, droppedIdx, changedIdx []string
+	for _, idx := range current.Indexes {
+		old, ok := baseIdx[idx.Name]
+		if !ok {
+			addedIdx = append(addedIdx, describeSnapshotIndex(idx))
+		} else if describeSnapshotIndex(old) != describeSnapshotIndex(idx) {
+			changedIdx = append(changedIdx, fmt.Sprintf("%s → %s", describeSnapshotIndex(old), describeSnapshotIndex(idx)))
+		}
+	}
+	for _, idx := range base.Indexes {
+		if _, ok := curIdx[idx.Name]; !ok {
+			droppedIdx = append(droppedIdx, describeSnapshotIndex(idx))
+		}
+	}
+
+	if len(addedCols)+len(droppedCols)+len(colChanges)+len(addedIdx)+len(droppedIdx)+len(changedIdx) == 0 {
+		return false
+	}
+
+	doc.addSection(2, fmt.Sprintf("表 `%s` 变更", name))
+	if len(addedCols) > 0 {
+		doc.addSection(3, "新增字段").list(addedCols...)
+	}
+	if len(droppedCols) > 0 {
+		doc.addSection(3, "删除字段").list(droppedCols...)
+	}
+	if len(colChanges) > 0 {
+		doc.addSection(3, "字段变更").table([]string{"字段", "变更项", "原值", "新值"}, colChanges)
+	}
+	if len(addedIdx) > 0 {
+		doc.addSection(3, "新增索引").list(addedIdx...)
+	}
+	if len(droppedIdx) > 0 {
+		doc.addSection(3, "删除索引").list(droppedIdx...)
+	}
+	if len(changedIdx) > 0 {
+		doc.addSection(3, "索引变更").list(changedIdx...)
+	}
+	return true
+}
+
+func describeSnapshotColumn(c snapshotColumn) string {
+	parts := []string{c.Type}
+	if c.Null {
+		parts = append(parts, "NULL")
+	} else {
+		parts = append(parts, "NOT NULL")
+	}
+	if c.Default != nil {
+		parts = append(parts, "默认 "+defaultString(c.Default))
+	}
+	if c.Extra != "" {
+		parts = append(parts, c.Extra)
+	}
+	return strings.Join(parts, " ")
+}
+
+func describeSnapshotIndex(idx snapshotIndex) string {
+	kind := "INDEX"
+	switch {
+	case idx.Name == "PRIMARY":
+		kind = "PRIMARY KEY"
+	case idx.Unique:
+		kind = "UNIQUE"
+	case idx.Type == "FULLTEXT" || idx.Type == "SPATIAL":
+		kind = idx.Type
+	}
+	return fmt.Sprintf("`%s` %s (%s)", idx.Name, kind, strings.Join(idx.Columns, ", "))
+}
+
+func defaultString(def *string) string {
+	if def == nil {
+		return "NULL"
+	}
+	return "'" + *def + "'"
+}
+
+func emptyDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuoteIdent(t *testing.T) {
+	for in, want := range map[string]string{
+		"users":       "`users`",
+		"order items": "`order items`",
+		"a`b":         "`a``b`",
+	} {
+		if got := quoteIdent(in); got != want {
+			t.Errorf("quoteIdent(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+// SHOW INDEX 的逐列记录按 Seq_in_index 合并，前缀索引和函数索引保留写法
+func TestGroupIndexes(t *testing.T) {
+	rows := []map[string]interface{}{
+		{"Key_name": "idx_name", "Non_unique": int64(1), "Index_type": "BTREE", "Seq_in_index": int64(2), "Column_name": "last_name", "Sub_part": int64(10)},
+		{"Key_name": "PRIMARY", "Non_unique": int64(0), "Index_type": "BTREE", "Seq_in_index": int64(1), "Column_name": "id"},
+		{"Key_name": "idx_name", "Non_unique": int64(1), "Index_type": "BTREE", "Seq_in_index": int64(1), "Column_name": "first_name"},
+		{"Key_name": "idx_lower", "Non_unique": int64(0), "Index_type": "BTREE", "Seq_in_index": int64(1), "Column_name": nil, "Expression": "lower(`email`)"},
+	}
+	want := []snapshotIndex{
+		{Name: "PRIMARY", Unique: true, Type: "BTREE", Columns: []string{"id"}},
+		{Name: "idx_lower", Unique: true, Type: "BTREE", Columns: []string{"(lower(`email`))"}},
+		{Name: "idx_name", Unique: false, Type: "BTREE", Columns: []string{"first_name", "last_name(10)"}},
+	}
+	if got := groupIndexes(rows); !reflect.DeepEqual(got, want) {
+		t.Errorf("groupIndexes = %+v, want %+v", got, want)
+	}
+}
+
+func TestBuildSchemaChangelog(t *testing.T) {
+	def := "0"
+	base := &schemaSnapshot{Database: "shop", Tables: map[string]*tableSnapshot{
+		"orders": {
+			Columns: []snapshotColumn{{Name: "id", Type: "int"}, {Name: "status", Type: "varchar(10)", Null: true}, {Name: "legacy", Type: "text", Null: true}},
+			Indexes: []snapshotIndex{{Name: "PRIMARY", Unique: true, Columns: []string{"id"}}, {Name: "idx_status", Columns: []string{"status"}}},
+		},
+		"old_log":  {Columns: []snapshotColumn{{Name: "id", Type: "int"}}},
+		"settings": {Columns: []snapshotColumn{{Name: "k", Type: "varchar(20)"}}},
+	}}
+	current := &schemaSnapshot{Database: "shop", Tables: map[string]*tableSnapshot{
+		"orders": {
+			Columns: []snapshotColumn{{Name: "id", Type: "bigint"}, {Name: "status", Type: "varchar(10)", Default: &def}, {Name: "paid_at", Type: "datetime", Null: true}},
+			Indexes: []snapshotIndex{{Name: "PRIMARY", Unique: true, Columns: []string{"id"}}, {Name: "idx_status", Columns: []string{"status", "paid_at"}}},
+		},
+		"coupons":  {Columns: []snapshotColumn{{Name: "id", Type: "int"}}, Indexes: []snapshotIndex{{Name: "PRIMARY", Unique: true, Columns: []string{"id"}}}},
+		"settings": {Columns: []snapshotColumn{{Name: "k", Type: "varchar(20)"}}},
+	}}
+
+	doc := buildSchemaChangelog(base, current, "shop.json")
+	var titles []string
+	blocks := map[string]docBlock{}
+	for _, sec := range doc.sections {
+		titles = append(titles, sec.title)
+		if len(sec.blocks) > 0 {
+			blocks[sec.title] = sec.blocks[0]
+		}
+	}
+	wantTitles := []string{"新增表", "删除表", "表 `orders` 变更", "新增字段", "删除字段", "字段变更", "索引变更"}
+	if !reflect.DeepEqual(titles, wantTitles) {
+		t.Fatalf("sections = %q, want %q", titles, wantTitles)
+	}
+	if got := blocks["新增表"].items; !reflect.DeepEqual(got, []string{"`coupons`（1 个字段，1 个索引）"}) {
+		t.Errorf("added tables = %q", got)
+	}
+	if got := blocks["删除表"].items; !reflect.DeepEqual(got, []string{"`old_log`"}) {
+		t.Errorf("dropped tables = %q", got)
+	}
+	if got := blocks["新增字段"].items; !reflect.DeepEqual(got, []string{"`paid_at` datetime NULL"}) {
+		t.Errorf("added columns = %q", got)
+	}
+	if got := blocks["删除字段"].items; !reflect.DeepEqual(got, []string{"`legacy` text"}) {
+		t.Errorf("dropped columns = %q", got)
+	}
+	wantChanges := [][]string{
+		{"id", "类型", "int", "bigint"},
+		{"status", "允许 NULL", "是", "否"},
+		{"status", "默认值", "NULL", "'0'"},
+	}
+	if got := blocks["字段变更"].rows; !reflect.DeepEqual(got, wantChanges) {
+		t.Errorf("column changes = %q, want %q", got, wantChanges)
+	}
+	if got := blocks["索引变更"].items; !reflect.DeepEqual(got, []string{"`idx_status` INDEX (status) → `idx_status` INDEX (status, paid_at)"}) {
+		t.Errorf("index changes = %q", got)
+	}
+
+	// 结构相同时只输出“无结构变更”
+	doc = buildSchemaChangelog(current, current, "shop.json")
+	if len(doc.sections) != 1 || doc.sections[0].blocks[0].text != "无结构变更" {
+		t.Errorf("unchanged schema sections = %+v", doc.sections)
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// passwordCommandTimeout MYSQL_PASSWORD_COMMAND 的执行时间上限
+const passwordCommandTimeout = 30 * time.Second
+
+// minSecretLength 按 DSN 形式推测出的密码短于此长度时不做替换，避免误伤。配置中的密钥无论长短都会替换
+const minSecretLength = 6
+
+// passwordRefreshInterval 认证失败后重新读取密码的最小间隔，密码错误时不会每次连接都执行命令
+const passwordRefreshInterval = 10 * time.Second
+
+// dsnCredentials 文本中 user:password@tcp(...) 形式的 DSN 凭据
+var dsnCredentials = regexp.MustCompile(`([\w.%+-]+):([^@\s/:]+)@(tcp|unix|ssh(?:\+unix)?)\(`)
+
+// passwordSources 三种显式指定密码的方式，只能设置其中一个
+var passwordSources = []string{"MYSQL_PASSWORD", "MYSQL_PASSWORD_FILE", "MYSQL_PASSWORD_COMMAND"}
+
+var resolvedPassword struct {
+	sync.Mutex
+	key         string
+	value       string
+	refreshedAt time.Time
+}
+
+// mysqlPassword 按 MYSQL_PASSWORD / MYSQL_PASSWORD_FILE / MYSQL_PASSWORD_COMMAND 解析密码，
+// 都未设置时使用选项文件中的 password，再没有时为 root。结果按来源缓存，认证失败后由 refreshPassword 清除
+func mysqlPassword() (string, error) {
+	var source, spec string
+	for _, key := range passwordSources {
+		if value := getEnv(key, ""); value != "" {
+			if source != "" {
+				return "", fmt.Errorf("%s 和 %s 只能设置一个", source, key)
+			}
+			source, spec = key, value
+		}
+	}
+
+	resolvedPassword.Lock()
+	defer resolvedPassword.Unlock()
+	key := source + "\x00" + spec
+	if source != "" && resolvedPassword.key == key {
+		return resolvedPassword.value, nil
+	}
+
+	var password string
+	switch source {
+	case "MYSQL_PASSWORD":
+		password = spec
+	case "MYSQL_PASSWORD_FILE":
+		data, err := os.ReadFile(expandHome(spec))
+		if err != nil {
+			return "", fmt.Errorf("读取 MYSQL_PASSWORD_FILE 失败: %v", err)
+		}
+		if password = strings.TrimRight(string(data), "\r\n"); password == "" {
+			return "", fmt.Errorf("MYSQL_PASSWORD_FILE %s 为空", spec)
+		}
+	case "MYSQL_PASSWORD_COMMAND":
+		var err error
+		if password, err = runPasswordCommand(spec); err != nil {
+			return "", err
+		}
+	default:
+		options, err := clientOptions()
+		if err != nil {
+			return "", err
+		}
+		var ok bool
+		if password, ok = options["password"]; !ok {
+			// 默认值不是配置的密钥，不做替换
+			return "root", nil
+		}
+	}
+
+	registerSecret(password)
+	resolvedPassword.key, resolvedPassword.value = key, password
+	return password, nil
+}
+
+// refreshPassword 认证失败后清除缓存的密码，下次连接时重新读取 MYSQL_PASSWORD_FILE 或执行 MYSQL_PASSWORD_COMMAND。
+// 密码直接写在配置中、来自选项文件，或距上次刷新不足 passwordRefreshInterval 时返回 false
+func refreshPassword() bool {
+	resolvedPassword.Lock()
+	defer resolvedPassword.Unlock()
+	source, _, _ := strings.Cut(resolvedPassword.key, "\x00")
+	if source != "MYSQL_PASSWORD_FILE" && source != "MYSQL_PASSWORD_COMMAND" {
+		return false
+	}
+	if time.Since(resolvedPassword.refreshedAt) < passwordRefreshInterval {
+		return false
+	}
+	resolvedPassword.key, resolvedPassword.refreshedAt = "", time.Now()
+	return true
+}
+
+// runPasswordCommand 通过 shell 执行命令，使用标准输出的第一行作为密码。
+// 出错时只报告退出状态和标准错误，不包含标准输出
+func runPasswordCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), passwordCommandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("超过 %s 未完成", passwordCommandTimeout)
+		}
+		detail := strings.TrimSpace(stderr.String())
+		if len(detail) > 200 {
+			detail = detail[:200] + "..."
+		}
+		if detail != "" {
+			return "", fmt.Errorf("MYSQL_PASSWORD_COMMAND 执行失败: %v: %s", err, detail)
+		}
+		return "", fmt.Errorf("MYSQL_PASSWORD_COMMAND 执行失败: %v", err)
+	}
+	password, _, _ := strings.Cut(stdout.String(), "\n")
+	if password = strings.TrimRight(password, "\r"); password == "" {
+		return "", fmt.Errorf("MYSQL_PASSWORD_COMMAND 没有输出密码")
+	}
+	return password, nil
+}
+
+var optionCache struct {
+	once    sync.Once
+	options map[string]string
+	err     error
+}
+
+// clientOptions 与 mysql 客户端一样读取选项文件中的连接设置（user / password / host / port / socket / database）：
+// 先读 MYSQL_OPTION_FILE（默认 ~/.my.cnf）的 [client] 和 [mysql] 组，
+// 再读 mysql_config_editor 生成的 ~/.mylogin.cnf 的 [client] 和 MYSQL_LOGIN_PATH 指定的组，后读的覆盖先读的
+func clientOptions() (map[string]string, error) {
+	optionCache.once.Do(func() {
+		optionCache.options, optionCache.err = readClientOptions()
+	})
+	return optionCache.options, optionCache.err
+}
+
+func readClientOptions() (map[string]string, error) {
+	home, _ := os.UserHomeDir()
+	options := map[string]string{}
+
+	optionFile := getEnv("MYSQL_OPTION_FILE", "")
+	switch {
+	case strings.EqualFold(optionFile, "off"):
+	case optionFile != "":
+		data, err := os.ReadFile(expandHome(optionFile))
+		if err != nil {
+			return nil, fmt.Errorf("读取 MYSQL_OPTION_FILE 失败: %v", err)
+		}
+		parseOptionFile(data, options, "client", "mysql")
+	default:
+		if data, err := os.ReadFile(filepath.Join(home, ".my.cnf")); err == nil {
+			parseOptionFile(data, options, "client", "mysql")
+		}
+	}
+
+	loginFile := os.Getenv("MYSQL_TEST_LOGIN_FILE")
+	if loginFile == "" {
+		loginFile = filepath.Join(home, ".mylogin.cnf")
+	}
+	loginPath := getEnv("MYSQL_LOGIN_PATH", "")
+	data, err := os.ReadFile(loginFile)
+	if err != nil {
+		if loginPath != "" {
+			return nil, fmt.Errorf("MYSQL_LOGIN_PATH=%s 需要 %s: %v", loginPath, loginFile, err)
+		}
+		return options, nil
+	}
+	plain, err := decryptLoginFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %v", loginFile, err)
+	}
+	groups := []string{"client"}
+	if loginPath != "" {
+		if !optionGroupExists(plain, loginPath) {
+			return nil, fmt.Errorf("%s 中没有 login-path %s", loginFile, loginPath)
+		}
+		groups = append(groups, loginPath)
+	}
+	parseOptionFile(plain, options, groups...)
+	return options, nil
+}
+
+// parseOptionFile 解析 my.cnf 格式的选项文件，只取指定组中的连接选项，选项名中的 _ 视为 -
+func parseOptionFile(data []byte, options map[string]string, groups ...string) {
+	wanted := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' || line[0] == '!' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			group := strings.TrimSpace(line[1 : len(line)-1])
+			wanted = false
+			for _, g := range groups {
+				if strings.EqualFold(group, g) {
+					wanted = true
+				}
+			}
+			continue
+		}
+		if !wanted {
+			continue
+		}
+		name, value, _ := strings.Cut(line, "=")
+		name = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "_", "-")
+		switch name {
+		case "user", "password", "host", "port", "socket", "database":
+			options[name] = optionValue(strings.TrimSpace(value))
+		}
+	}
+}
+
+// optionValue 去掉引号并处理转义，未加引号时 # 之后为注释
+func optionValue(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		replacer := strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\\`, `\`, `\"`, `"`, `\'`, `'`)
+		return replacer.Replace(value[1 : len(value)-1])
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
+
+func optionGroupExists(data []byte, group string) bool {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") && strings.EqualFold(strings.TrimSpace(line[1:len(line)-1]), group) {
+			return true
+		}
+	}
+	return false
+}
+
+// decryptLoginFile 解密 mysql_config_editor 的登录文件：4 字节保留，20 字节密钥，
+// 之后每段为 4 字节小端长度加 AES-128-ECB 密文
+func decryptLoginFile(data []byte) ([]byte, error) {
+	if len(data) < 24 {
+		return nil, fmt.Errorf("文件过短")
+	}
+	var key [16]byte
+	for i, b := range data[4:24] {
+		key[i%16] ^= b
+	}
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	var plain bytes.Buffer
+	for pos := 24; pos < len(data); {
+		if pos+4 > len(data) {
+			return nil, fmt.Errorf("格式无效")
+		}
+		n := int(binary.LittleEndian.Uint32(data[pos:]))
+		pos += 4
+		if n == 0 || n%aes.BlockSize != 0 || pos+n > len(data) {
+			return nil, fmt.Errorf("格式无效")
+		}
+		chunk := make([]byte, n)
+		for i := 0; i < n; i += aes.BlockSize {
+			block.Decrypt(chunk[i:i+aes.BlockSize], data[pos+i:pos+i+aes.BlockSize])
+		}
+		pos += n
+		if pad := int(chunk[n-1]); pad > 0 && pad <= aes.BlockSize {
+			chunk = chunk[:n-pad]
+		}
+		plain.Write(chunk)
+	}
+	return plain.Bytes(), nil
+}
+
+// optionDefault 选项文件中的值，没有时为 defaultValue
+func optionDefault(name, defaultValue string) string {
+	options, _ := clientOptions()
+	if value, ok := options[name]; ok && value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+var secrets struct {
+	sync.RWMutex
+	values []string
+}
+
+// registerSecret 登记需要从日志和工具输出中隐去的值，同时登记其 JSON 转义形式
+func registerSecret(value string) {
+	if value == "" {
+		return
+	}
+	escaped, _ := json.Marshal(value)
+	secrets.Lock()
+	defer secrets.Unlock()
+	for _, v := range []string{value, string(escaped[1 : len(escaped)-1])} {
+		known := false
+		for _, existing := range secrets.values {
+			known = known || existing == v
+		}
+		if !known {
+			secrets.values = append(secrets.values, v)
+		}
+	}
+}
+
+// registerConfiguredSecrets 登记配置中直接写出的密钥，启动和重新加载配置后调用
+func registerConfiguredSecrets() {
+	for _, key := range []string{"MYSQL_PASSWORD", "SSH_KEY_PASSPHRASE", "MASKING_SECRET"} {
+		registerSecret(getEnv(key, ""))
+	}
+}
+
+// scrubSecrets 把文本中出现的密钥替换为 ******，并隐去 DSN 形式的凭据中未登记的密码
+func scrubSecrets(s string) string {
+	secrets.RLock()
+	for _, v := range secrets.values {
+		if strings.Contains(s, v) {
+			s = strings.ReplaceAll(s, v, "******")
+		}
+	}
+	secrets.RUnlock()
+	return dsnCredentials.ReplaceAllStringFunc(s, func(m string) string {
+		parts := dsnCredentials.FindStringSubmatch(m)
+		if len(parts[2]) < minSecretLength {
+			return m
+		}
+		return parts[1] + ":******@" + parts[3] + "("
+	})
+}
+
+// scrubWriter 写入前隐去密钥，用于日志输出
+type scrubWriter struct {
+	w io.Writer
+}
+
+func (sw scrubWriter) Write(p []byte) (int, error) {
+	if _, err := sw.w.Write([]byte(scrubSecrets(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// scrubHandler 隐去工具输出文本中的密钥
+func scrubHandler(handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(request map[string]interface{}) (*mcp.CallToolResult, error) {
+		result, err := handler(request)
+		if result != nil {
+			for i, content := range result.Content {
+				if text, ok := content.(mcp.TextContent); ok {
+					text.Text = scrubSecrets(text.Text)
+					result.Content[i] = text
+				}
+			}
+		}
+		if err != nil {
+			if scrubbed := scrubSecrets(err.Error()); scrubbed != err.Error() {
+				err = fmt.Errorf("%s", scrubbed)
+			}
+		}
+		return result, err
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// encryptLoginFile 按 mysql_config_editor 的格式加密，每行单独成段
+func encryptLoginFile(t *testing.T, key [20]byte, lines ...string) []byte {
+	t.Helper()
+	var aesKey [16]byte
+	for i, b := range key {
+		aesKey[i%16] ^= b
+	}
+	block, err := aes.NewCipher(aesKey[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append(make([]byte, 4), key[:]...)
+	for _, line := range lines {
+		pad := aes.BlockSize - len(line)%aes.BlockSize
+		plain := []byte(line + strings.Repeat(string(rune(pad)), pad))
+		cipher := make([]byte, len(plain))
+		for i := 0; i < len(plain); i += aes.BlockSize {
+			block.Encrypt(cipher[i:i+aes.BlockSize], plain[i:i+aes.BlockSize])
+		}
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(cipher)))
+		data = append(data, cipher...)
+	}
+	return data
+}
+
+func TestDecryptLoginFile(t *testing.T) {
+	var key [20]byte
+	for i := range key {
+		key[i] = byte(i*7 + 3)
+	}
+	lines := []string{"[prod]\n", "user = \"reader\"\n", "password = \"p@ss word 16 byte\"\n", "host = \"10.0.1.20\"\n"}
+	data := encryptLoginFile(t, key, lines...)
+
+	plain, err := decryptLoginFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(plain), strings.Join(lines, ""); got != want {
+		t.Fatalf("decrypted = %q, want %q", got, want)
+	}
+	options := map[string]string{}
+	parseOptionFile(plain, options, "prod")
+	want := map[string]string{"user": "reader", "password": "p@ss word 16 byte", "host": "10.0.1.20"}
+	if !reflect.DeepEqual(options, want) {
+		t.Errorf("options = %v, want %v", options, want)
+	}
+
+	for name, bad := range map[string][]byte{
+		"too short":        data[:20],
+		"truncated length": data[:26],
+		"truncated chunk":  data[:len(data)-1],
+		"unaligned chunk":  append(append([]byte{}, data[:24]...), 5, 0, 0, 0, 1, 2, 3, 4, 5),
+		"empty chunk":      append(append([]byte{}, data[:24]...), 0, 0, 0, 0),
+	} {
+		if _, err := decryptLoginFile(bad); err == nil {
+			t.Errorf("%s: decryptLoginFile accepted malformed data", name)
+		}
+	}
+}
+
+func TestParseOptionFile(t *testing.T) {
+	data := []byte(`
+# comment
+[client]
+user = app
+password = "se\"cret"
+port = 3307 # trailing comment
+
+[mysqldump]
+user = dumper
+
+[mysql]
+host = db.internal
+default_character_set = utf8mb4
+`)
+	options := map[string]string{}
+	parseOptionFile(data, options, "client", "mysql")
+	want := map[string]string{"user": "app", "password": `se"cret`, "port": "3307", "host": "db.internal"}
+	if !reflect.DeepEqual(options, want) {
+		t.Errorf("options = %v, want %v", options, want)
+	}
+}
+
+// 密码来自命令时，认证失败后 refreshPassword 让下一次连接重新执行命令
+func TestRefreshPassword(t *testing.T) {
+	saved := secrets.values
+	defer func() { secrets.values = saved }()
+	resolvedPassword.Lock()
+	resolvedPassword.key, resolvedPassword.refreshedAt = "", time.Time{}
+	resolvedPassword.Unlock()
+
+	file := filepath.Join(t.TempDir(), "pw")
+	os.WriteFile(file, []byte("first-password\n"), 0o600)
+	t.Setenv("MYSQL_PASSWORD", "")
+	t.Setenv("MYSQL_PASSWORD_FILE", "")
+	t.Setenv("MYSQL_PASSWORD_COMMAND", "cat "+file)
+
+	if got, err := mysqlPassword(); err != nil || got != "first-password" {
+		t.Fatalf("mysqlPassword() = %q, %v", got, err)
+	}
+	os.WriteFile(file, []byte("rotated-password\n"), 0o600)
+	if got, _ := mysqlPassword(); got != "first-password" {
+		t.Errorf("password re-read without an authentication failure: %q", got)
+	}
+	if !refreshPassword() {
+		t.Fatal("refreshPassword() = false for MYSQL_PASSWORD_COMMAND")
+	}
+	if got, _ := mysqlPassword(); got != "rotated-password" {
+		t.Errorf("after refresh mysqlPassword() = %q, want rotated-password", got)
+	}
+	if refreshPassword() {
+		t.Error("refreshPassword() allowed a second refresh within the interval")
+	}
+
+	t.Setenv("MYSQL_PASSWORD_COMMAND", "")
+	t.Setenv("MYSQL_PASSWORD", "literal")
+	mysqlPassword()
+	resolvedPassword.Lock()
+	resolvedPassword.refreshedAt = time.Time{}
+	resolvedPassword.Unlock()
+	if refreshPassword() {
+		t.Error("refreshPassword() = true for a literal MYSQL_PASSWORD")
+	}
+}
+
+func TestScrubSecrets(t *testing.T) {
+	saved := secrets.values
+	defer func() { secrets.values = saved }()
+	secrets.values = nil
+	registerSecret("pw1")
+	registerSecret(`a"b`)
+
+	tests := []struct{ in, want string }{
+		{"login failed for pw1", "login failed for ******"},
+		{`{"password":"a\"b"}`, `{"password":"******"}`},
+		{"dsn reader:unregistered-secret@tcp(10.0.0.1:3306)/shop", "dsn reader:******@tcp(10.0.0.1:3306)/shop"},
+		{"dsn reader:x@tcp(10.0.0.1:3306)/shop", "dsn reader:x@tcp(10.0.0.1:3306)/shop"},
+		{"socket app:longer-secret@unix(/tmp/mysql.sock)/", "socket app:******@unix(/tmp/mysql.sock)/"},
+		{"nothing to hide", "nothing to hide"},
+	}
+	for _, tt := range tests {
+		if got := scrubSecrets(tt.in); got != tt.want {
+			t.Errorf("scrubSecrets(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
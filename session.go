@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 会话默认值，可通过 SESSION_IDLE_TIMEOUT / SESSION_MAX 调整
+const (
+	defaultSessionIdleTimeout = 5 * time.Minute
+	defaultSessionMax         = 5
+)
+
+// isolationLevels begin_session 支持的隔离级别
+var isolationLevels = []string{"READ UNCOMMITTED", "READ COMMITTED", "REPEATABLE READ", "SERIALIZABLE"}
+
+// queryer *sql.DB、*sql.Tx 和 *sql.Conn 共有的查询方法
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// dbSession 固定在一个连接上的事务会话，多次工具调用共享同一个事务
+type dbSession struct {
+	mu        sync.Mutex // 同一连接不能并发执行语句，使用期间持有
+	id        string
+	conn      *sql.Conn
+	restore   func() // 恢复连接的会话限制
+	readOnly  bool
+	isolation string
+	startedAt time.Time
+	lastUsed  time.Time
+	queries   int
+	closed    bool
+	owner     *mcpConn // 开启会话的客户端连接，自动回滚的通知发给它
+}
+
+var sessions = struct {
+	sync.Mutex
+	items map[string]*dbSession
+	once  sync.Once
+}{items: map[string]*dbSession{}}
+
+func sessionIdleTimeout() time.Duration {
+	return time.Duration(getEnvInt("SESSION_IDLE_TIMEOUT", int(defaultSessionIdleTimeout/time.Second))) * time.Second
+}
+
+// acquireSession 取得会话并加锁，使用完后调用 release
+func acquireSession(id string) (*dbSession, error) {
+	sessions.Lock()
+	sess, ok := sessions.items[id]
+	sessions.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("会话 %s 不存在或已结束（空闲超过 %s 会自动回滚）", id, sessionIdleTimeout())
+	}
+
+	sess.mu.Lock()
+	if sess.closed {
+		sess.mu.Unlock()
+		return nil, fmt.Errorf("会话 %s 已结束", id)
+	}
+	sess.lastUsed = time.Now()
+	sess.queries++
+	return sess, nil
+}
+
+func (s *dbSession) release() {
+	s.lastUsed = time.Now()
+	s.mu.Unlock()
+}
+
+// finish 提交或回滚并归还连接，调用方需持有 s.mu
+func (s *dbSession) finish(statement string) error {
+	_, err := s.conn.ExecContext(context.Background(), statement)
+	s.restore()
+	s.conn.Close()
+	s.closed = true
+
+	sessions.Lock()
+	delete(sessions.items, s.id)
+	sessions.Unlock()
+	return err
+}
+
+func sessionLimitError(maxSessions int) *mcp.CallToolResult {
+	return mcp.NewToolResultError(fmt.Sprintf("会话数已达上限 SESSION_MAX=%d，请先提交或回滚已有会话", maxSessions))
+}
+
+func (s *dbSession) info() map[string]interface{} {
+	mode := "read_write"
+	if s.readOnly {
+		mode = "read_only"
+	}
+	info := map[string]interface{}{
+		"session_id":           s.id,
+		"mode":                 mode,
+		"started_at":           s.startedAt.Format(time.RFC3339),
+		"queries":              s.queries,
+		"idle_timeout_seconds": int(sessionIdleTimeout() / time.Second),
+	}
+	if s.isolation != "" {
+		info["isolation_level"] = s.isolation
+	}
+	return info
+}
+
+// reapIdleSessions 定期回滚空闲超时的会话，避免长事务占用连接和 undo 日志
+func reapIdleSessions() {
+	for {
+		timeout := sessionIdleTimeout()
+		interval := timeout / 4
+		if interval > 30*time.Second {
+			interval = 30 * time.Second
+		}
+		time.Sleep(interval)
+
+		sessions.Lock()
+		var idle []*dbSession
+		for _, s := range sessions.items {
+			idle = append(idle, s)
+		}
+		sessions.Unlock()
+
+		for _, s := range idle {
+			// 正在使用的会话跳过
+			if !s.mu.TryLock() {
+				continue
+			}
+			if !s.closed && time.Since(s.lastUsed) > timeout {
+				s.finish("ROLLBACK")
+				sendLogNotification(&toolCall{conn: s.owner}, mcp.LoggingLevelWarning, "session", map[string]interface{}{
+					"session_id": s.id,
+					"message":    fmt.Sprintf("会话空闲超过 %s，已自动回滚", timeout),
+				})
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// beginSession 开启会话：占用一个连接并开始事务
+func beginSession(request map[string]interface{}) (*mcp.CallToolResult, error) {
+	mode, _ := request["mode"].(string)
+	if mode == "" {
+		mode = "read_only"
+	}
+	if mode != "read_only" && mode != "read_write" {
+		return mcp.NewToolResultError("mode 只能是 read_only 或 read_write"), nil
+	}
+	if mode == "read_write" && !writeEnabled() {
+		return mcp.NewToolResultError("read_write 会话需要开启写入模式（WRITE_ENABLED=true）"), nil
+	}
+
+	isolation, _ := request["isolation_level"].(string)
+	isolation = strings.ToUpper(strings.TrimSpace(strings.ReplaceAll(isolation, "_", " ")))
+	if isolation != "" {
+		valid := false
+		for _, level := range isolationLevels {
+			valid = valid || level == isolation
+		}
+		if !valid {
+			return mcp.NewToolResultError(fmt.Sprintf("不支持的隔离级别: %s（可选 %s）", isolation, strings.Join(isolationLevels, " / "))), nil
+		}
+	}
+
+	// 已满时不必占用连接；开启事务期间可能有其他会话加入，插入时在同一把锁下再检查一次
+	maxSessions := getEnvInt("SESSION_MAX", defaultSessionMax)
+	sessions.Lock()
+	full := len(sessions.items) >= maxSessions
+	sessions.Unlock()
+	if full {
+		return sessionLimitError(maxSessions), nil
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("获取连接失败: %v", err)), nil
+	}
+	// 会话中的语句同样受执行时间和锁等待限制，只读与否由事务本身决定
+	restore, err := applyQueryLimits(ctx, conn, false)
+	if err != nil {
+		conn.Close()
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if isolation != "" {
+		// 只作用于接下来开启的事务
+		if _, err := conn.ExecContext(ctx, "SET TRANSACTION ISOLATION LEVEL "+isolation); err != nil {
+			restore()
+			conn.Close()
+			return mcp.NewToolResultError(fmt.Sprintf("设置隔离级别失败: %v", err)), nil
+		}
+	}
+	start := "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY"
+	if mode == "read_write" {
+		start = "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ WRITE"
+	}
+	if _, err := conn.ExecContext(ctx, start); err != nil {
+		restore()
+		conn.Close()
+		return mcp.NewToolResultError(fmt.Sprintf("开启事务失败: %v", err)), nil
+	}
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	now := time.Now()
+	sess := &dbSession{
+		id:        "s_" + hex.EncodeToString(b),
+		conn:      conn,
+		restore:   restore,
+		readOnly:  mode == "read_only",
+		isolation: isolation,
+		startedAt: now,
+		lastUsed:  now,
+	}
+	if call := callOf(request); call != nil {
+		sess.owner = call.conn
+	}
+	sessions.Lock()
+	if len(sessions.items) >= maxSessions {
+		sessions.Unlock()
+		sess.finish("ROLLBACK")
+		return sessionLimitError(maxSessions), nil
+	}
+	sessions.items[sess.id] = sess
+	sessions.Unlock()
+	sessions.once.Do(func() { go reapIdleSessions() })
+
+	info := sess.info()
+	info["message"] = "会话已开启，在 execute_query 等工具中传入 session_id 即可在同一事务中执行，结束时调用 commit_session 或 rollback_session"
+	jsonData, _ := json.MarshalIndent(info, "", "  ")
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+// commitSession 提交会话中的事务并释放连接
+func commitSession(request map[string]interface{}) (*mcp.CallToolResult, error) {
+	return endSession(request, "COMMIT")
+}
+
+// rollbackSession 回滚会话中的事务并释放连接
+func rollbackSession(request map[string]interface{}) (*mcp.CallToolResult, error) {
+	return endSession(request, "ROLLBACK")
+}
+
+func endSession(request map[string]interface{}, statement string) (*mcp.CallToolResult, error) {
+	id, ok := request["session_id"].(string)
+	if !ok || id == "" {
+		return mcp.NewToolResultError("session_id 参数是必需的"), nil
+	}
+
+	sess, err := acquireSession(id)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	sess.queries--
+	info := sess.info()
+	err = sess.finish(statement)
+	sess.release()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("%s 失败: %v", statement, err)), nil
+	}
+
+	if statement == "COMMIT" {
+		info["committed"] = true
+	} else {
+		info["rolled_back"] = true
+	}
+	info["duration_ms"] = time.Since(sess.startedAt).Milliseconds()
+	jsonData, _ := json.MarshalIndent(info, "", "  ")
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
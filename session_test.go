@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// 开启会话前的参数检查和会话数上限，都在占用连接之前完成
+func TestBeginSessionOptions(t *testing.T) {
+	t.Setenv("WRITE_ENABLED", "false")
+	t.Setenv("SESSION_MAX", "1")
+	sessions.Lock()
+	saved := sessions.items
+	sessions.items = map[string]*dbSession{"s_busy": {id: "s_busy"}}
+	sessions.Unlock()
+	defer func() {
+		sessions.Lock()
+		sessions.items = saved
+		sessions.Unlock()
+	}()
+
+	tests := []struct {
+		request map[string]interface{}
+		want    string
+	}{
+		{map[string]interface{}{"mode": "write"}, "mode 只能是"},
+		{map[string]interface{}{"mode": "read_write"}, "WRITE_ENABLED=true"},
+		{map[string]interface{}{"isolation_level": "snapshot"}, "不支持的隔离级别: SNAPSHOT"},
+		// 隔离级别不区分大小写，下划线等同空格；通过检查后因会话数已满被拒绝
+		{map[string]interface{}{"isolation_level": "repeatable_read"}, "SESSION_MAX=1"},
+		{map[string]interface{}{}, "SESSION_MAX=1"},
+	}
+	for _, tt := range tests {
+		result, _ := beginSession(tt.request)
+		if text := resultText(t, result); !result.IsError || !strings.Contains(text, tt.want) {
+			t.Errorf("beginSession(%v) = %s, want error containing %q", tt.request, text, tt.want)
+		}
+	}
+}
+
+func TestAcquireSession(t *testing.T) {
+	t.Setenv("SESSION_IDLE_TIMEOUT", "300")
+	sess := &dbSession{id: "s_test", readOnly: true, isolation: "READ COMMITTED", startedAt: time.Now()}
+	sessions.Lock()
+	sessions.items[sess.id] = sess
+	sessions.Unlock()
+	defer func() {
+		sessions.Lock()
+		delete(sessions.items, sess.id)
+		sessions.Unlock()
+	}()
+
+	if _, err := acquireSession("s_missing"); err == nil || !strings.Contains(err.Error(), "5m0s") {
+		t.Errorf("missing session: err = %v", err)
+	}
+
+	got, err := acquireSession(sess.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := got.info()
+	got.release()
+	if info["mode"] != "read_only" || info["queries"] != 1 || info["isolation_level"] != "READ COMMITTED" || info["idle_timeout_seconds"] != 300 {
+		t.Errorf("info = %v", info)
+	}
+
+	sess.closed = true
+	if _, err := acquireSession(sess.id); err == nil || !strings.Contains(err.Error(), "已结束") {
+		t.Errorf("closed session: err = %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"strings"
+)
+
+// sqlTokenKind SQL 词法单元类型
+type sqlTokenKind int
+
+const (
+	tokWord   sqlTokenKind = iota // 关键字或未加引号的标识符
+	tokIdent                      // 反引号标识符
+	tokString                     // 字符串字面量
+	tokNumber                     // 数字
+	tokParam                      // ? 占位符
+	tokPunct                      // 运算符和标点
+)
+
+// sqlToken 词法单元，pos/end 为在原始 SQL 中的字节位置，depth 为所在的括号层级
+type sqlToken struct {
+	kind  sqlTokenKind
+	text  string
+	pos   int
+	end   int
+	depth int
+}
+
+// upper 返回关键字的大写形式，仅对 tokWord 有意义
+func (t sqlToken) upper() string {
+	return strings.ToUpper(t.text)
+}
+
+// name 返回标识符的名称（去掉反引号）
+func (t sqlToken) name() string {
+	if t.kind == tokIdent {
+		return strings.ReplaceAll(strings.Trim(t.text, "`"), "``", "`")
+	}
+	return t.text
+}
+
+func (t sqlToken) isWord(words ...string) bool {
+	if t.kind != tokWord {
+		return false
+	}
+	for _, w := range words {
+		if strings.EqualFold(t.text, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenizeSQL 将 SQL 切分为词法单元，跳过注释和空白。
+// 只做满足本工具需要的轻量解析：识别字符串、反引号标识符、注释和括号层级。
+func tokenizeSQL(query string) []sqlToken {
+	var tokens []sqlToken
+	depth := 0
+	i := 0
+	n := len(query)
+
+	for i < n {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+
+		case c == '#' || (c == '-' && i+1 < n && query[i+1] == '-' && (i+2 >= n || isSQLSpace(query[i+2]))):
+			for i < n && query[i] != '\n' {
+				i++
+			}
+
+		case c == '/' && i+1 < n && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = n
+			} else {
+				i += end + 4
+			}
+
+		case c == '\'' || c == '"':
+			start := i
+			i = skipQuoted(query, i, c)
+			tokens = append(tokens, sqlToken{kind: tokString, text: query[start:i], pos: start, end: i, depth: depth})
+
+		case c == '`':
+			start := i
+			i = skipQuoted(query, i, '`')
+			tokens = append(tokens, sqlToken{kind: tokIdent, text: query[start:i], pos: start, end: i, depth: depth})
+
+		case isSQLDigit(c) || (c == '.' && i+1 < n && isSQLDigit(query[i+1])):
+			start := i
+			for i < n && (isSQLWordChar(query[i]) || query[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: tokNumber, text: query[start:i], pos: start, end: i, depth: depth})
+
+		case isSQLWordChar(c) || c >= 0x80:
+			start := i
+			for i < n && (isSQLWordChar(query[i]) || query[i] >= 0x80) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: tokWord, text: query[start:i], pos: start, end: i, depth: depth})
+
+		case c == '?':
+			tokens = append(tokens, sqlToken{kind: tokParam, text: "?", pos: i, end: i + 1, depth: depth})
+			i++
+
+		case c == '(':
+			tokens = append(tokens, sqlToken{kind: tokPunct, text: "(", pos: i, end: i + 1, depth: depth})
+			depth++
+			i++
+
+		case c == ')':
+			if depth > 0 {
+				depth--
+			}
+			tokens = append(tokens, sqlToken{kind: tokPunct, text: ")", pos: i, end: i + 1, depth: depth})
+			i++
+
+		default:
+			start := i
+			i++
+			// 合并常见的双字符运算符
+			if i < n && strings.Contains("<>=!|&:", string(c)) && strings.Contains("<>=|&", string(query[i])) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: tokPunct, text: query[start:i], pos: start, end: i, depth: depth})
+		}
+	}
+	return tokens
+}
+
+func skipQuoted(query string, i int, quote byte) int {
+	n := len(query)
+	i++
+	for i < n {
+		switch query[i] {
+		case '\\':
+			if quote != '`' {
+				i += 2
+				continue
+			}
+		case quote:
+			// 连续两个引号表示转义
+			if i+1 < n && query[i+1] == quote {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return n
+}
+
+func isSQLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isSQLDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSQLWordChar(c byte) bool {
+	return c == '_' || c == '$' || isSQLDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// findTopLevel 返回第一个位于顶层（不在括号中）且匹配任一关键字的位置，未找到返回 -1
+func findTopLevel(tokens []sqlToken, from int, words ...string) int {
+	for i := from; i < len(tokens); i++ {
+		if tokens[i].depth == 0 && tokens[i].isWord(words...) {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasTopLevelLimit 判断语句顶层是否已有 LIMIT 子句（忽略字符串、标识符和子查询中的 LIMIT）
+func hasTopLevelLimit(tokens []sqlToken) bool {
+	return findTopLevel(tokens, 0, "LIMIT") >= 0
+}
+
+// firstKeyword 返回语句的第一个关键字（大写），用于判断语句类型
+func firstKeyword(tokens []sqlToken) string {
+	for _, t := range tokens {
+		if t.kind == tokWord {
+			return t.upper()
+		}
+		if t.text != "(" {
+			return ""
+		}
+	}
+	return ""
+}
+
+// trimStatement 去掉语句末尾的分号和空白
+func trimStatement(query string) string {
+	return strings.TrimRight(strings.TrimSpace(query), "; \t\r\n")
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// isTOMLConfig 按扩展名判断配置文件格式，.toml 以外的都按 YAML 解析
+func isTOMLConfig(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".toml")
+}
+
+// parseTOMLConfig 解析 TOML 配置并转换为与 YAML 相同的节点树，校验逻辑和行号提示两种格式共用
+func parseTOMLConfig(data []byte) (*yaml.Node, error) {
+	var raw map[string]interface{}
+	if _, err := toml.Decode(string(data), &raw); err != nil {
+		var perr toml.ParseError
+		if errors.As(err, &perr) {
+			return nil, fmt.Errorf("第 %d 行：%s", perr.Position.Line, perr.Message)
+		}
+		return nil, err
+	}
+	return tomlNode(raw, "", 1, tomlKeyLines(data)), nil
+}
+
+// tomlNode 把解码后的值转为 yaml.Node，行号取自 tomlKeyLines；内联表等找不到行号时沿用上层的行号
+func tomlNode(value interface{}, path string, line int, lines map[string]int) *yaml.Node {
+	if n, ok := lines[path]; ok {
+		line = n
+	}
+	node := &yaml.Node{Kind: yaml.ScalarNode, Line: line}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		node.Kind, node.Tag = yaml.MappingNode, "!!map"
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		child := func(k string) string { return strings.TrimPrefix(path+"."+k, ".") }
+		sort.Slice(keys, func(i, j int) bool {
+			li, oki := lines[child(keys[i])]
+			lj, okj := lines[child(keys[j])]
+			if oki && okj && li != lj {
+				return li < lj
+			}
+			return keys[i] < keys[j]
+		})
+		for _, k := range keys {
+			value := tomlNode(v[k], child(k), line, lines)
+			key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k, Line: value.Line}
+			node.Content = append(node.Content, key, value)
+		}
+	case []map[string]interface{}:
+		node.Kind, node.Tag = yaml.SequenceNode, "!!seq"
+		for _, item := range v {
+			node.Content = append(node.Content, tomlNode(item, path, line, lines))
+		}
+	case []interface{}:
+		node.Kind, node.Tag = yaml.SequenceNode, "!!seq"
+		for _, item := range v {
+			node.Content = append(node.Content, tomlNode(item, path, line, lines))
+		}
+	case string:
+		node.Tag, node.Value = "!!str", v
+	case int64:
+		node.Tag, node.Value = "!!int", strconv.FormatInt(v, 10)
+	case float64:
+		node.Tag, node.Value = "!!float", strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		node.Tag, node.Value = "!!bool", strconv.FormatBool(v)
+	case time.Time:
+		node.Tag, node.Value = "!!timestamp", v.Format(time.RFC3339Nano)
+	default:
+		node.Tag, node.Value = "!!str", fmt.Sprint(v)
+	}
+	return node
+}
+
+// tomlKeyLines 记录每个表头和键（完整路径，如 mysql.pool.max_open_conns）首次出现的行号
+func tomlKeyLines(data []byte) map[string]int {
+	lines := map[string]int{}
+	record := func(path string, line int) {
+		if _, ok := lines[path]; !ok {
+			lines[path] = line
+		}
+	}
+	unquote := func(key string) string {
+		parts := strings.Split(key, ".")
+		for i, p := range parts {
+			parts[i] = strings.Trim(strings.TrimSpace(p), `"'`)
+		}
+		return strings.Join(parts, ".")
+	}
+
+	table := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#':
+		case strings.HasPrefix(line, "["):
+			header := strings.Trim(strings.SplitN(line, "#", 2)[0], "[] \t")
+			table = unquote(header)
+			record(table, n)
+		default:
+			key, _, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			path := unquote(key)
+			if table != "" {
+				path = table + "." + path
+			}
+			record(path, n)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"runtime/debug"
+	"sync"
+	"syscall"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// toolServer 在 MCPServer 之外记录工具处理函数。tools/call 由传输层直接调用处理函数，
+// 调用期间参数映射与调用上下文的对应关系记在 calls 中；其他消息仍交给 MCPServer
+type toolServer struct {
+	*server.MCPServer
+	handlers map[string]server.ToolHandlerFunc
+}
+
+func newToolServer(name, version string, opts ...server.ServerOption) *toolServer {
+	return &toolServer{MCPServer: server.NewMCPServer(name, version, opts...), handlers: map[string]server.ToolHandlerFunc{}}
+}
+
+func (s *toolServer) AddTool(tool mcp.Tool, handler server.ToolHandlerFunc) {
+	s.MCPServer.AddTool(tool, handler)
+	s.handlers[tool.Name] = handler
+}
+
+// mcpConn 一个客户端连接。响应和通知经同一个加锁的输出写回，不会交错
+type mcpConn struct {
+	mu     sync.Mutex
+	write  func(msg []byte) error // 写出一条完整的消息
+	closed bool
+	client string // initialize 中报告的客户端名称和版本
+}
+
+func (c *mcpConn) send(msg []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	if err := c.write(msg); err != nil {
+		c.closed = true
+	}
+}
+
+func (c *mcpConn) close() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+}
+
+func (c *mcpConn) clientName() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.client
+}
+
+// conns 当前的客户端连接，日志通知发给所有连接
+var conns struct {
+	sync.Mutex
+	set map[*mcpConn]bool
+}
+
+func addConn(c *mcpConn) {
+	conns.Lock()
+	defer conns.Unlock()
+	if conns.set == nil {
+		conns.set = map[*mcpConn]bool{}
+	}
+	conns.set[c] = true
+}
+
+func removeConn(c *mcpConn) {
+	conns.Lock()
+	delete(conns.set, c)
+	conns.Unlock()
+	c.close()
+}
+
+func broadcast(msg []byte) {
+	conns.Lock()
+	targets := make([]*mcpConn, 0, len(conns.set))
+	for c := range conns.set {
+		targets = append(targets, c)
+	}
+	conns.Unlock()
+	for _, c := range targets {
+		c.send(msg)
+	}
+}
+
+// toolCall 一次工具调用的上下文：发起调用的连接、客户端请求进度通知时给出的 progressToken，
+// 以及审计中间件为这次调用创建的记录
+type toolCall struct {
+	conn          *mcpConn
+	progressToken json.RawMessage
+	audit         *auditEntry
+}
+
+// calls 正在执行的工具调用，以参数映射的地址为键。中间件和处理函数之间传递的是同一个映射，
+// 调用结束前映射不会被回收，地址不会被复用
+var calls struct {
+	sync.Mutex
+	items map[uintptr]*toolCall
+}
+
+func registerCall(args map[string]interface{}, call *toolCall) uintptr {
+	key := reflect.ValueOf(args).Pointer()
+	calls.Lock()
+	defer calls.Unlock()
+	if calls.items == nil {
+		calls.items = map[uintptr]*toolCall{}
+	}
+	calls.items[key] = call
+	return key
+}
+
+func unregisterCall(key uintptr) {
+	calls.Lock()
+	delete(calls.items, key)
+	calls.Unlock()
+}
+
+// callOf 返回参数所属的工具调用，不是经传输层发起的调用（如内部调用）时返回 nil
+func callOf(request map[string]interface{}) *toolCall {
+	if request == nil {
+		return nil
+	}
+	key := reflect.ValueOf(request).Pointer()
+	calls.Lock()
+	defer calls.Unlock()
+	return calls.items[key]
+}
+
+// clientOf 返回调用方在 initialize 中报告的客户端名称
+func clientOf(call *toolCall) string {
+	if call == nil || call.conn == nil {
+		return ""
+	}
+	return call.conn.clientName()
+}
+
+// dispatch 处理一条消息并写回响应：记录 initialize 中的客户端信息，tools/call 直接调用处理函数。
+// 处理函数 panic 时返回内部错误，不影响其他调用
+func dispatch(s *toolServer, conn *mcpConn, raw []byte) {
+	var msg map[string]json.RawMessage
+	json.Unmarshal(raw, &msg)
+	var method string
+	json.Unmarshal(msg["method"], &method)
+	if method == "initialize" {
+		var params struct {
+			ClientInfo struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"clientInfo"`
+		}
+		if json.Unmarshal(msg["params"], &params) == nil {
+			name := params.ClientInfo.Name
+			if v := params.ClientInfo.Version; v != "" {
+				name += "/" + v
+			}
+			conn.mu.Lock()
+			conn.client = name
+			conn.mu.Unlock()
+		}
+	}
+
+	if resp := handleMessage(s, conn, raw, method, msg); resp != nil {
+		data, err := json.Marshal(resp)
+		if err != nil {
+			log.Printf("failed to encode response: %v", err)
+			return
+		}
+		conn.send(data)
+	}
+}
+
+// handleMessage 处理一条消息，把 panic 转为 JSON-RPC 内部错误
+func handleMessage(s *toolServer, conn *mcpConn, raw []byte, method string, msg map[string]json.RawMessage) (resp interface{}) {
+	var id interface{}
+	json.Unmarshal(msg["id"], &id)
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("panic while handling request %s: %v\n%s", msg["id"], r, debug.Stack())
+			var errResp mcp.JSONRPCError
+			errResp.JSONRPC = mcp.JSONRPC_VERSION
+			errResp.ID = id
+			errResp.Error.Code = mcp.INTERNAL_ERROR
+			errResp.Error.Message = fmt.Sprintf("内部错误: %v", r)
+			resp = errResp
+		}
+	}()
+
+	if method == "tools/call" {
+		var params struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+			Meta      struct {
+				ProgressToken json.RawMessage `json:"progressToken"`
+			} `json:"_meta"`
+		}
+		if json.Unmarshal(msg["params"], &params) == nil {
+			if handler, ok := s.handlers[params.Name]; ok {
+				return callTool(handler, conn, id, params.Arguments, params.Meta.ProgressToken)
+			}
+		}
+		// 参数无效或工具不存在时由 MCPServer 返回标准错误
+	}
+	if msg := s.HandleMessage(context.Background(), raw); msg != nil {
+		return msg
+	}
+	return nil
+}
+
+// callTool 执行一次工具调用，调用期间可通过 callOf(args) 取得连接、progressToken 和审计记录
+func callTool(handler server.ToolHandlerFunc, conn *mcpConn, id interface{}, args map[string]interface{}, progressToken json.RawMessage) interface{} {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	call := &toolCall{conn: conn}
+	if len(progressToken) > 0 && string(progressToken) != "null" {
+		call.progressToken = progressToken
+	}
+	key := registerCall(args, call)
+	defer unregisterCall(key)
+
+	result, err := handler(args)
+	if err != nil {
+		var errResp mcp.JSONRPCError
+		errResp.JSONRPC = mcp.JSONRPC_VERSION
+		errResp.ID = id
+		errResp.Error.Code = mcp.INTERNAL_ERROR
+		errResp.Error.Message = err.Error()
+		return errResp
+	}
+	return mcp.JSONRPCResponse{JSONRPC: mcp.JSONRPC_VERSION, ID: id, Result: result}
+}
+
+// serveStdio 从标准输入逐行读取消息，每条消息在单独的 goroutine 中处理，
+// 客户端可以同时发起多个工具调用，响应按完成顺序写回
+func serveStdio(s *toolServer) error {
+	conn := &mcpConn{write: func(msg []byte) error {
+		_, err := os.Stdout.Write(append(msg, '\n'))
+		return err
+	}}
+	addConn(conn)
+	defer removeConn(conn)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(os.Stdin)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				lines <- line
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case line := <-lines:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				dispatch(s, conn, line)
+			}()
+		case err := <-readErr:
+			// 输入结束后等正在执行的调用写回响应
+			wg.Wait()
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
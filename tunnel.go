@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSH 隧道默认值，可通过 SSH_KEEPALIVE_INTERVAL / SSH_CONNECT_TIMEOUT（秒）调整
+const (
+	defaultSSHKeepaliveInterval = 30
+	defaultSSHConnectTimeout    = 10
+)
+
+// 经 SSH 隧道连接时注册给驱动的网络名，DSN 中写作 user:pass@ssh(host:port)/db
+const (
+	sshNetTCP  = "ssh"
+	sshNetUnix = "ssh+unix"
+)
+
+// sshTunnel 到跳板机的 SSH 连接，断开后在下次拨号或保活检查时自动重连
+type sshTunnel struct {
+	addr   string
+	config *ssh.ClientConfig
+
+	mu          sync.Mutex
+	client      *ssh.Client
+	connectedAt time.Time
+	lastError   string
+	reconnects  int
+	dials       int64
+}
+
+// tunnel 未配置 SSH_HOST 时为 nil
+var tunnel *sshTunnel
+
+// openTunnel 按 SSH_HOST 等配置建立 SSH 隧道并注册驱动的拨号函数，只在配置无效时返回错误
+func openTunnel() error {
+	host := getEnv("SSH_HOST", "")
+	if host == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, getEnv("SSH_PORT", "22"))
+	}
+	config, err := sshClientConfig()
+	if err != nil {
+		return err
+	}
+
+	// 跳板机暂时连不上时不影响启动，之后在拨号或保活检查时重试
+	t := &sshTunnel{addr: host, config: config}
+	if _, err := t.connect(); err != nil {
+		log.Printf("%v, will retry", err)
+	}
+	tunnel = t
+	mysql.RegisterDialContext(sshNetTCP, func(ctx context.Context, addr string) (net.Conn, error) {
+		return t.dial(ctx, "tcp", addr)
+	})
+	mysql.RegisterDialContext(sshNetUnix, func(ctx context.Context, addr string) (net.Conn, error) {
+		return t.dial(ctx, "unix", addr)
+	})
+	go t.keepalive()
+	return nil
+}
+
+// tunnelNetwork 配置了隧道时把 tcp / unix 换成经隧道拨号的网络名
+func tunnelNetwork(network string) string {
+	if tunnel == nil {
+		return network
+	}
+	if network == "unix" {
+		return sshNetUnix
+	}
+	return sshNetTCP
+}
+
+// sshClientConfig 认证方式：SSH_AUTH_SOCK 中的 ssh-agent 和 SSH_KEY_FILE 私钥（未设置时尝试 ~/.ssh 下的默认私钥）；
+// 主机密钥按 SSH_KNOWN_HOSTS（默认 ~/.ssh/known_hosts）校验
+func sshClientConfig() (*ssh.ClientConfig, error) {
+	home, _ := os.UserHomeDir()
+	sshUser := getEnv("SSH_USER", "")
+	if sshUser == "" {
+		if u, err := user.Current(); err == nil {
+			sshUser = u.Username
+		}
+	}
+
+	var auth []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		} else {
+			log.Printf("ssh-agent unavailable: %v", err)
+		}
+	}
+	keyFiles := []string{expandHome(getEnv("SSH_KEY_FILE", ""))}
+	if keyFiles[0] == "" {
+		keyFiles = nil
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			if path := filepath.Join(home, ".ssh", name); fileExists(path) {
+				keyFiles = append(keyFiles, path)
+			}
+		}
+	}
+	var signers []ssh.Signer
+	for _, path := range keyFiles {
+		signer, err := loadSSHKey(path)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("SSH 隧道没有可用的认证方式，请设置 SSH_KEY_FILE 或启动 ssh-agent")
+	}
+
+	knownHosts := getEnv("SSH_KNOWN_HOSTS", filepath.Join(home, ".ssh", "known_hosts"))
+	var knownHostsFiles []string
+	for _, path := range strings.Split(knownHosts, ",") {
+		knownHostsFiles = append(knownHostsFiles, expandHome(strings.TrimSpace(path)))
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFiles...)
+	if err != nil {
+		return nil, fmt.Errorf("读取 known_hosts 失败: %v", err)
+	}
+
+	return &ssh.ClientConfig{
+		User:            sshUser,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         time.Duration(getEnvInt("SSH_CONNECT_TIMEOUT", defaultSSHConnectTimeout)) * time.Second,
+	}, nil
+}
+
+// loadSSHKey 读取私钥，有口令时使用 SSH_KEY_PASSPHRASE
+func loadSSHKey(path string) (ssh.Signer, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 SSH 私钥失败: %v", err)
+	}
+	signer, err := ssh.ParsePrivateKey(pem)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		passphrase := getEnv("SSH_KEY_PASSPHRASE", "")
+		if passphrase == "" {
+			return nil, fmt.Errorf("SSH 私钥 %s 有口令，请设置 SSH_KEY_PASSPHRASE", path)
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析 SSH 私钥 %s 失败: %v", path, err)
+	}
+	return signer, nil
+}
+
+// expandHome 展开路径开头的 ~，MCP 配置中的环境变量不经过 shell
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// connect 返回当前的 SSH 连接，未连接时重新建立
+func (t *sshTunnel) connect() (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	client, err := ssh.Dial("tcp", t.addr, t.config)
+	if err != nil {
+		t.lastError = err.Error()
+		return nil, fmt.Errorf("SSH 连接 %s 失败: %v", t.addr, err)
+	}
+	if !t.connectedAt.IsZero() {
+		t.reconnects++
+		log.Printf("ssh tunnel to %s reconnected", t.addr)
+	}
+	t.client, t.connectedAt, t.lastError = client, time.Now(), ""
+
+	// 连接断开后清除，下次拨号时重连
+	go func() {
+		err := client.Wait()
+		t.drop(client, fmt.Sprintf("连接断开: %v", err))
+	}()
+	return client, nil
+}
+
+// drop 丢弃已失效的连接，client 已被替换时不做处理
+func (t *sshTunnel) drop(client *ssh.Client, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != client {
+		return
+	}
+	log.Printf("ssh tunnel to %s lost: %s", t.addr, reason)
+	t.client, t.lastError = nil, reason
+	client.Close()
+}
+
+// dial 经隧道连接 MySQL。通道打开失败但 SSH 连接本身已失效时，重连后再试一次
+func (t *sshTunnel) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	for attempt := 0; ; attempt++ {
+		client, err := t.connect()
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dialContext(ctx, client, network, addr)
+		if err == nil {
+			t.mu.Lock()
+			t.dials++
+			t.mu.Unlock()
+			return conn, nil
+		}
+		if _, rejected := err.(*ssh.OpenChannelError); rejected || attempt > 0 || ctx.Err() != nil {
+			return nil, fmt.Errorf("经 SSH 隧道连接 %s 失败: %v", addr, err)
+		}
+		t.drop(client, err.Error())
+	}
+}
+
+// dialContext ssh.Client.Dial 不支持 context，超时后关闭迟到的连接
+func dialContext(ctx context.Context, client *ssh.Client, network, addr string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := client.Dial(network, addr)
+		done <- result{conn, err}
+	}()
+	select {
+	case r := <-done:
+		return r.conn, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// keepalive 定期发送保活请求，检测静默断开的连接并主动重连
+func (t *sshTunnel) keepalive() {
+	for {
+		time.Sleep(time.Duration(getEnvInt("SSH_KEEPALIVE_INTERVAL", defaultSSHKeepaliveInterval)) * time.Second)
+		t.mu.Lock()
+		client := t.client
+		t.mu.Unlock()
+		if client == nil {
+			t.connect()
+			continue
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.drop(client, fmt.Sprintf("保活失败: %v", err))
+				t.connect()
+			}
+		case <-time.After(t.config.Timeout):
+			t.drop(client, "保活超时")
+			t.connect()
+		}
+	}
+}
+
+// status 隧道当前状态
+func (t *sshTunnel) status() map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status := map[string]interface{}{
+		"bastion":    t.addr,
+		"user":       t.config.User,
+		"connected":  t.client != nil,
+		"reconnects": t.reconnects,
+		"dials":      t.dials,
+	}
+	if t.client != nil {
+		status["connected_since"] = t.connectedAt.Format(time.RFC3339)
+	}
+	if t.lastError != "" {
+		status["last_error"] = t.lastError
+	}
+	return status
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// writeSSHKey 生成 ed25519 私钥写入 dir，passphrase 不为空时加密
+func writeSSHKey(t *testing.T, dir, name, passphrase string) string {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(key, "")
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTunnelNetwork(t *testing.T) {
+	saved := tunnel
+	defer func() { tunnel = saved }()
+
+	tunnel = nil
+	if got := tunnelNetwork("tcp"); got != "tcp" {
+		t.Errorf("without tunnel: tcp -> %s", got)
+	}
+	tunnel = &sshTunnel{}
+	if got := tunnelNetwork("tcp"); got != sshNetTCP {
+		t.Errorf("with tunnel: tcp -> %s", got)
+	}
+	if got := tunnelNetwork("unix"); got != sshNetUnix {
+		t.Errorf("with tunnel: unix -> %s", got)
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for in, want := range map[string]string{
+		"~":               home,
+		"~/.ssh/id_rsa":   filepath.Join(home, ".ssh/id_rsa"),
+		"~other/.ssh":     "~other/.ssh",
+		"/etc/ssh/key":    "/etc/ssh/key",
+		"relative/id_rsa": "relative/id_rsa",
+	} {
+		if got := expandHome(in); got != want {
+			t.Errorf("expandHome(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestLoadSSHKey(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SSH_KEY_PASSPHRASE", "")
+	if _, err := loadSSHKey(writeSSHKey(t, dir, "plain", "")); err != nil {
+		t.Errorf("plain key: %v", err)
+	}
+
+	encrypted := writeSSHKey(t, dir, "encrypted", "s3cret")
+	if _, err := loadSSHKey(encrypted); err == nil || !strings.Contains(err.Error(), "SSH_KEY_PASSPHRASE") {
+		t.Errorf("encrypted key without passphrase: err = %v", err)
+	}
+	t.Setenv("SSH_KEY_PASSPHRASE", "wrong")
+	if _, err := loadSSHKey(encrypted); err == nil || !strings.Contains(err.Error(), "解析 SSH 私钥") {
+		t.Errorf("encrypted key with wrong passphrase: err = %v", err)
+	}
+	t.Setenv("SSH_KEY_PASSPHRASE", "s3cret")
+	if _, err := loadSSHKey(encrypted); err != nil {
+		t.Errorf("encrypted key: %v", err)
+	}
+	if _, err := loadSSHKey(filepath.Join(dir, "missing")); err == nil || !strings.Contains(err.Error(), "读取 SSH 私钥失败") {
+		t.Errorf("missing key: err = %v", err)
+	}
+}
+
+// 未设置 SSH_KEY_FILE 时使用 ~/.ssh 下的默认私钥，known_hosts 支持逗号分隔的多个文件和 ~
+func TestSSHClientConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	t.Setenv("SSH_KEY_FILE", "")
+	t.Setenv("SSH_KEY_PASSPHRASE", "")
+	t.Setenv("SSH_USER", "deploy")
+	t.Setenv("SSH_CONNECT_TIMEOUT", "3")
+	sshDir := filepath.Join(home, ".ssh")
+	if err := os.MkdirAll(sshDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SSH_KNOWN_HOSTS", "~/.ssh/known_hosts, ~/.ssh/extra_hosts")
+
+	if _, err := sshClientConfig(); err == nil || !strings.Contains(err.Error(), "没有可用的认证方式") {
+		t.Errorf("no keys: err = %v", err)
+	}
+
+	writeSSHKey(t, sshDir, "id_ed25519", "")
+	if _, err := sshClientConfig(); err == nil || !strings.Contains(err.Error(), "known_hosts") {
+		t.Errorf("missing known_hosts: err = %v", err)
+	}
+
+	for _, name := range []string{"known_hosts", "extra_hosts"} {
+		if err := os.WriteFile(filepath.Join(sshDir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config, err := sshClientConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.User != "deploy" || len(config.Auth) != 1 || config.Timeout != 3*time.Second {
+		t.Errorf("config = user %q, %d auth methods, timeout %s", config.User, len(config.Auth), config.Timeout)
+	}
+
+	// 显式指定的私钥不可用时报错，而不是退回默认私钥
+	t.Setenv("SSH_KEY_FILE", "~/.ssh/missing")
+	if _, err := sshClientConfig(); err == nil || !strings.Contains(err.Error(), "读取 SSH 私钥失败") {
+		t.Errorf("missing SSH_KEY_FILE: err = %v", err)
+	}
+}
@@ -0,0 +1,744 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 写入模式默认值，可通过 WRITE_CONFIRM_TTL / WRITE_MAX_ROWS / WRITE_SAMPLE_ROWS 调整
+const (
+	defaultWriteConfirmTTL = 5 * time.Minute
+	defaultWriteMaxRows    = 1000
+	defaultWriteSampleRows = 5
+)
+
+// writeStatement 解析后的写语句
+type writeStatement struct {
+	kind       string      // UPDATE / DELETE / INSERT / REPLACE
+	tableRefs  string      // 表引用部分，UPDATE/DELETE 用于生成预览 SELECT
+	tail       string      // WHERE / ORDER BY / LIMIT 部分
+	tables     [][2]string // 涉及的表（schema, table），用于检查存储引擎
+	previewArg []int       // 预览 SELECT 用到的占位符序号
+	source     string      // INSERT … SELECT 的 SELECT 部分，用于预览写入行数
+	sourceRows int64       // INSERT … VALUES / SET 写入的行数，无法预估时为 -1
+	hasWhere   bool
+	hasLimit   bool
+}
+
+// pendingWrite 等待确认的写操作
+type pendingWrite struct {
+	query     string
+	args      string
+	affected  int64
+	trialRan  bool
+	session   string // 在会话中预览的令牌只能在同一会话中使用
+	expiresAt time.Time
+}
+
+var pendingWrites = struct {
+	sync.Mutex
+	items map[string]*pendingWrite
+}{items: map[string]*pendingWrite{}}
+
+// writeEnabled 写入模式需要显式开启
+func writeEnabled() bool {
+	v, _ := strconv.ParseBool(getEnv("WRITE_ENABLED", "false"))
+	return v
+}
+
+func writeConfirmTTL() time.Duration {
+	return time.Duration(getEnvInt("WRITE_CONFIRM_TTL", int(defaultWriteConfirmTTL/time.Second))) * time.Second
+}
+
+// parseWriteStatement 识别 UPDATE / DELETE / INSERT / REPLACE 语句的结构
+func parseWriteStatement(query string) (*writeStatement, error) {
+	tokens := tokenizeSQL(query)
+	for _, t := range tokens {
+		if t.text == ";" {
+			return nil, fmt.Errorf("一次只能执行一条语句")
+		}
+	}
+
+	stmt := &writeStatement{kind: firstKeyword(tokens)}
+	i := 1
+	switch stmt.kind {
+	case "UPDATE":
+		for i < len(tokens) && tokens[i].isWord("LOW_PRIORITY", "IGNORE") {
+			i++
+		}
+		setIdx := findTopLevel(tokens, i, "SET")
+		if setIdx < 0 {
+			return nil, fmt.Errorf("UPDATE 语句缺少 SET")
+		}
+		stmt.setRefs(query, tokens, i, setIdx)
+		stmt.setTail(query, tokens, setIdx)
+
+	case "DELETE":
+		for i < len(tokens) && tokens[i].isWord("LOW_PRIORITY", "QUICK", "IGNORE") {
+			i++
+		}
+		fromIdx := findTopLevel(tokens, i, "FROM")
+		if fromIdx < 0 {
+			return nil, fmt.Errorf("DELETE 语句缺少 FROM")
+		}
+		refsStart := fromIdx + 1
+		// DELETE FROM t1 USING t1 JOIN t2 ... 的形式
+		if usingIdx := findTopLevel(tokens, fromIdx, "USING"); usingIdx >= 0 {
+			refsStart = usingIdx + 1
+		}
+		end := stmt.setTail(query, tokens, refsStart)
+		stmt.setRefs(query, tokens, refsStart, end)
+
+	case "INSERT", "REPLACE":
+		for i < len(tokens) && tokens[i].isWord("LOW_PRIORITY", "DELAYED", "HIGH_PRIORITY", "IGNORE", "INTO") {
+			i++
+		}
+		end := i + 1
+		if end+1 < len(tokens) && tokens[end].text == "." {
+			end += 2
+		}
+		if end > len(tokens) {
+			return nil, fmt.Errorf("%s 语句缺少表名", stmt.kind)
+		}
+		stmt.tables = referencedTables(tokens[i:end])
+		stmt.setSource(query, tokens, end)
+
+	default:
+		return nil, fmt.Errorf("execute_write 只支持 UPDATE、DELETE、INSERT 和 REPLACE 语句")
+	}
+
+	if len(stmt.tables) == 0 {
+		return nil, fmt.Errorf("无法识别语句中的表")
+	}
+	return stmt, nil
+}
+
+// setRefs 记录 [from, to) 范围的表引用
+func (s *writeStatement) setRefs(query string, tokens []sqlToken, from, to int) {
+	if from >= to {
+		return
+	}
+	s.tableRefs = query[tokens[from].pos:tokens[to-1].end]
+	s.tables = referencedTables(tokens[from:to])
+	s.previewArg = append(placeholderIndexes(tokens, from, to), s.previewArg...)
+}
+
+// setTail 记录从 from 起第一个顶层 WHERE / ORDER / LIMIT 开始的部分，返回其位置
+func (s *writeStatement) setTail(query string, tokens []sqlToken, from int) int {
+	idx := findTopLevel(tokens, from, "WHERE", "ORDER", "LIMIT")
+	if idx < 0 {
+		return len(tokens)
+	}
+	s.tail = query[tokens[idx].pos:]
+	s.hasWhere = tokens[idx].isWord("WHERE")
+	s.hasLimit = findTopLevel(tokens, idx, "LIMIT") >= 0
+	s.previewArg = append(s.previewArg, placeholderIndexes(tokens, idx, len(tokens))...)
+	return idx
+}
+
+// setSource 记录 INSERT / REPLACE 的数据来源：SELECT 部分用于预览行数，VALUES 按顶层的行计数，SET 形式为 1 行。
+// 其他形式（如 TABLE t）无法预估，sourceRows 为 -1
+func (s *writeStatement) setSource(query string, tokens []sqlToken, from int) {
+	s.sourceRows = -1
+	i := from
+	// 跳过 PARTITION (...) 和字段列表
+	for i < len(tokens) {
+		if tokens[i].isWord("PARTITION") {
+			i++
+			continue
+		}
+		if tokens[i].text != "(" || (i+1 < len(tokens) && tokens[i+1].isWord("SELECT", "WITH")) {
+			break
+		}
+		for i++; i < len(tokens) && (tokens[i].depth > 0 || tokens[i].text != ")"); i++ {
+		}
+		i++
+	}
+	if i >= len(tokens) {
+		return
+	}
+	end := len(tokens)
+	for j := i; j+1 < len(tokens); j++ {
+		if tokens[j].depth == 0 && tokens[j].isWord("ON") && tokens[j+1].isWord("DUPLICATE") {
+			end = j
+			break
+		}
+	}
+
+	switch {
+	case tokens[i].isWord("SELECT", "WITH") || tokens[i].text == "(":
+		if i < end {
+			s.source = query[tokens[i].pos:tokens[end-1].end]
+			s.previewArg = placeholderIndexes(tokens, i, end)
+		}
+	case tokens[i].isWord("VALUES", "VALUE"):
+		// 每行以 ( 或 ROW 开头，紧跟在 VALUES 或逗号之后
+		var rows int64
+		for j := i + 1; j < end; j++ {
+			if tokens[j].depth == 0 && (tokens[j].text == "(" || tokens[j].isWord("ROW")) &&
+				(tokens[j-1].text == "," || tokens[j-1].isWord("VALUES", "VALUE")) {
+				rows++
+			}
+		}
+		s.sourceRows = rows
+	case tokens[i].isWord("SET"):
+		s.sourceRows = 1
+	}
+}
+
+// placeholderIndexes 返回 [from, to) 范围内 ? 占位符在整条语句中的序号
+func placeholderIndexes(tokens []sqlToken, from, to int) []int {
+	var indexes []int
+	n := 0
+	for i, t := range tokens {
+		if t.kind != tokParam {
+			continue
+		}
+		if i >= from && i < to {
+			indexes = append(indexes, n)
+		}
+		n++
+	}
+	return indexes
+}
+
+// referencedTables 从表引用中取出表名：开头以及 JOIN、逗号之后的标识符
+func referencedTables(tokens []sqlToken) [][2]string {
+	var tables [][2]string
+	expect := true
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.depth > tokens[0].depth {
+			continue
+		}
+		switch {
+		case t.isWord("JOIN", "STRAIGHT_JOIN") || t.text == ",":
+			expect = true
+		case t.text == "(":
+			// 派生表不是可写入的表
+			expect = false
+		case expect && isIdentToken(t) && !t.isWord("LEFT", "RIGHT", "INNER", "OUTER", "CROSS", "NATURAL"):
+			if i+2 < len(tokens) && tokens[i+1].text == "." && isIdentToken(tokens[i+2]) {
+				tables = append(tables, [2]string{t.name(), tokens[i+2].name()})
+				i += 2
+			} else {
+				tables = append(tables, [2]string{"", t.name()})
+			}
+			expect = false
+		}
+	}
+	return tables
+}
+
+// transactionalTables 检查涉及的表是否都支持事务回滚，返回不支持的说明
+func transactionalTables(q queryer, tables [][2]string) (bool, string) {
+	for _, t := range tables {
+		var engine sql.NullString
+		err := q.QueryRowContext(context.Background(),
+			"SELECT ENGINE FROM information_schema.TABLES WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ?",
+			t[0], t[1],
+		).Scan(&engine)
+		if err != nil || !engine.Valid {
+			return false, fmt.Sprintf("无法确认表 %s 的存储引擎（可能是视图或不存在）", t[1])
+		}
+		if !strings.EqualFold(engine.String, "InnoDB") && !strings.EqualFold(engine.String, "ndbcluster") {
+			return false, fmt.Sprintf("表 %s 使用 %s 引擎，不支持事务回滚", t[1], engine.String)
+		}
+	}
+	return true, ""
+}
+
+// primaryKeyColumns 返回单表的主键列，没有主键时返回 nil
+func primaryKeyColumns(q queryer, schema, table string) []string {
+	if schema == "" {
+		var err error
+		if schema, err = currentDatabase(q); err != nil {
+			return nil
+		}
+	}
+	rows, err := fetchIndexRows(q, schema, table)
+	if err != nil {
+		return nil
+	}
+	for _, idx := range groupIndexes(rows) {
+		if idx.Name == "PRIMARY" {
+			return idx.Columns
+		}
+	}
+	return nil
+}
+
+// sampleRows 在事务中读取样本行，同时返回原始值（用于按主键再次定位）和转换后的值
+type sampleRows struct {
+	columns []string
+	raw     [][]interface{}
+	values  [][]interface{}
+}
+
+func querySample(q queryer, query string, args []interface{}) (*sampleRows, error) {
+	rows, err := q.QueryContext(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	sample := &sampleRows{}
+	for _, ct := range columnTypes {
+		sample.columns = append(sample.columns, ct.Name())
+	}
+	for rows.Next() {
+		raw := make([]interface{}, len(columnTypes))
+		ptrs := make([]interface{}, len(columnTypes))
+		for i := range raw {
+			ptrs[i] = &raw[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(raw))
+		for i, v := range raw {
+			values[i] = convertValue(v, columnTypes[i].DatabaseTypeName(), "base64")
+		}
+		sample.raw = append(sample.raw, raw)
+		sample.values = append(sample.values, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 样本行同样按脱敏规则处理，raw 只用于按主键定位，不返回
+	rm, err := newResultMasker(query, sample.columns)
+	if err != nil {
+		return nil, err
+	}
+	rm.maskRows(sample.values)
+	return sample, nil
+}
+
+func (s *sampleRows) objects() []map[string]interface{} {
+	out := make([]map[string]interface{}, len(s.values))
+	for i, row := range s.values {
+		obj := map[string]interface{}{}
+		for j, col := range s.columns {
+			obj[col] = row[j]
+		}
+		out[i] = obj
+	}
+	return out
+}
+
+// keyOf 按主键列取出行的键，用于对齐修改前后的行
+func (s *sampleRows) keyOf(row []interface{}, pk []string) (string, []interface{}) {
+	var parts []string
+	var values []interface{}
+	for _, col := range pk {
+		for j, c := range s.columns {
+			if strings.EqualFold(c, col) {
+				// 无参数查询走文本协议返回 []byte，带参数的走二进制协议返回具体类型，统一按文本比较
+				if b, ok := row[j].([]byte); ok {
+					parts = append(parts, string(b))
+				} else {
+					parts = append(parts, fmt.Sprintf("%v", row[j]))
+				}
+				values = append(values, row[j])
+			}
+		}
+	}
+	return strings.Join(parts, "\x00"), values
+}
+
+// writeTrial 在事务中试运行写语句并回滚，返回影响行数和修改前后的样本。
+// 在会话中时使用保存点，只回滚试运行本身，不影响会话中已有的修改；否则在预览所用的连接 conn 上开启事务
+func writeTrial(sess *dbSession, conn *sql.Conn, stmt *writeStatement, query string, args []interface{}) (int64, []map[string]interface{}, error) {
+	ctx := context.Background()
+	var tx queryer
+	if sess != nil {
+		if _, err := sess.conn.ExecContext(ctx, "SAVEPOINT mcp_trial"); err != nil {
+			return 0, nil, err
+		}
+		defer sess.conn.ExecContext(ctx, "ROLLBACK TO SAVEPOINT mcp_trial")
+		tx = sess.conn
+	} else {
+		t, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, nil, err
+		}
+		defer t.Rollback()
+		tx = t
+	}
+
+	var err error
+	sampleSize := getEnvInt("WRITE_SAMPLE_ROWS", defaultWriteSampleRows)
+	var before *sampleRows
+	var pk []string
+	if stmt.kind == "UPDATE" || stmt.kind == "DELETE" {
+		sampleSQL := "SELECT * FROM " + stmt.tableRefs + "\n" + stmt.tail
+		if stmt.hasLimit {
+			sampleSQL = "SELECT * FROM (" + sampleSQL + "\n) AS sample"
+		}
+		sampleSQL += fmt.Sprintf("\nLIMIT %d", sampleSize)
+		if before, err = querySample(tx, sampleSQL, pickArgs(args, stmt.previewArg)); err != nil {
+			return 0, nil, fmt.Errorf("读取样本行失败: %v", err)
+		}
+		if len(stmt.tables) == 1 {
+			pk = primaryKeyColumns(tx, stmt.tables[0][0], stmt.tables[0][1])
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, nil, err
+	}
+	affected, _ := res.RowsAffected()
+
+	if before == nil {
+		return affected, nil, nil
+	}
+	samples := make([]map[string]interface{}, len(before.values))
+	beforeObjs := before.objects()
+	for i := range samples {
+		samples[i] = map[string]interface{}{"before": beforeObjs[i]}
+	}
+
+	// UPDATE 按主键读取修改后的行；DELETE 的 after 为空
+	if stmt.kind == "UPDATE" && len(pk) > 0 && len(before.raw) > 0 {
+		var conds []string
+		var keyArgs []interface{}
+		for _, row := range before.raw {
+			_, values := before.keyOf(row, pk)
+			if len(values) != len(pk) {
+				return affected, samples, nil
+			}
+			conds = append(conds, "("+strings.TrimSuffix(strings.Repeat("?, ", len(pk)), ", ")+")")
+			keyArgs = append(keyArgs, values...)
+		}
+		quoted := make([]string, len(pk))
+		for i, col := range pk {
+			quoted[i] = "`" + strings.ReplaceAll(col, "`", "``") + "`"
+		}
+		table := "`" + strings.ReplaceAll(stmt.tables[0][1], "`", "``") + "`"
+		if schema := stmt.tables[0][0]; schema != "" {
+			table = "`" + strings.ReplaceAll(schema, "`", "``") + "`." + table
+		}
+		afterSQL := fmt.Sprintf("SELECT * FROM %s WHERE (%s) IN (%s)", table, strings.Join(quoted, ", "), strings.Join(conds, ", "))
+		after, err := querySample(tx, afterSQL, keyArgs)
+		if err == nil {
+			byKey := map[string]map[string]interface{}{}
+			for i, obj := range after.objects() {
+				key, _ := after.keyOf(after.raw[i], pk)
+				byKey[key] = obj
+			}
+			for i, row := range before.raw {
+				key, _ := before.keyOf(row, pk)
+				samples[i]["after"] = byKey[key]
+			}
+		}
+	}
+	return affected, samples, nil
+}
+
+func pickArgs(args []interface{}, indexes []int) []interface{} {
+	picked := make([]interface{}, 0, len(indexes))
+	for _, i := range indexes {
+		if i < len(args) {
+			picked = append(picked, args[i])
+		}
+	}
+	return picked
+}
+
+func newConfirmToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// executeWrite 受控写入：不带确认令牌时预览并试运行，带令牌时提交
+func executeWrite(request map[string]interface{}) (*mcp.CallToolResult, error) {
+	if !writeEnabled() {
+		return mcp.NewToolResultError("写入模式未开启，需要设置 WRITE_ENABLED=true"), nil
+	}
+
+	query, ok := request["query"].(string)
+	if !ok || query == "" {
+		return mcp.NewToolResultError("query 参数是必需的"), nil
+	}
+	query = trimStatement(query)
+
+	rawArgs, err := parseBindArgs(request["args"])
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if n := countPlaceholders(query); n != len(rawArgs) {
+		return mcp.NewToolResultError(fmt.Sprintf("参数个数不匹配：语句中有 %d 个 ? 占位符，args 提供了 %d 个", n, len(rawArgs))), nil
+	}
+	args, err := bindArgs(rawArgs)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	argsKey, _ := json.Marshal(rawArgs)
+
+	stmt, err := parseWriteStatement(query)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := checkQueryAccess(query, stmt.tables...); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// 在会话中执行时，预览、试运行和提交都使用会话的连接
+	var q queryer
+	var sess *dbSession
+	sessionID, _ := request["session_id"].(string)
+	if sessionID != "" {
+		if sess, err = acquireSession(sessionID); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		defer sess.release()
+		if sess.readOnly {
+			return mcp.NewToolResultError(fmt.Sprintf("会话 %s 是只读会话，写入需要 mode=read_write 的会话", sessionID)), nil
+		}
+		q = sess.conn
+	}
+
+	if token, _ := request["confirm_token"].(string); token != "" {
+		return commitWrite(callOf(request), sess, token, query, string(argsKey), rawArgs, args)
+	}
+
+	// 不在会话中时，预览、表结构查询和试运行共用一个带会话限制的连接
+	var conn *sql.Conn
+	if sess == nil {
+		c, release, err := checkoutWriteConn(context.Background())
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		defer release()
+		conn, q = c, c
+	}
+
+	start := time.Now()
+	entry := historyEntry{call: callOf(request), Time: start, Tool: "execute_write:dry_run", Query: query, Args: rawArgs, Session: sessionID}
+	out := map[string]interface{}{
+		"dry_run":        true,
+		"statement_type": stmt.kind,
+		"query":          query,
+	}
+	var warnings []string
+	if (stmt.kind == "UPDATE" || stmt.kind == "DELETE") && !stmt.hasWhere {
+		warnings = append(warnings, "语句没有 WHERE 条件，将影响全表")
+	}
+
+	// 预览：等价的 SELECT COUNT(*)
+	var previewCount int64 = -1
+	if stmt.kind == "UPDATE" || stmt.kind == "DELETE" {
+		previewSQL := "SELECT COUNT(*) FROM (SELECT 1 AS one FROM " + stmt.tableRefs + "\n" + stmt.tail + "\n) AS preview"
+		if err := q.QueryRowContext(context.Background(), previewSQL, pickArgs(args, stmt.previewArg)...).Scan(&previewCount); err != nil {
+			entry.Error = err.Error()
+			recordQuery(entry)
+			return mcp.NewToolResultError(fmt.Sprintf("预览失败: %v", err)), nil
+		}
+		out["preview_count"] = previewCount
+	}
+	if stmt.kind == "INSERT" || stmt.kind == "REPLACE" {
+		previewCount = stmt.sourceRows
+		if stmt.source != "" {
+			previewSQL := "SELECT COUNT(*) FROM (" + stmt.source + "\n) AS preview"
+			if err := q.QueryRowContext(context.Background(), previewSQL, pickArgs(args, stmt.previewArg)...).Scan(&previewCount); err != nil {
+				entry.Error = err.Error()
+				recordQuery(entry)
+				return mcp.NewToolResultError(fmt.Sprintf("预览失败: %v", err)), nil
+			}
+		}
+		if previewCount >= 0 {
+			out["preview_count"] = previewCount
+		}
+	}
+
+	// 试运行：在事务中执行后回滚。不支持事务的表无法试运行，需要调用方显式确认
+	affected := previewCount
+	trialRan := false
+	if ok, reason := transactionalTables(q, stmt.tables); ok {
+		n, samples, err := writeTrial(sess, conn, stmt, query, args)
+		if err != nil {
+			entry.Error = err.Error()
+			entry.DurationMs = time.Since(start).Milliseconds()
+			recordQuery(entry)
+			return mcp.NewToolResultError(fmt.Sprintf("试运行失败（已回滚）: %v", err)), nil
+		}
+		affected, trialRan = n, true
+		out["trial_affected_rows"] = n
+		if samples != nil {
+			out["sample"] = samples
+		}
+	} else {
+		if allow, _ := request["allow_non_transactional"].(bool); !allow {
+			entry.Error = reason
+			entry.DurationMs = time.Since(start).Milliseconds()
+			recordQuery(entry)
+			return mcp.NewToolResultError(fmt.Sprintf("无法试运行：%s。确认要不经试运行直接写入时，传入 allow_non_transactional=true 重新预览", reason)), nil
+		}
+		if previewCount < 0 {
+			entry.Error = reason
+			entry.DurationMs = time.Since(start).Milliseconds()
+			recordQuery(entry)
+			return mcp.NewToolResultError(fmt.Sprintf("无法试运行：%s，且无法预估影响行数，不能保证不超过 WRITE_MAX_ROWS", reason)), nil
+		}
+		warnings = append(warnings, "未试运行："+reason+"，提交后无法回滚")
+	}
+
+	entry.Rows = affected
+	entry.DurationMs = time.Since(start).Milliseconds()
+	recordQuery(entry)
+
+	if maxRows := int64(getEnvInt("WRITE_MAX_ROWS", defaultWriteMaxRows)); affected > maxRows {
+		out["error"] = fmt.Sprintf("预计影响 %d 行，超过上限 WRITE_MAX_ROWS=%d，不签发确认令牌", affected, maxRows)
+	} else {
+		token := newConfirmToken()
+		expires := time.Now().Add(writeConfirmTTL())
+		pendingWrites.Lock()
+		for k, p := range pendingWrites.items {
+			if time.Now().After(p.expiresAt) {
+				delete(pendingWrites.items, k)
+			}
+		}
+		pendingWrites.items[token] = &pendingWrite{query: query, args: string(argsKey), affected: affected, trialRan: trialRan, session: sessionID, expiresAt: expires}
+		pendingWrites.Unlock()
+		out["confirmation_token"] = token
+		out["expires_at"] = expires.Format(time.RFC3339)
+		out["next_step"] = "确认无误后，使用相同的 query 和 args 并传入 confirm_token 再次调用 execute_write 提交"
+	}
+	if len(warnings) > 0 {
+		out["warnings"] = warnings
+	}
+
+	jsonData, _ := json.MarshalIndent(out, "", "  ")
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+// commitWrite 校验确认令牌并提交。试运行过的语句如果实际影响行数与试运行不一致，回滚并要求重新预览。
+// 在会话中时只执行语句，由 commit_session 统一提交
+func commitWrite(call *toolCall, sess *dbSession, token, query, argsKey string, rawArgs []json.RawMessage, args []interface{}) (*mcp.CallToolResult, error) {
+	sessionID := ""
+	if sess != nil {
+		sessionID = sess.id
+	}
+
+	pendingWrites.Lock()
+	pending, ok := pendingWrites.items[token]
+	if ok {
+		// 令牌只能使用一次
+		delete(pendingWrites.items, token)
+	}
+	pendingWrites.Unlock()
+
+	switch {
+	case !ok:
+		return mcp.NewToolResultError("确认令牌无效或已使用，请重新预览"), nil
+	case time.Now().After(pending.expiresAt):
+		return mcp.NewToolResultError("确认令牌已过期，请重新预览"), nil
+	case pending.query != query || pending.args != argsKey:
+		return mcp.NewToolResultError("语句或参数与预览时不一致，请重新预览"), nil
+	case pending.session != sessionID:
+		return mcp.NewToolResultError("session_id 与预览时不一致，请重新预览"), nil
+	}
+
+	start := time.Now()
+	entry := historyEntry{call: call, Time: start, Tool: "execute_write", Query: query, Args: rawArgs, Session: sessionID}
+	fail := func(msg string) (*mcp.CallToolResult, error) {
+		entry.Error = msg
+		entry.DurationMs = time.Since(start).Milliseconds()
+		recordQuery(entry)
+		return mcp.NewToolResultError(msg), nil
+	}
+
+	if sess != nil {
+		return commitSessionWrite(sess, pending, query, args, entry, fail)
+	}
+
+	ctx := context.Background()
+	conn, release, err := checkoutWriteConn(ctx)
+	if err != nil {
+		return fail(err.Error())
+	}
+	defer release()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(fmt.Sprintf("开启事务失败: %v", err))
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fail(fmt.Sprintf("执行失败（已回滚）: %v", err))
+	}
+	affected, _ := res.RowsAffected()
+	if pending.trialRan && affected != pending.affected {
+		return fail(fmt.Sprintf("影响行数与试运行不一致（试运行 %d，实际 %d），数据可能已变化，已回滚，请重新预览", pending.affected, affected))
+	}
+	if err := tx.Commit(); err != nil {
+		return fail(fmt.Sprintf("提交失败: %v", err))
+	}
+
+	entry.Rows = affected
+	entry.DurationMs = time.Since(start).Milliseconds()
+	recordQuery(entry)
+
+	out := map[string]interface{}{
+		"committed":     true,
+		"affected_rows": affected,
+	}
+	if id, err := res.LastInsertId(); err == nil && id > 0 {
+		out["last_insert_id"] = id
+	}
+	jsonData, _ := json.MarshalIndent(out, "", "  ")
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
+
+// commitSessionWrite 在会话的事务中执行已确认的写语句，失败或行数不一致时回滚到执行前的保存点
+func commitSessionWrite(sess *dbSession, pending *pendingWrite, query string, args []interface{}, entry historyEntry, fail func(string) (*mcp.CallToolResult, error)) (*mcp.CallToolResult, error) {
+	ctx := context.Background()
+	if _, err := sess.conn.ExecContext(ctx, "SAVEPOINT mcp_write"); err != nil {
+		return fail(fmt.Sprintf("创建保存点失败: %v", err))
+	}
+	res, err := sess.conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		sess.conn.ExecContext(ctx, "ROLLBACK TO SAVEPOINT mcp_write")
+		return fail(fmt.Sprintf("执行失败（已撤销本条语句）: %v", err))
+	}
+	affected, _ := res.RowsAffected()
+	if pending.trialRan && affected != pending.affected {
+		sess.conn.ExecContext(ctx, "ROLLBACK TO SAVEPOINT mcp_write")
+		return fail(fmt.Sprintf("影响行数与试运行不一致（试运行 %d，实际 %d），已撤销本条语句，请重新预览", pending.affected, affected))
+	}
+	sess.conn.ExecContext(ctx, "RELEASE SAVEPOINT mcp_write")
+
+	entry.Rows = affected
+	entry.DurationMs = time.Since(entry.Time).Milliseconds()
+	recordQuery(entry)
+
+	out := map[string]interface{}{
+		"committed":     false,
+		"session_id":    sess.id,
+		"affected_rows": affected,
+		"next_step":     "修改已在会话事务中执行，调用 commit_session 提交或 rollback_session 撤销",
+	}
+	if id, err := res.LastInsertId(); err == nil && id > 0 {
+		out["last_insert_id"] = id
+	}
+	jsonData, _ := json.MarshalIndent(out, "", "  ")
+	return mcp.NewToolResultText(string(jsonData)), nil
+}
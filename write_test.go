@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseWriteStatementInsertSource(t *testing.T) {
+	tests := []struct {
+		query      string
+		source     string
+		sourceRows int64
+		previewArg []int
+	}{
+		{"INSERT INTO t (a, b) VALUES (1, 2)", "", 1, nil},
+		{"INSERT INTO t VALUES (1, 'x'), (2, 'y'), (?, ?)", "", 3, nil},
+		{"INSERT INTO t VALUES ROW(1, 2), ROW(3, 4)", "", 2, nil},
+		{"INSERT INTO t (a) VALUES (1), (2) AS new (a) ON DUPLICATE KEY UPDATE a = new.a", "", 2, nil},
+		{"INSERT INTO t SET a = 1, b = 2", "", 1, nil},
+		{"INSERT INTO t TABLE s", "", -1, nil},
+		{"INSERT INTO db.t (a) SELECT a FROM s WHERE b > ?", "SELECT a FROM s WHERE b > ?", -1, []int{0}},
+		{"REPLACE INTO t PARTITION (p0) (a) SELECT a FROM s", "SELECT a FROM s", -1, nil},
+		{"INSERT INTO t (SELECT a FROM s LIMIT 10)", "(SELECT a FROM s LIMIT 10)", -1, nil},
+		{"INSERT INTO t WITH x AS (SELECT ? AS a) SELECT a FROM x", "WITH x AS (SELECT ? AS a) SELECT a FROM x", -1, []int{0}},
+		{"INSERT INTO t (a) SELECT s.a FROM s JOIN u ON s.id = u.id ON DUPLICATE KEY UPDATE a = ?",
+			"SELECT s.a FROM s JOIN u ON s.id = u.id", -1, nil},
+	}
+	for _, tt := range tests {
+		stmt, err := parseWriteStatement(tt.query)
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if stmt.source != tt.source || stmt.sourceRows != tt.sourceRows || !reflect.DeepEqual(stmt.previewArg, tt.previewArg) {
+			t.Errorf("%s: source = %q, rows = %d, args = %v; want %q, %d, %v",
+				tt.query, stmt.source, stmt.sourceRows, stmt.previewArg, tt.source, tt.sourceRows, tt.previewArg)
+		}
+	}
+}